@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jdormit/logr/history"
+	"github.com/jdormit/logr/report"
+	"os"
+	"time"
+)
+
+const defaultAlertsWindow = 7 * 24 * time.Hour
+
+func alertsUsage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Printf(`List past alert incidents, most recent first
+
+USAGE:
+  %s alerts [OPTIONS]
+
+OPTIONS:
+  -h, -help
+        Display this message and exit
+`, os.Args[0])
+		flags.PrintDefaults()
+	}
+}
+
+// The incidentsTable function returns `incidents` as a report.Table. Ongoing
+// incidents have an empty end and their duration so far as of `now`.
+func incidentsTable(incidents []history.Incident, now time.Time) (table report.Table) {
+	table.Columns = []string{"rule", "start", "end", "duration", "peak", "label", "condition"}
+	for _, incident := range incidents {
+		end := ""
+		if !incident.Ongoing() {
+			end = incident.End.Format(time.RFC3339)
+		}
+		table.Rows = append(table.Rows, []interface{}{
+			incident.Rule,
+			incident.Start.Format(time.RFC3339),
+			end,
+			incident.Duration(now).String(),
+			incident.Peak,
+			incident.Label,
+			incident.Condition,
+		})
+	}
+	return
+}
+
+func runAlerts(args []string) {
+	flags := flag.NewFlagSet("alerts", flag.ExitOnError)
+	flags.Usage = alertsUsage(flags)
+	dbPath := flags.String("dbPath", defaultDbPath, "The `path` to the SQLite database")
+	logPath := flags.String("logFile", defaultLogPath, "The `path` of the log file whose alerts to list. SQL LIKE wildcards are allowed, e.g. % lists the alerts of every log file")
+	startArg := flags.String("start", defaultAlertsWindow.String(), "List incidents ongoing after this RFC 3339 `time` or duration before now")
+	endArg := flags.String("end", "0s", "List incidents ongoing before this RFC 3339 `time` or duration before now")
+	limit := flags.Int("limit", 0, "The maximum `number` of incidents to list, or 0 for no limit")
+	format := flags.String("format", "table", "The output `format`: table, csv or json")
+	flags.Parse(args)
+
+	exitOnError := func(err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	now := time.Now()
+	start, err := parseTimeArg(*startArg, now)
+	exitOnError(err)
+	end, err := parseTimeArg(*endArg, now)
+	exitOnError(err)
+
+	db, err := loadDB(*dbPath)
+	exitOnError(err)
+	defer db.Close()
+
+	alertHistory := history.Store{db, *logPath}
+	incidents, err := alertHistory.Incidents(start, end, *limit)
+	exitOnError(err)
+	table := incidentsTable(incidents, now)
+	exitOnError(table.Write(os.Stdout, *format))
+}
@@ -0,0 +1,873 @@
+/*
+Package alerts evaluates named alert rules against the stored log lines.
+
+A Rule compares a metric, computed over a trailing window of log lines that match an
+optional filter, with a threshold. Each rule has its own state: it is inactive while
+its condition is false, pending once the condition becomes true, and firing once the
+condition has held for the rule's For duration. A firing rule whose condition becomes
+false is resolved until it next becomes pending.
+
+Rules can damp alerts whose metric hovers around the threshold. A ClearThreshold makes
+a pending or firing rule's condition hold until the metric crosses the clear threshold
+rather than the threshold, and MinFiring and MinResolved keep a rule firing or resolved
+for a minimum time. A rule with a FlapWindow stays firing until the flap window has
+passed since it fired or its condition last started to hold again, however many times
+it has fired, so that a condition that keeps flipping is a single incident. A rule
+whose condition starts to hold FlapCount times within its flap window is also marked
+as flapping.
+
+A rule with a Baseline is an anomaly rule: instead of comparing its metric with a fixed
+threshold, it compares the number of standard deviations between the metric and the
+metric's baseline, so that "traffic > 3" means traffic more than three standard
+deviations above what is usual. The baseline is either an EWMA of the rule's previous
+evaluations or the same window at the same hour and day of the week in previous weeks
+of stored history.
+
+The staleness and lag metrics watch the log reader itself rather than the traffic it
+reads, so that a log file that stops being written or a reader that falls behind
+raises an alert instead of an empty chart. They ignore the window.
+
+An Engine evaluates every rule at a point in time and reports the state transitions
+since the previous evaluation, independently of how (or whether) alerts are displayed.
+*/
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jdormit/logr/anomaly"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/timeseries"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics a rule can alert on
+const (
+	// Traffic is the average number of requests per second over the window
+	Traffic = "traffic"
+	// Bandwidth is the average number of response bytes per second over the window
+	Bandwidth = "bandwidth"
+	// ErrorRate is the percentage of requests over the window whose response status
+	// is in the rule's StatusClass
+	ErrorRate = "error_rate"
+	// Staleness is the number of seconds since the newest stored log line or the
+	// engine's first evaluation, whichever is later
+	Staleness = "staleness"
+	// LagBytes is the number of bytes between the log reader's position and the end
+	// of the log file
+	LagBytes = "lag_bytes"
+	// LagSeconds is the staleness of the stored log lines while the log reader is
+	// behind the end of the log file, and 0 once it has caught up
+	LagSeconds = "lag_seconds"
+)
+
+var metricUnits = map[string]string{
+	Traffic:    "requests/second",
+	Bandwidth:  "bytes/second",
+	ErrorRate:  "percent of requests",
+	Staleness:  "seconds without log lines",
+	LagBytes:   "bytes behind the end of the log file",
+	LagSeconds: "seconds behind the end of the log file",
+}
+
+// The metrics computed from the log reader's progress rather than a window of log lines
+var progressMetrics = map[string]bool{
+	Staleness:  true,
+	LagBytes:   true,
+	LagSeconds: true,
+}
+
+// The baselines an anomaly rule can compare its metric with
+const (
+	// EWMA is an exponentially weighted moving average of the rule's previous values
+	EWMA = "ewma"
+	// Seasonal is the rule's value at the same time of week in previous weeks
+	Seasonal = "seasonal"
+)
+
+var baselines = map[string]bool{
+	EWMA:     true,
+	Seasonal: true,
+}
+
+// defaultFlapCount is the number of times a rule must fire within its flap window to be
+// flapping, if the rule doesn't set FlapCount
+const defaultFlapCount = 2
+
+// The ways a traffic rule can be evaluated per group of log lines
+var groupByFields = map[string]bool{
+	"section": true,
+	"host":    true,
+}
+
+// statusClassPattern matches a status class such as "5xx" or a single status such as "503"
+var statusClassPattern = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+
+// The comparisons a rule can make between its metric and its threshold
+var comparisons = map[string]func(value float64, threshold float64) bool{
+	">":  func(value float64, threshold float64) bool { return value > threshold },
+	">=": func(value float64, threshold float64) bool { return value >= threshold },
+	"<":  func(value float64, threshold float64) bool { return value < threshold },
+	"<=": func(value float64, threshold float64) bool { return value <= threshold },
+}
+
+// A Rule describes when an alert should fire
+type Rule struct {
+	Name   string
+	Metric string
+	// Filter restricts the log lines the metric is computed from. A nil filter
+	// matches every log line.
+	Filter     *filter.Filter
+	Comparison string
+	Threshold  float64
+	// Window is the length of the trailing window the metric is computed over
+	Window time.Duration
+	// For is how long the condition must hold before the alert fires
+	For time.Duration
+	// StatusClass is the class of response statuses counted by error rate rules,
+	// e.g. "5xx", or a single status such as "503"
+	StatusClass string
+	// MinRequests is the minimum number of requests in the window for an error rate
+	// rule's condition to hold, so that a handful of errors during a quiet period
+	// doesn't fire the alert
+	MinRequests int
+	// Section restricts the rule to log lines in a single section, e.g. "api"
+	Section string
+	// PathPrefix restricts the rule to log lines whose path starts with the prefix,
+	// e.g. "/login"
+	PathPrefix string
+	// GroupBy evaluates a traffic rule separately for each "section" or "host",
+	// so that the rule's value is the traffic of the busiest section or host
+	GroupBy string
+	// Baseline makes the rule an anomaly rule, whose value is the number of standard
+	// deviations between its metric and an "ewma" or "seasonal" baseline
+	Baseline string
+	// Alpha is the smoothing factor of an EWMA baseline, between 0 and 1. It
+	// defaults to anomaly.DefaultAlpha.
+	Alpha float64
+	// Periods is the number of previous weeks in a seasonal baseline. It defaults
+	// to anomaly.DefaultPeriods.
+	Periods int
+	// ClearThreshold is the threshold a pending or firing rule's metric must cross
+	// for its condition to stop holding. A nil ClearThreshold is the same as Threshold.
+	ClearThreshold *float64
+	// MinFiring is the minimum time a rule stays firing once it fires
+	MinFiring time.Duration
+	// MinResolved is the minimum time a rule stays resolved before it can fire again
+	MinResolved time.Duration
+	// FlapWindow enables flap damping: a firing rule doesn't resolve until FlapWindow
+	// has passed since it fired or its condition last started to hold again, even if
+	// it has only fired once, so that a condition that keeps flipping is recorded as a
+	// single incident
+	FlapWindow time.Duration
+	// FlapCount is the number of times a rule's condition must start to hold within
+	// FlapWindow for the rule to be marked as flapping. It defaults to 2.
+	FlapCount int
+}
+
+// A RuleError is returned when a rule is invalid
+type RuleError struct {
+	Rule string
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("Invalid alert rule %q: %s", e.Rule, e.Msg)
+}
+
+// Validate returns a *RuleError if the rule can't be evaluated
+func (rule Rule) Validate() error {
+	if rule.Name == "" {
+		return &RuleError{rule.Name, "name is required"}
+	}
+	if _, ok := metricUnits[rule.Metric]; !ok {
+		return &RuleError{rule.Name, fmt.Sprintf("unknown metric %q", rule.Metric)}
+	}
+	if _, ok := comparisons[rule.Comparison]; !ok {
+		return &RuleError{rule.Name, fmt.Sprintf("unknown comparison %q", rule.Comparison)}
+	}
+	if progressMetrics[rule.Metric] {
+		if rule.Filter != nil || rule.Section != "" || rule.PathPrefix != "" || rule.Baseline != "" {
+			return &RuleError{rule.Name, fmt.Sprintf("filters and baselines are not supported for %s rules", rule.Metric)}
+		}
+	} else if rule.Window < time.Second {
+		return &RuleError{rule.Name, "window must be at least one second"}
+	}
+	if rule.For < 0 {
+		return &RuleError{rule.Name, "for must not be negative"}
+	}
+	if rule.Metric == ErrorRate && !statusClassPattern.MatchString(rule.StatusClass) {
+		return &RuleError{rule.Name, fmt.Sprintf("invalid status class %q: expected e.g. 5xx or 503", rule.StatusClass)}
+	}
+	if rule.MinRequests < 0 {
+		return &RuleError{rule.Name, "minRequests must not be negative"}
+	}
+	if rule.PathPrefix != "" && !strings.HasPrefix(rule.PathPrefix, "/") {
+		return &RuleError{rule.Name, fmt.Sprintf("path prefix %q must start with /", rule.PathPrefix)}
+	}
+	if rule.GroupBy != "" {
+		if _, ok := groupByFields[rule.GroupBy]; !ok {
+			return &RuleError{rule.Name, fmt.Sprintf("unknown groupBy %q: expected section or host", rule.GroupBy)}
+		}
+		if rule.Metric != Traffic {
+			return &RuleError{rule.Name, "groupBy is only supported for traffic rules"}
+		}
+	}
+	if rule.Baseline != "" {
+		if !baselines[rule.Baseline] {
+			return &RuleError{rule.Name, fmt.Sprintf("unknown baseline %q: expected ewma or seasonal", rule.Baseline)}
+		}
+		if rule.GroupBy != "" {
+			return &RuleError{rule.Name, "groupBy is not supported for anomaly rules"}
+		}
+	}
+	if rule.Alpha < 0 || rule.Alpha >= 1 {
+		return &RuleError{rule.Name, "alpha must be at least 0 and less than 1"}
+	}
+	if rule.Periods < 0 {
+		return &RuleError{rule.Name, "periods must not be negative"}
+	}
+	if rule.ClearThreshold != nil {
+		if strings.HasPrefix(rule.Comparison, "<") && *rule.ClearThreshold < rule.Threshold {
+			return &RuleError{rule.Name, "clear threshold must not be below the threshold"}
+		}
+		if strings.HasPrefix(rule.Comparison, ">") && *rule.ClearThreshold > rule.Threshold {
+			return &RuleError{rule.Name, "clear threshold must not be above the threshold"}
+		}
+	}
+	if rule.MinFiring < 0 || rule.MinResolved < 0 || rule.FlapWindow < 0 {
+		return &RuleError{rule.Name, "minFiring, minResolved and flapWindow must not be negative"}
+	}
+	if rule.FlapCount < 0 || rule.FlapCount == 1 {
+		return &RuleError{rule.Name, "flapCount must be at least 2"}
+	}
+	_, err := rule.scopedFilter()
+	return err
+}
+
+// The alpha method returns the smoothing factor of the rule's EWMA baseline
+func (rule Rule) alpha() float64 {
+	if rule.Alpha == 0 {
+		return anomaly.DefaultAlpha
+	}
+	return rule.Alpha
+}
+
+// The clearThreshold method returns the threshold a pending or firing rule's metric
+// must cross for its condition to stop holding
+func (rule Rule) clearThreshold() float64 {
+	if rule.ClearThreshold == nil {
+		return rule.Threshold
+	}
+	return *rule.ClearThreshold
+}
+
+// The flapCount method returns the number of times the rule must fire within its
+// flap window to be flapping
+func (rule Rule) flapCount() int {
+	if rule.FlapCount == 0 {
+		return defaultFlapCount
+	}
+	return rule.FlapCount
+}
+
+// The periods method returns the number of weeks in the rule's seasonal baseline
+func (rule Rule) periods() int {
+	if rule.Periods == 0 {
+		return anomaly.DefaultPeriods
+	}
+	return rule.Periods
+}
+
+// The scopedFilter method returns the rule's filter restricted to its section and
+// path prefix, if it has them
+func (rule Rule) scopedFilter() (f *filter.Filter, err error) {
+	clauses := make([]string, 0)
+	if rule.Filter != nil {
+		clauses = append(clauses, "("+rule.Filter.Expr+")")
+	}
+	if rule.Section != "" {
+		clauses = append(clauses, "section="+strconv.Quote(rule.Section))
+	}
+	if rule.PathPrefix != "" {
+		clauses = append(clauses, "path~"+strconv.Quote(rule.PathPrefix+"*"))
+	}
+	if len(clauses) == 1 && rule.Filter != nil {
+		return rule.Filter, nil
+	}
+	f, err = filter.Parse(strings.Join(clauses, " and "))
+	if err != nil {
+		return nil, &RuleError{rule.Name, err.Error()}
+	}
+	return
+}
+
+// String describes the rule's condition, e.g. "traffic > 10 requests/second over 2m0s"
+func (rule Rule) String() string {
+	metric := rule.Metric
+	if rule.Metric == ErrorRate {
+		metric = rule.StatusClass + " " + metric
+	}
+	description := fmt.Sprintf("%s %s %v %s over %v",
+		metric, rule.Comparison, rule.Threshold, metricUnits[rule.Metric], rule.Window)
+	if progressMetrics[rule.Metric] {
+		description = fmt.Sprintf("%s %s %v %s", metric, rule.Comparison, rule.Threshold, metricUnits[rule.Metric])
+	}
+	if rule.Baseline != "" {
+		description = fmt.Sprintf("%s over %v %s %v standard deviations from its %s baseline",
+			metric, rule.Window, rule.Comparison, rule.Threshold, rule.Baseline)
+	}
+	if rule.Section != "" {
+		description = fmt.Sprintf("%s in section %s", description, rule.Section)
+	}
+	if rule.PathPrefix != "" {
+		description = fmt.Sprintf("%s under %s", description, rule.PathPrefix)
+	}
+	if rule.Filter != nil {
+		description = fmt.Sprintf("%s matching %s", description, rule.Filter)
+	}
+	if rule.GroupBy != "" {
+		description = fmt.Sprintf("%s from any one %s", description, rule.GroupBy)
+	}
+	if rule.MinRequests > 0 {
+		description = fmt.Sprintf("%s with at least %d requests", description, rule.MinRequests)
+	}
+	if rule.For > 0 {
+		description = fmt.Sprintf("%s for %v", description, rule.For)
+	}
+	if rule.ClearThreshold != nil && strings.HasPrefix(rule.Comparison, "<") {
+		description = fmt.Sprintf("%s, clearing above %v", description, *rule.ClearThreshold)
+	} else if rule.ClearThreshold != nil {
+		description = fmt.Sprintf("%s, clearing below %v", description, *rule.ClearThreshold)
+	}
+	return description
+}
+
+// The ruleConfig type is the JSON representation of a Rule in a rules file
+type ruleConfig struct {
+	Name        string  `json:"name"`
+	Metric      string  `json:"metric"`
+	Filter      string  `json:"filter"`
+	Comparison  string  `json:"comparison"`
+	Threshold   float64 `json:"threshold"`
+	Window      string  `json:"window"`
+	For         string  `json:"for"`
+	StatusClass string  `json:"statusClass"`
+	MinRequests int     `json:"minRequests"`
+	Section     string  `json:"section"`
+	PathPrefix  string  `json:"pathPrefix"`
+	GroupBy     string  `json:"groupBy"`
+	Baseline    string  `json:"baseline"`
+	Alpha       float64 `json:"alpha"`
+	Periods     int     `json:"periods"`
+	// ClearThreshold is a pointer so that a clear threshold of 0 can be told apart
+	// from no clear threshold
+	ClearThreshold *float64 `json:"clearThreshold"`
+	MinFiring      string   `json:"minFiring"`
+	MinResolved    string   `json:"minResolved"`
+	FlapWindow     string   `json:"flapWindow"`
+	FlapCount      int      `json:"flapCount"`
+}
+
+func (config ruleConfig) rule() (rule Rule, err error) {
+	rule = Rule{
+		Name:           config.Name,
+		Metric:         config.Metric,
+		Comparison:     config.Comparison,
+		Threshold:      config.Threshold,
+		StatusClass:    config.StatusClass,
+		MinRequests:    config.MinRequests,
+		Section:        config.Section,
+		PathPrefix:     config.PathPrefix,
+		GroupBy:        config.GroupBy,
+		Baseline:       config.Baseline,
+		Alpha:          config.Alpha,
+		Periods:        config.Periods,
+		ClearThreshold: config.ClearThreshold,
+		FlapCount:      config.FlapCount,
+	}
+	if rule.Comparison == "" {
+		rule.Comparison = ">"
+	}
+	rule.Filter, err = filter.Parse(config.Filter)
+	if err != nil {
+		return rule, &RuleError{rule.Name, err.Error()}
+	}
+	if config.Window != "" || !progressMetrics[rule.Metric] {
+		rule.Window, err = time.ParseDuration(config.Window)
+		if err != nil {
+			return rule, &RuleError{rule.Name, fmt.Sprintf("invalid window %q", config.Window)}
+		}
+	}
+	durations := []struct {
+		name     string
+		value    string
+		duration *time.Duration
+	}{
+		{"for", config.For, &rule.For},
+		{"minFiring", config.MinFiring, &rule.MinFiring},
+		{"minResolved", config.MinResolved, &rule.MinResolved},
+		{"flapWindow", config.FlapWindow, &rule.FlapWindow},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		*d.duration, err = time.ParseDuration(d.value)
+		if err != nil {
+			return rule, &RuleError{rule.Name, fmt.Sprintf("invalid %s %q", d.name, d.value)}
+		}
+	}
+	return rule, rule.Validate()
+}
+
+// ParseRules reads a JSON array of rules, e.g.
+//
+//	[{"name": "api-errors", "metric": "traffic", "filter": "section=api and status>=500",
+//	  "comparison": ">", "threshold": 1, "window": "1m", "for": "30s"}]
+//
+// Windows and for-durations are Go duration strings. The comparison defaults to ">".
+// Anomaly rules set a "baseline" and give their threshold in standard deviations, e.g.
+//
+//	[{"name": "traffic-anomaly", "metric": "traffic", "baseline": "seasonal",
+//	  "threshold": 3, "window": "5m"}]
+func ParseRules(r io.Reader) (rules []Rule, err error) {
+	var configs []ruleConfig
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&configs)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid alert rules: %v", err)
+	}
+	for _, config := range configs {
+		rule, err := config.rule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// LoadRules reads a JSON rules file from `path`. See ParseRules for the format.
+func LoadRules(path string) (rules []Rule, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	return ParseRules(file)
+}
+
+// A State is the state of a single rule
+type State int
+
+const (
+	Inactive State = iota
+	Pending
+	Firing
+	Resolved
+)
+
+var stateNames = []string{"inactive", "pending", "firing", "resolved"}
+
+func (state State) String() string {
+	return stateNames[state]
+}
+
+// MarshalText encodes a State as its name
+func (state State) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+// UnmarshalText decodes a State from its name
+func (state *State) UnmarshalText(text []byte) error {
+	for i, name := range stateNames {
+		if name == string(text) {
+			*state = State(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown alert state %q", text)
+}
+
+// A Status is the state of a rule as of its latest evaluation
+type Status struct {
+	Rule  Rule
+	State State
+	// Since is when the rule entered its current state
+	Since time.Time
+	// Value is the value of the rule's metric at the latest evaluation, or the
+	// number of standard deviations from its baseline for anomaly rules
+	Value float64
+	// Label is the section or host with the highest value at the latest evaluation,
+	// for rules with a GroupBy
+	Label string
+	// Flapping is true while a firing rule's condition has started to hold FlapCount
+	// times within its flap window
+	Flapping bool
+}
+
+// A Transition records a rule changing state
+type Transition struct {
+	Rule  string    `json:"alert"`
+	From  State     `json:"from"`
+	To    State     `json:"state"`
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Label string    `json:"label,omitempty"`
+}
+
+// A ReaderProgress reports how far a log reader has got through its log file
+type ReaderProgress interface {
+	Lag() (int64, error)
+	Newest() (time.Time, bool)
+}
+
+// An Engine evaluates a set of rules. It is safe to read an Engine's statuses from
+// other goroutines while it is evaluating. It should be instantiated via alerts.NewEngine().
+type Engine struct {
+	ts       *timeseries.LogTimeSeries
+	mu       sync.Mutex
+	statuses []Status
+	// filters holds the scoped filter of each rule, in the same order as statuses
+	filters []*filter.Filter
+	// ewmas holds the baseline of each rule with an EWMA baseline, and nil for other
+	// rules, in the same order as statuses
+	ewmas []*anomaly.EWMA
+	// fired holds the times within its flap window that each rule fired or its
+	// condition started to hold again while firing, newest first, and clearSince when
+	// each rule's condition last stopped holding, in the same order as statuses
+	fired      [][]time.Time
+	clearSince []time.Time
+	// reader is the log reader whose progress staleness and lag rules watch, and
+	// started the time of the first evaluation
+	reader  ReaderProgress
+	started time.Time
+	// first is the timestamp of the earliest stored log line, once there is one
+	first time.Time
+}
+
+// NewEngine returns an Engine that evaluates `rules` against the log lines in `ts`.
+// Every rule starts out inactive.
+func NewEngine(ts *timeseries.LogTimeSeries, rules []Rule) (engine *Engine, err error) {
+	names := make(map[string]bool)
+	statuses := make([]Status, 0, len(rules))
+	filters := make([]*filter.Filter, 0, len(rules))
+	ewmas := make([]*anomaly.EWMA, 0, len(rules))
+	for _, rule := range rules {
+		err = rule.Validate()
+		if err != nil {
+			return
+		}
+		if names[rule.Name] {
+			return nil, &RuleError{rule.Name, "duplicate name"}
+		}
+		names[rule.Name] = true
+		f, err := rule.scopedFilter()
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, Status{Rule: rule})
+		filters = append(filters, f)
+		var ewma *anomaly.EWMA
+		if rule.Baseline == EWMA {
+			ewma = anomaly.NewEWMA(rule.alpha())
+		}
+		ewmas = append(ewmas, ewma)
+	}
+	return &Engine{
+		ts:         ts,
+		statuses:   statuses,
+		filters:    filters,
+		ewmas:      ewmas,
+		fired:      make([][]time.Time, len(statuses)),
+		clearSince: make([]time.Time, len(statuses)),
+	}, nil
+}
+
+// WatchReader makes the engine's staleness and lag rules watch the progress of
+// `reader`. Staleness and lag rules never fire until it is called.
+func (e *Engine) WatchReader(reader ReaderProgress) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reader = reader
+}
+
+// A measurement is the value of a rule's metric at one evaluation
+type measurement struct {
+	value float64
+	// label is the group with the highest value, for rules with a GroupBy
+	label string
+	// ok is false if there isn't enough data for the rule's condition to hold
+	ok bool
+}
+
+// The inStatusClass function returns whether `status` belongs to `class`,
+// e.g. "503" belongs to "5xx"
+func inStatusClass(status string, class string) bool {
+	if strings.HasSuffix(class, "xx") {
+		return strings.HasPrefix(status, class[:1])
+	}
+	return status == class
+}
+
+// The errorRate function returns the percentage of requests between `start` and `now`
+// in the rule's status class, and whether there were enough requests for it to count
+func (e *Engine) errorRate(rule Rule, f *filter.Filter, start time.Time, now time.Time) (m measurement, err error) {
+	statusCounts, err := e.ts.GetStatusCounts(start, now, f)
+	if err != nil {
+		return
+	}
+	total, errors := 0, 0
+	for _, count := range statusCounts {
+		total += count.Count
+		if inStatusClass(count.Label, rule.StatusClass) {
+			errors += count.Count
+		}
+	}
+	if total == 0 {
+		return
+	}
+	m.value = 100 * float64(errors) / float64(total)
+	m.ok = total >= rule.MinRequests
+	return
+}
+
+// The busiestGroup function returns the traffic of the section or host with the most
+// requests between `start` and `now`. It uses the same queries as the dashboard's
+// section and client breakdowns.
+func (e *Engine) busiestGroup(rule Rule, f *filter.Filter, start time.Time, now time.Time) (m measurement, err error) {
+	var counts []timeseries.Count
+	if rule.GroupBy == "host" {
+		counts, err = e.ts.GetHostCounts(start, now, 1, f)
+	} else {
+		counts, err = e.ts.GetSectionCounts(start, now, f)
+	}
+	if err != nil || len(counts) == 0 {
+		return
+	}
+	// Match GetAverageTraffic, which divides by the window in whole seconds
+	seconds := float64(now.Unix() - start.Unix())
+	return measurement{float64(counts[0].Count) / seconds, counts[0].Label, true}, nil
+}
+
+// The progress function computes a staleness or lag metric at `now` from the newest
+// log line the log reader has read and its position. It doesn't query the time series,
+// since it runs on every evaluation.
+func (e *Engine) progress(rule Rule, now time.Time) (m measurement, err error) {
+	if e.reader == nil {
+		return
+	}
+	newest, ok := e.reader.Newest()
+	// Log lines read before the first evaluation, e.g. from a backlog, don't make
+	// the log file stale straight away
+	if !ok || newest.Before(e.started) {
+		newest = e.started
+	}
+	staleness := now.Sub(newest).Seconds()
+	if staleness < 0 {
+		staleness = 0
+	}
+	if rule.Metric == Staleness {
+		return measurement{staleness, "", true}, nil
+	}
+	lag, err := e.reader.Lag()
+	if err != nil {
+		return
+	}
+	m.ok = true
+	if rule.Metric == LagBytes {
+		m.value = float64(lag)
+	} else if lag > 0 {
+		m.value = staleness
+	}
+	return
+}
+
+// The measure function computes the metric of `rule`, restricted to the scoped
+// filter `f`, over the window ending at `now`
+func (e *Engine) measure(rule Rule, f *filter.Filter, now time.Time) (m measurement, err error) {
+	start := now.Add(-rule.Window)
+	switch {
+	case rule.Metric == Traffic && rule.GroupBy != "":
+		return e.busiestGroup(rule, f, start, now)
+	case rule.Metric == Traffic:
+		m.value, err = e.ts.GetAverageTraffic(start, now, f)
+		m.ok = true
+		return
+	case rule.Metric == Bandwidth:
+		m.value, err = e.ts.GetAverageBandwidth(start, now, f)
+		m.ok = true
+		return
+	case rule.Metric == ErrorRate:
+		return e.errorRate(rule, f, start, now)
+	case progressMetrics[rule.Metric]:
+		return e.progress(rule, now)
+	}
+	return m, &RuleError{rule.Name, fmt.Sprintf("unknown metric %q", rule.Metric)}
+}
+
+// The seasonalBaseline function returns the mean and standard deviation of the
+// rule's metric at the same time of week as `now` in previous weeks. Weeks before the
+// first stored log line are left out, and ok is false if fewer than two weeks remain.
+func (e *Engine) seasonalBaseline(rule Rule, f *filter.Filter, now time.Time) (mean float64, stdDev float64, ok bool, err error) {
+	// The earliest stored log line only needs to be found once
+	if e.first.IsZero() {
+		first, hasData, err := e.ts.GetFirstTimestamp()
+		if err != nil || !hasData {
+			return 0, 0, false, err
+		}
+		e.first = first
+	}
+	samples := make([]float64, 0, rule.periods())
+	for _, at := range anomaly.SeasonalTimes(now, anomaly.Week, rule.periods()) {
+		if at.Add(-rule.Window).Before(e.first) {
+			break
+		}
+		m, err := e.measure(rule, f, at)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if m.ok {
+			samples = append(samples, m.value)
+		}
+	}
+	if len(samples) < 2 {
+		return
+	}
+	mean, stdDev = anomaly.Baseline(samples)
+	return mean, stdDev, true, nil
+}
+
+// The deviation function converts the measurement `m` of the anomaly rule at index
+// `i` into the number of standard deviations from the rule's baseline. An EWMA
+// baseline is updated with `m` after it has been scored, so that it follows the metric.
+func (e *Engine) deviation(i int, m measurement, now time.Time) (deviation measurement, err error) {
+	rule := e.statuses[i].Rule
+	if !m.ok {
+		return
+	}
+	if rule.Baseline == Seasonal {
+		mean, stdDev, ok, err := e.seasonalBaseline(rule, e.filters[i], now)
+		if err != nil || !ok {
+			return deviation, err
+		}
+		return measurement{anomaly.Score(m.value, mean, stdDev), m.label, true}, nil
+	}
+	ewma := e.ewmas[i]
+	deviation = measurement{anomaly.Score(m.value, ewma.Mean(), ewma.StdDev()), m.label, ewma.Count() >= anomaly.DefaultWarmUp}
+	ewma.Update(m.value)
+	return
+}
+
+// The next method returns the state the rule at index `i` moves to at `now` given
+// whether its condition holds
+func (e *Engine) next(i int, holds bool, now time.Time) State {
+	status := e.statuses[i]
+	switch {
+	case holds && status.State == Resolved && now.Sub(status.Since) < status.Rule.MinResolved:
+		return Resolved
+	case holds && (status.State == Inactive || status.State == Resolved):
+		if status.Rule.For == 0 {
+			return Firing
+		}
+		return Pending
+	case holds && status.State == Pending && now.Sub(status.Since) >= status.Rule.For:
+		return Firing
+	case !holds && status.State == Pending:
+		return Inactive
+	case !holds && status.State == Firing:
+		if now.Sub(status.Since) < status.Rule.MinFiring {
+			return Firing
+		}
+		if len(e.fired[i]) > 0 && now.Sub(e.fired[i][0]) < status.Rule.FlapWindow {
+			return Firing
+		}
+		return Resolved
+	}
+	return status.State
+}
+
+// The fire method records that the rule at index `i` fired, or that its condition
+// started to hold again while firing, at `now`. It returns whether that has happened
+// often enough within the rule's flap window for the rule to be flapping.
+func (e *Engine) fire(i int, now time.Time) bool {
+	rule := e.statuses[i].Rule
+	if rule.FlapWindow == 0 {
+		return false
+	}
+	fired := []time.Time{now}
+	for _, at := range e.fired[i] {
+		if now.Sub(at) < rule.FlapWindow {
+			fired = append(fired, at)
+		}
+	}
+	e.fired[i] = fired
+	return len(fired) >= rule.flapCount()
+}
+
+// Evaluate evaluates every rule at `now` and returns the transitions it caused. If
+// a rule's metric can't be computed, its state is left unchanged and the error is
+// returned after the remaining rules have been evaluated.
+func (e *Engine) Evaluate(now time.Time) (transitions []Transition, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.started.IsZero() {
+		e.started = now
+	}
+	for i := range e.statuses {
+		status := &e.statuses[i]
+		m, measureErr := e.measure(status.Rule, e.filters[i], now)
+		if measureErr == nil && status.Rule.Baseline != "" {
+			m, measureErr = e.deviation(i, m, now)
+		}
+		if measureErr != nil {
+			err = measureErr
+			continue
+		}
+		status.Value = m.value
+		status.Label = m.label
+		threshold := status.Rule.Threshold
+		if status.State == Pending || status.State == Firing {
+			threshold = status.Rule.clearThreshold()
+		}
+		holds := m.ok && comparisons[status.Rule.Comparison](m.value, threshold)
+		if holds && status.State == Firing && !e.clearSince[i].IsZero() {
+			status.Flapping = e.fire(i, now)
+		}
+		if holds {
+			e.clearSince[i] = time.Time{}
+		} else if e.clearSince[i].IsZero() {
+			e.clearSince[i] = now
+		}
+		state := e.next(i, holds, now)
+		if state != status.State {
+			transitions = append(transitions, Transition{status.Rule.Name, status.State, state, now, m.value, m.label})
+			switch state {
+			case Firing:
+				status.Flapping = e.fire(i, now)
+			case Resolved:
+				status.Flapping = false
+			}
+			status.State = state
+			status.Since = now
+		}
+	}
+	return
+}
+
+// Statuses returns the status of every rule, in the order the rules were given
+func (e *Engine) Statuses() []Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	statuses := make([]Status, len(e.statuses))
+	copy(statuses, e.statuses)
+	return statuses
+}
@@ -0,0 +1,748 @@
+package alerts
+
+import (
+	"database/sql"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/anomaly"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/timeseries"
+	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+var start = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+func loadTimeSeries(t *testing.T) *timeseries.LogTimeSeries {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(timeseries.CreateLogLinesTableStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &timeseries.LogTimeSeries{db, logFile}
+}
+
+// The hits function returns `n` log lines for `path` at time `at`
+func hits(n int, at time.Time, path string, status uint16) (logLines []timeseries.LogLine) {
+	for i := 0; i < n; i++ {
+		logLines = append(logLines, timeseries.LogLine{
+			Host: "127.0.0.1", Timestamp: at, Path: path, Status: status, ResponseBytes: 100,
+		})
+	}
+	return
+}
+
+// The hostHits function returns `n` successful log lines from `host` for `path` at time `at`
+func hostHits(n int, at time.Time, host string, path string) (logLines []timeseries.LogLine) {
+	for _, logLine := range hits(n, at, path, 200) {
+		logLine.Host = host
+		logLines = append(logLines, logLine)
+	}
+	return
+}
+
+func mustParseFilter(expr string) *filter.Filter {
+	f, err := filter.Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// An evaluation records log lines and then evaluates the engine at `now`
+type evaluation struct {
+	logLines            []timeseries.LogLine
+	now                 time.Time
+	expectedTransitions []Transition
+	expectedStates      []State
+}
+
+// The steady function returns evaluations over `seconds` seconds after `from` that each
+// record `n` log lines and expect `numRules` rules to stay inactive
+func steady(numRules int, n int, from time.Time, seconds int) (evaluations []evaluation) {
+	states := make([]State, numRules)
+	for i := 1; i <= seconds; i++ {
+		at := from.Add(time.Duration(i) * time.Second)
+		evaluations = append(evaluations, evaluation{hits(n, at, "/report", 200), at, nil, states})
+	}
+	return
+}
+
+func TestEvaluate(t *testing.T) {
+	traffic := Rule{Name: "traffic", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second}
+	sustained := Rule{Name: "sustained", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second,
+		For: 20 * time.Second}
+	apiErrors := Rule{Name: "api-errors", Metric: Traffic, Filter: mustParseFilter("section=api and status>=500"),
+		Comparison: ">=", Threshold: 0.4, Window: 10 * time.Second}
+	bandwidth := Rule{Name: "bandwidth", Metric: Bandwidth, Comparison: ">", Threshold: 100, Window: 10 * time.Second}
+	quiet := Rule{Name: "quiet", Metric: Traffic, Comparison: "<", Threshold: 0.1, Window: 10 * time.Second}
+	serverErrors := Rule{Name: "5xx", Metric: ErrorRate, StatusClass: "5xx", Comparison: ">", Threshold: 2,
+		Window: 10 * time.Second, MinRequests: 10}
+	apiTraffic := Rule{Name: "api", Metric: Traffic, Section: "api", Comparison: ">", Threshold: 1,
+		Window: 10 * time.Second}
+	loginPerHost := Rule{Name: "login", Metric: Traffic, PathPrefix: "/login", GroupBy: "host", Comparison: ">",
+		Threshold: 0.5, Window: 10 * time.Second}
+	busiestSection := Rule{Name: "busiest", Metric: Traffic, GroupBy: "section", Comparison: ">", Threshold: 1,
+		Window: 10 * time.Second}
+	notFound := Rule{Name: "404", Metric: ErrorRate, StatusClass: "404", Comparison: ">=", Threshold: 50,
+		Window: 10 * time.Second}
+	spike := Rule{Name: "spike", Metric: Traffic, Baseline: EWMA, Comparison: ">", Threshold: 3,
+		Window: 10 * time.Second}
+	drop := Rule{Name: "drop", Metric: Traffic, Baseline: EWMA, Comparison: "<", Threshold: -3,
+		Window: 10 * time.Second}
+	seasonal := Rule{Name: "seasonal", Metric: Traffic, Baseline: Seasonal, Comparison: ">", Threshold: 3,
+		Window: 10 * time.Second}
+	clearAt := 0.5
+	hysteresis := Rule{Name: "hysteresis", Metric: Traffic, Comparison: ">", Threshold: 1, ClearThreshold: &clearAt,
+		Window: 10 * time.Second}
+	minFiring := Rule{Name: "min-firing", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second,
+		MinFiring: 30 * time.Second}
+	minResolved := Rule{Name: "min-resolved", Metric: Traffic, Comparison: ">", Threshold: 1,
+		Window: 10 * time.Second, MinResolved: 30 * time.Second}
+	flapping := Rule{Name: "flapping", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second,
+		FlapWindow: time.Minute}
+	// A synthetic history of 10, 12, 8 and 10 requests/second over the window at the
+	// same time in each of the previous four weeks, after a single older request
+	now := start.Add(5 * anomaly.Week)
+	history := hits(1, start, "/report", 200)
+	for week, n := range []int{100, 120, 80, 100} {
+		history = append(history, hits(n, now.Add(-time.Duration(week+1)*anomaly.Week), "/report", 200)...)
+	}
+
+	testCases := []struct {
+		rules       []Rule
+		evaluations []evaluation
+	}{
+		{
+			// A rule without a for-duration fires as soon as its condition holds
+			[]Rule{traffic},
+			[]evaluation{
+				{hits(5, start, "/report", 200), start.Add(5 * time.Second), nil, []State{Inactive}},
+				{hits(10, start.Add(6*time.Second), "/report", 200), start.Add(7 * time.Second),
+					[]Transition{{"traffic", Inactive, Firing, start.Add(7 * time.Second), 1.5, ""}},
+					[]State{Firing}},
+				{nil, start.Add(8 * time.Second), nil, []State{Firing}},
+				{nil, start.Add(20 * time.Second),
+					[]Transition{{"traffic", Firing, Resolved, start.Add(20 * time.Second), 0, ""}},
+					[]State{Resolved}},
+				{nil, start.Add(30 * time.Second), nil, []State{Resolved}},
+			},
+		},
+		{
+			// A rule with a for-duration is pending until its condition has held long enough
+			[]Rule{sustained},
+			[]evaluation{
+				{hits(20, start, "/report", 200), start.Add(5 * time.Second),
+					[]Transition{{"sustained", Inactive, Pending, start.Add(5 * time.Second), 2, ""}},
+					[]State{Pending}},
+				// The condition stops holding before the for-duration elapses
+				{nil, start.Add(15 * time.Second),
+					[]Transition{{"sustained", Pending, Inactive, start.Add(15 * time.Second), 0, ""}},
+					[]State{Inactive}},
+				{hits(20, start.Add(20*time.Second), "/report", 200), start.Add(20 * time.Second),
+					[]Transition{{"sustained", Inactive, Pending, start.Add(20 * time.Second), 2, ""}},
+					[]State{Pending}},
+				{hits(20, start.Add(30*time.Second), "/report", 200), start.Add(30 * time.Second), nil,
+					[]State{Pending}},
+				{hits(20, start.Add(40*time.Second), "/report", 200), start.Add(40 * time.Second),
+					[]Transition{{"sustained", Pending, Firing, start.Add(40 * time.Second), 4, ""}},
+					[]State{Firing}},
+			},
+		},
+		{
+			// Rules are evaluated independently, with their own filters and metrics
+			[]Rule{traffic, apiErrors, bandwidth, quiet},
+			[]evaluation{
+				{nil, start,
+					[]Transition{{"quiet", Inactive, Firing, start, 0, ""}},
+					[]State{Inactive, Inactive, Inactive, Firing}},
+				{append(hits(4, start, "/api/user", 500), hits(4, start, "/report", 200)...), start.Add(5 * time.Second),
+					[]Transition{
+						{"api-errors", Inactive, Firing, start.Add(5 * time.Second), 0.4, ""},
+						{"quiet", Firing, Resolved, start.Add(5 * time.Second), 0.8, ""},
+					},
+					[]State{Inactive, Firing, Inactive, Resolved}},
+				{hits(10, start.Add(6*time.Second), "/report", 200), start.Add(6 * time.Second),
+					[]Transition{
+						{"traffic", Inactive, Firing, start.Add(6 * time.Second), 1.8, ""},
+						{"bandwidth", Inactive, Firing, start.Add(6 * time.Second), 180, ""},
+					},
+					[]State{Firing, Firing, Firing, Resolved}},
+			},
+		},
+		{
+			// Error rate rules need a minimum number of requests in the window
+			[]Rule{serverErrors, notFound},
+			[]evaluation{
+				{nil, start, nil, []State{Inactive, Inactive}},
+				// A single error is 100% of the responses, but there are too few requests
+				{hits(1, start, "/report", 503), start.Add(time.Second), nil, []State{Inactive, Inactive}},
+				{append(hits(8, start.Add(2*time.Second), "/report", 200), hits(1, start.Add(2*time.Second), "/missing", 404)...),
+					start.Add(2 * time.Second),
+					[]Transition{{"5xx", Inactive, Firing, start.Add(2 * time.Second), 10, ""}},
+					[]State{Firing, Inactive}},
+				{append(hits(10, start.Add(5*time.Second), "/missing", 404), hits(40, start.Add(5*time.Second), "/report", 200)...),
+					start.Add(5 * time.Second),
+					[]Transition{{"5xx", Firing, Resolved, start.Add(5 * time.Second), 1.6666666666666667, ""}},
+					[]State{Resolved, Inactive}},
+				{hits(61, start.Add(12*time.Second), "/missing", 404), start.Add(12 * time.Second),
+					[]Transition{{"404", Inactive, Firing, start.Add(12 * time.Second), 60, ""}},
+					[]State{Resolved, Firing}},
+			},
+		},
+		{
+			// Rules can be scoped to a section or path prefix, and evaluated per section or host
+			[]Rule{apiTraffic, loginPerHost, busiestSection},
+			[]evaluation{
+				{append(hits(8, start, "/api/user", 200), hits(8, start, "/report", 200)...), start.Add(time.Second),
+					nil, []State{Inactive, Inactive, Inactive}},
+				{append(hits(4, start.Add(2*time.Second), "/api/user", 200), hits(3, start, "/login/form", 200)...),
+					start.Add(2 * time.Second),
+					[]Transition{
+						{"api", Inactive, Firing, start.Add(2 * time.Second), 1.2, ""},
+						{"busiest", Inactive, Firing, start.Add(2 * time.Second), 1.2, "api"},
+					},
+					[]State{Firing, Inactive, Firing}},
+				// Only the requests under /login count towards the login rule
+				{append(hostHits(6, start.Add(3*time.Second), "10.0.0.2", "/login"),
+					hostHits(20, start.Add(3*time.Second), "10.0.0.3", "/report")...),
+					start.Add(3 * time.Second),
+					[]Transition{{"login", Inactive, Firing, start.Add(3 * time.Second), 0.6, "10.0.0.2"}},
+					[]State{Firing, Firing, Firing}},
+			},
+		},
+		{
+			// An EWMA baseline fires on a spike in steady traffic, once it has warmed up
+			[]Rule{spike, drop},
+			append(steady(2, 10, start, 40),
+				evaluation{hits(100, start.Add(41*time.Second), "/report", 200), start.Add(41 * time.Second),
+					[]Transition{{"spike", Inactive, Firing, start.Add(41 * time.Second), 6.234786262240269, ""}},
+					[]State{Firing, Inactive}}),
+		},
+		{
+			// A spike during the warm-up doesn't fire
+			[]Rule{spike},
+			append(steady(1, 10, start, 5),
+				evaluation{hits(100, start.Add(6*time.Second), "/report", 200), start.Add(6 * time.Second),
+					nil, []State{Inactive}}),
+		},
+		{
+			// An EWMA baseline fires when steady traffic stops
+			[]Rule{drop},
+			append(steady(1, 10, start, 40),
+				evaluation{nil, start.Add(55 * time.Second),
+					[]Transition{{"drop", Inactive, Firing, start.Add(55 * time.Second), -7.207898511808419, ""}},
+					[]State{Firing}}),
+		},
+		{
+			// A seasonal baseline compares traffic with the same time in previous weeks
+			[]Rule{seasonal},
+			[]evaluation{
+				// 11 requests/second is within the usual range
+				{append(history, hits(110, now, "/report", 200)...), now, nil, []State{Inactive}},
+				// 17 requests/second is (17 - 10) / sqrt(2) standard deviations above the mean
+				{hits(60, now.Add(time.Second), "/report", 200), now.Add(time.Second),
+					[]Transition{{"seasonal", Inactive, Firing, now.Add(time.Second), 4.949747468305833, ""}},
+					[]State{Firing}},
+			},
+		},
+		{
+			// A rule with a clear threshold keeps firing until its metric falls below it, and
+			// only fires again once its metric rises above the threshold
+			[]Rule{hysteresis},
+			[]evaluation{
+				{hits(15, start, "/report", 200), start.Add(time.Second),
+					[]Transition{{"hysteresis", Inactive, Firing, start.Add(time.Second), 1.5, ""}},
+					[]State{Firing}},
+				{hits(8, start.Add(11*time.Second), "/report", 200), start.Add(11 * time.Second),
+					nil, []State{Firing}},
+				{nil, start.Add(25 * time.Second),
+					[]Transition{{"hysteresis", Firing, Resolved, start.Add(25 * time.Second), 0, ""}},
+					[]State{Resolved}},
+				{hits(8, start.Add(26*time.Second), "/report", 200), start.Add(26 * time.Second),
+					nil, []State{Resolved}},
+			},
+		},
+		{
+			// A rule with a minimum firing time stays firing after its condition stops holding
+			[]Rule{minFiring},
+			[]evaluation{
+				{hits(15, start, "/report", 200), start.Add(time.Second),
+					[]Transition{{"min-firing", Inactive, Firing, start.Add(time.Second), 1.5, ""}},
+					[]State{Firing}},
+				{nil, start.Add(20 * time.Second), nil, []State{Firing}},
+				{nil, start.Add(31 * time.Second),
+					[]Transition{{"min-firing", Firing, Resolved, start.Add(31 * time.Second), 0, ""}},
+					[]State{Resolved}},
+			},
+		},
+		{
+			// A rule with a minimum resolved time can't fire again straight away
+			[]Rule{minResolved},
+			[]evaluation{
+				{hits(15, start, "/report", 200), start.Add(time.Second),
+					[]Transition{{"min-resolved", Inactive, Firing, start.Add(time.Second), 1.5, ""}},
+					[]State{Firing}},
+				{nil, start.Add(15 * time.Second),
+					[]Transition{{"min-resolved", Firing, Resolved, start.Add(15 * time.Second), 0, ""}},
+					[]State{Resolved}},
+				{hits(15, start.Add(20*time.Second), "/report", 200), start.Add(20 * time.Second),
+					nil, []State{Resolved}},
+				{hits(15, start.Add(45*time.Second), "/report", 200), start.Add(45 * time.Second),
+					[]Transition{{"min-resolved", Resolved, Firing, start.Add(45 * time.Second), 1.5, ""}},
+					[]State{Firing}},
+			},
+		},
+		{
+			// A rule with a flap window stays firing until the flap window has passed since
+			// its condition last started to hold, so its flapping is a single incident
+			[]Rule{flapping},
+			[]evaluation{
+				{hits(15, start, "/report", 200), start.Add(time.Second),
+					[]Transition{{"flapping", Inactive, Firing, start.Add(time.Second), 1.5, ""}},
+					[]State{Firing}},
+				{nil, start.Add(15 * time.Second), nil, []State{Firing}},
+				{hits(15, start.Add(20*time.Second), "/report", 200), start.Add(20 * time.Second),
+					nil, []State{Firing}},
+				{nil, start.Add(35 * time.Second), nil, []State{Firing}},
+				{hits(15, start.Add(40*time.Second), "/report", 200), start.Add(40 * time.Second),
+					nil, []State{Firing}},
+				{nil, start.Add(55 * time.Second), nil, []State{Firing}},
+				{nil, start.Add(99 * time.Second), nil, []State{Firing}},
+				{nil, start.Add(100 * time.Second),
+					[]Transition{{"flapping", Firing, Resolved, start.Add(100 * time.Second), 0, ""}},
+					[]State{Resolved}},
+			},
+		},
+		{
+			// A seasonal baseline needs at least two weeks of history
+			[]Rule{seasonal},
+			[]evaluation{
+				{append(hits(100, now.Add(-anomaly.Week), "/report", 200), hits(1000, now, "/report", 200)...), now,
+					nil, []State{Inactive}},
+			},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			ts := loadTimeSeries(t)
+			defer ts.DB.Close()
+			engine, err := NewEngine(ts, testCase.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for evalIdx, eval := range testCase.evaluations {
+				for _, logLine := range eval.logLines {
+					ts.Record(logLine)
+				}
+				transitions, err := engine.Evaluate(eval.now)
+				if err != nil {
+					t.Error(err)
+				}
+				if !cmp.Equal(eval.expectedTransitions, transitions) {
+					t.Errorf("Error on test case %d, evaluation %d.\nExpected transitions: %v\nActual: %v",
+						caseIdx, evalIdx, eval.expectedTransitions, transitions)
+				}
+				states := make([]State, 0)
+				for _, status := range engine.Statuses() {
+					states = append(states, status.State)
+				}
+				if !cmp.Equal(eval.expectedStates, states) {
+					t.Errorf("Error on test case %d, evaluation %d.\nExpected states: %v\nActual: %v",
+						caseIdx, evalIdx, eval.expectedStates, states)
+				}
+			}
+		}()
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	rule := Rule{Name: "flapping", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second,
+		FlapWindow: time.Minute, FlapCount: 3}
+	engine, err := NewEngine(ts, []Rule{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The condition holds at 0s, 20s, 40s and 60s and stops holding 14s after each. The
+	// rule flaps when its condition starts to hold for the third time at 40s, and stays
+	// firing until a minute after it last started to hold
+	expected := map[int]bool{0: false, 14: false, 20: false, 34: false, 40: true, 54: true, 60: true, 74: true,
+		119: true, 120: false}
+	var transitions []Transition
+	for _, second := range []int{0, 14, 20, 34, 40, 54, 60, 74, 119, 120} {
+		at := start.Add(time.Duration(second) * time.Second)
+		if second%20 == 0 && second <= 60 {
+			for _, logLine := range hits(15, at, "/report", 200) {
+				ts.Record(logLine)
+			}
+		}
+		evaluated, err := engine.Evaluate(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transitions = append(transitions, evaluated...)
+		if flapping := engine.Statuses()[0].Flapping; flapping != expected[second] {
+			t.Errorf("Error at %ds.\nExpected flapping: %v\nActual: %v", second, expected[second], flapping)
+		}
+	}
+	// The flapping is recorded as a single incident
+	expectedTransitions := []Transition{
+		{"flapping", Inactive, Firing, start, 1.5, ""},
+		{"flapping", Firing, Resolved, start.Add(120 * time.Second), 0, ""},
+	}
+	if !cmp.Equal(expectedTransitions, transitions) {
+		t.Errorf("Expected: %v\nActual: %v", expectedTransitions, transitions)
+	}
+}
+
+func TestFlapWindowSingleFire(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	rule := Rule{Name: "flap-window", Metric: Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second,
+		FlapWindow: time.Minute}
+	engine, err := NewEngine(ts, []Rule{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, logLine := range hits(15, start, "/report", 200) {
+		ts.Record(logLine)
+	}
+	// The condition holds at 0s only. A rule that fires once stays firing until a
+	// minute after it fired, without being marked as flapping.
+	expectedStates := map[int]State{0: Firing, 14: Firing, 59: Firing, 60: Resolved}
+	var transitions []Transition
+	for _, second := range []int{0, 14, 59, 60} {
+		evaluated, err := engine.Evaluate(start.Add(time.Duration(second) * time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		transitions = append(transitions, evaluated...)
+		status := engine.Statuses()[0]
+		if status.State != expectedStates[second] || status.Flapping {
+			t.Errorf("Error at %ds.\nExpected: %v, not flapping\nActual: %v, flapping: %v",
+				second, expectedStates[second], status.State, status.Flapping)
+		}
+	}
+	expectedTransitions := []Transition{
+		{Rule: "flap-window", From: Inactive, To: Firing, Time: start, Value: 1.5},
+		{Rule: "flap-window", From: Firing, To: Resolved, Time: start.Add(time.Minute)},
+	}
+	if !cmp.Equal(expectedTransitions, transitions) {
+		t.Errorf("Expected: %v\nActual: %v", expectedTransitions, transitions)
+	}
+}
+
+// A fakeReader is a ReaderProgress with a fixed lag and newest log line
+type fakeReader struct {
+	lag    int64
+	newest time.Time
+}
+
+func (r *fakeReader) Lag() (int64, error) {
+	return r.lag, nil
+}
+
+func (r *fakeReader) Newest() (time.Time, bool) {
+	return r.newest, !r.newest.IsZero()
+}
+
+func TestProgress(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	rules := []Rule{
+		{Name: "stale", Metric: Staleness, Comparison: ">", Threshold: 30},
+		{Name: "lag-bytes", Metric: LagBytes, Comparison: ">", Threshold: 1000},
+		{Name: "lag-seconds", Metric: LagSeconds, Comparison: ">", Threshold: 30},
+	}
+	engine, err := NewEngine(ts, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &fakeReader{}
+	testCases := []struct {
+		logLines       []timeseries.LogLine
+		lag            int64
+		watch          bool
+		now            time.Time
+		expectedValues []float64
+		expectedStates []State
+	}{
+		// Log lines from before the first evaluation don't count, and staleness and lag
+		// rules don't hold until the engine watches a reader
+		{hits(1, start.Add(-time.Hour), "/report", 200), 5000, false, start,
+			[]float64{0, 0, 0}, []State{Inactive, Inactive, Inactive}},
+		{hits(1, start.Add(10*time.Second), "/report", 200), 5000, true, start.Add(20 * time.Second),
+			[]float64{10, 5000, 10}, []State{Inactive, Firing, Inactive}},
+		{nil, 5000, true, start.Add(50 * time.Second),
+			[]float64{40, 5000, 40}, []State{Firing, Firing, Firing}},
+		// Once the reader catches up it is no longer behind, however old the newest line
+		{nil, 0, true, start.Add(55 * time.Second),
+			[]float64{45, 0, 0}, []State{Firing, Resolved, Resolved}},
+		{hits(1, start.Add(60*time.Second), "/report", 200), 0, true, start.Add(60 * time.Second),
+			[]float64{0, 0, 0}, []State{Resolved, Resolved, Resolved}},
+	}
+	for caseIdx, testCase := range testCases {
+		for _, logLine := range testCase.logLines {
+			ts.Record(logLine)
+			if logLine.Timestamp.After(reader.newest) {
+				reader.newest = logLine.Timestamp
+			}
+		}
+		reader.lag = testCase.lag
+		if testCase.watch {
+			engine.WatchReader(reader)
+		}
+		_, err := engine.Evaluate(testCase.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, states := make([]float64, 0), make([]State, 0)
+		for _, status := range engine.Statuses() {
+			values = append(values, status.Value)
+			states = append(states, status.State)
+		}
+		if !cmp.Equal(testCase.expectedValues, values) || !cmp.Equal(testCase.expectedStates, states) {
+			t.Errorf("Error on test case %d.\nExpected: %v %v\nActual: %v %v",
+				caseIdx, testCase.expectedValues, testCase.expectedStates, values, states)
+		}
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	testCases := []struct {
+		rules         []Rule
+		expectedError string
+	}{
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second}},
+			"",
+		},
+		{
+			[]Rule{
+				{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second},
+				{Name: "traffic", Metric: Bandwidth, Comparison: ">", Window: time.Second},
+			},
+			`Invalid alert rule "traffic": duplicate name`,
+		},
+		{
+			[]Rule{{Metric: Traffic, Comparison: ">", Window: time.Second}},
+			`Invalid alert rule "": name is required`,
+		},
+		{
+			[]Rule{{Name: "errors", Metric: "errors", Comparison: ">", Window: time.Second}},
+			`Invalid alert rule "errors": unknown metric "errors"`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: "!=", Window: time.Second}},
+			`Invalid alert rule "traffic": unknown comparison "!="`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">"}},
+			`Invalid alert rule "traffic": window must be at least one second`,
+		},
+		{
+			[]Rule{{Name: "login", Metric: Traffic, Comparison: ">", Window: time.Second, PathPrefix: "login"}},
+			`Invalid alert rule "login": path prefix "login" must start with /`,
+		},
+		{
+			[]Rule{{Name: "bandwidth", Metric: Bandwidth, Comparison: ">", Window: time.Second, GroupBy: "host"}},
+			`Invalid alert rule "bandwidth": groupBy is only supported for traffic rules`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, GroupBy: "path"}},
+			`Invalid alert rule "traffic": unknown groupBy "path": expected section or host`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, Baseline: "median"}},
+			`Invalid alert rule "traffic": unknown baseline "median": expected ewma or seasonal`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, Baseline: EWMA,
+				GroupBy: "host"}},
+			`Invalid alert rule "traffic": groupBy is not supported for anomaly rules`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, Baseline: EWMA, Alpha: 1}},
+			`Invalid alert rule "traffic": alpha must be at least 0 and less than 1`,
+		},
+		{
+			[]Rule{{Name: "stale", Metric: Staleness, Comparison: ">", Threshold: 60}},
+			"",
+		},
+		{
+			[]Rule{{Name: "lag", Metric: LagBytes, Comparison: ">", Threshold: 1000, Section: "api"}},
+			`Invalid alert rule "lag": filters and baselines are not supported for lag_bytes rules`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Threshold: 10, Window: time.Second,
+				ClearThreshold: new(float64)}},
+			"",
+		},
+		{
+			[]Rule{{Name: "quiet", Metric: Traffic, Comparison: "<", Threshold: 1, Window: time.Second,
+				ClearThreshold: new(float64)}},
+			`Invalid alert rule "quiet": clear threshold must not be below the threshold`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, MinFiring: -time.Second}},
+			`Invalid alert rule "traffic": minFiring, minResolved and flapWindow must not be negative`,
+		},
+		{
+			[]Rule{{Name: "traffic", Metric: Traffic, Comparison: ">", Window: time.Second, FlapCount: 1}},
+			`Invalid alert rule "traffic": flapCount must be at least 2`,
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		_, err := NewEngine(nil, testCase.rules)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != testCase.expectedError {
+			t.Errorf("Error on test case %d.\nExpected error: %q\nActual: %q", caseIdx, testCase.expectedError, actual)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	clearAt := 8.0
+	testCases := []struct {
+		input         string
+		expectedRules []Rule
+		expectedError string
+	}{
+		{
+			`[{"name": "api-errors", "metric": "traffic", "filter": "section=api and status>=500",
+			   "comparison": ">=", "threshold": 1, "window": "1m", "for": "30s"},
+			  {"name": "bandwidth", "metric": "bandwidth", "threshold": 1000, "window": "2m"}]`,
+			[]Rule{
+				{Name: "api-errors", Metric: Traffic, Filter: mustParseFilter("section=api and status>=500"),
+					Comparison: ">=", Threshold: 1, Window: time.Minute, For: 30 * time.Second},
+				{Name: "bandwidth", Metric: Bandwidth, Comparison: ">", Threshold: 1000, Window: 2 * time.Minute},
+			},
+			"",
+		},
+		{
+			`[{"name": "errors", "metric": "error_rate", "statusClass": "5xx", "minRequests": 20,
+			   "threshold": 2, "window": "1m", "for": "1m"}]`,
+			[]Rule{
+				{Name: "errors", Metric: ErrorRate, Comparison: ">", Threshold: 2, Window: time.Minute,
+					For: time.Minute, StatusClass: "5xx", MinRequests: 20},
+			},
+			"",
+		},
+		{
+			`[{"name": "anomaly", "metric": "traffic", "baseline": "seasonal", "periods": 8,
+			   "threshold": 3, "window": "5m"}]`,
+			[]Rule{
+				{Name: "anomaly", Metric: Traffic, Comparison: ">", Threshold: 3, Window: 5 * time.Minute,
+					Baseline: Seasonal, Periods: 8},
+			},
+			"",
+		},
+		{
+			`[{"name": "flappy", "metric": "traffic", "threshold": 10, "clearThreshold": 8, "window": "1m",
+			   "minFiring": "5m", "minResolved": "1m", "flapWindow": "30m", "flapCount": 3}]`,
+			[]Rule{
+				{Name: "flappy", Metric: Traffic, Comparison: ">", Threshold: 10, ClearThreshold: &clearAt,
+					Window: time.Minute, MinFiring: 5 * time.Minute, MinResolved: time.Minute,
+					FlapWindow: 30 * time.Minute, FlapCount: 3},
+			},
+			"",
+		},
+		{
+			`[{"name": "stale", "metric": "staleness", "threshold": 60},
+			  {"name": "lag", "metric": "lag_seconds", "threshold": 30, "for": "1m"}]`,
+			[]Rule{
+				{Name: "stale", Metric: Staleness, Comparison: ">", Threshold: 60},
+				{Name: "lag", Metric: LagSeconds, Comparison: ">", Threshold: 30, For: time.Minute},
+			},
+			"",
+		},
+		{
+			`[{"name": "traffic", "metric": "traffic", "threshold": 1, "window": "1m", "flapWindow": "often"}]`,
+			nil,
+			`Invalid alert rule "traffic": invalid flapWindow "often"`,
+		},
+		{
+			`[{"name": "errors", "metric": "error_rate", "threshold": 2, "window": "1m"}]`,
+			nil,
+			`Invalid alert rule "errors": invalid status class "": expected e.g. 5xx or 503`,
+		},
+		{
+			`[{"name": "traffic", "metric": "traffic", "threshold": 1, "window": "soon"}]`,
+			nil,
+			`Invalid alert rule "traffic": invalid window "soon"`,
+		},
+		{
+			`[{"name": "traffic", "metric": "traffic", "filter": "colour=red", "window": "1m"}]`,
+			nil,
+			`Invalid alert rule "traffic": Invalid filter at position 0: unknown field "colour"`,
+		},
+		{
+			`[{"name": "traffic", "metric": "traffic", "window": "1m", "severity": "page"}]`,
+			nil,
+			`Invalid alert rules: json: unknown field "severity"`,
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		rules, err := ParseRules(strings.NewReader(testCase.input))
+		actualError := ""
+		if err != nil {
+			actualError = err.Error()
+		}
+		if actualError != testCase.expectedError {
+			t.Errorf("Error on test case %d.\nExpected error: %q\nActual: %q",
+				caseIdx, testCase.expectedError, actualError)
+		}
+		if !cmp.Equal(testCase.expectedRules, rules, cmp.AllowUnexported(filter.Filter{})) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v", caseIdx, testCase.expectedRules, rules)
+		}
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	clearAt := 8.0
+	testCases := []struct {
+		rule     Rule
+		expected string
+	}{
+		{
+			Rule{Name: "api-errors", Metric: Traffic, Filter: mustParseFilter("status>=500"),
+				Comparison: ">", Threshold: 1.5, Window: time.Minute, For: 30 * time.Second},
+			"traffic > 1.5 requests/second over 1m0s matching status>=500 for 30s",
+		},
+		{
+			Rule{Name: "errors", Metric: ErrorRate, StatusClass: "5xx", Comparison: ">", Threshold: 2,
+				Window: time.Minute, MinRequests: 20},
+			"5xx error_rate > 2 percent of requests over 1m0s with at least 20 requests",
+		},
+		{
+			Rule{Name: "anomaly", Metric: Traffic, Section: "api", Baseline: Seasonal, Comparison: ">",
+				Threshold: 3, Window: 5 * time.Minute},
+			"traffic over 5m0s > 3 standard deviations from its seasonal baseline in section api",
+		},
+		{
+			Rule{Name: "traffic", Metric: Traffic, Comparison: ">", Threshold: 10, ClearThreshold: &clearAt,
+				Window: time.Minute, For: time.Minute},
+			"traffic > 10 requests/second over 1m0s for 1m0s, clearing below 8",
+		},
+		{
+			Rule{Name: "stale", Metric: Staleness, Comparison: ">", Threshold: 60, For: time.Minute},
+			"staleness > 60 seconds without log lines for 1m0s",
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := testCase.rule.String(); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expected, actual)
+		}
+	}
+}
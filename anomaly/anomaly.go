@@ -0,0 +1,112 @@
+/*
+Package anomaly computes baselines for a metric and scores how far a new value deviates
+from them.
+
+Two kinds of baseline are supported. An EWMA tracks an exponentially weighted moving
+mean and variance of a series as values arrive, so it adapts to gradual changes in
+traffic. A seasonal baseline is the mean and standard deviation of the values observed
+at the same time in previous periods, e.g. at the same hour on the same day of the week,
+so it expects a busy Monday morning to be busy.
+
+Deviations are scored as the number of standard deviations between a value and its
+baseline's mean.
+*/
+package anomaly
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultAlpha is the default smoothing factor of an EWMA. Each new value contributes
+// this fraction of the new mean.
+const DefaultAlpha = 0.1
+
+// DefaultWarmUp is the default number of values an EWMA needs before its baseline
+// is meaningful
+const DefaultWarmUp = 30
+
+// Week is the period of a day-of-week/hour seasonal baseline
+const Week = 7 * 24 * time.Hour
+
+// DefaultPeriods is the default number of previous periods in a seasonal baseline
+const DefaultPeriods = 4
+
+// minRelativeStdDev and minStdDev floor the standard deviation used for scoring, so
+// that a baseline that has been perfectly flat doesn't make every small change an
+// extreme deviation
+const minRelativeStdDev = 0.1
+const minStdDev = 0.01
+
+// An EWMA is an exponentially weighted moving mean and variance. It should be
+// instantiated via anomaly.NewEWMA().
+type EWMA struct {
+	alpha    float64
+	mean     float64
+	variance float64
+	count    int
+}
+
+// NewEWMA returns an empty EWMA with the smoothing factor `alpha`, between 0 and 1
+func NewEWMA(alpha float64) *EWMA {
+	return &EWMA{alpha: alpha}
+}
+
+// Update adds `value` to the moving mean and variance
+func (e *EWMA) Update(value float64) {
+	e.count++
+	if e.count == 1 {
+		e.mean = value
+		return
+	}
+	diff := value - e.mean
+	increment := e.alpha * diff
+	e.mean += increment
+	e.variance = (1 - e.alpha) * (e.variance + diff*increment)
+}
+
+// Mean returns the moving mean
+func (e *EWMA) Mean() float64 {
+	return e.mean
+}
+
+// StdDev returns the moving standard deviation
+func (e *EWMA) StdDev() float64 {
+	return math.Sqrt(e.variance)
+}
+
+// Count returns the number of values added to the EWMA
+func (e *EWMA) Count() int {
+	return e.count
+}
+
+// Baseline returns the mean and population standard deviation of `samples`
+func Baseline(samples []float64) (mean float64, stdDev float64) {
+	if len(samples) == 0 {
+		return
+	}
+	for _, sample := range samples {
+		mean += sample
+	}
+	mean /= float64(len(samples))
+	for _, sample := range samples {
+		stdDev += (sample - mean) * (sample - mean)
+	}
+	stdDev = math.Sqrt(stdDev / float64(len(samples)))
+	return
+}
+
+// SeasonalTimes returns the times `periods` whole periods before `now`, most recent first
+func SeasonalTimes(now time.Time, period time.Duration, periods int) (times []time.Time) {
+	for i := 1; i <= periods; i++ {
+		times = append(times, now.Add(-time.Duration(i)*period))
+	}
+	return
+}
+
+// Score returns the number of standard deviations between `value` and `mean`, which
+// is positive if `value` is above the mean and negative if it is below
+func Score(value float64, mean float64, stdDev float64) float64 {
+	floor := math.Max(minRelativeStdDev*math.Abs(mean), minStdDev)
+	return (value - mean) / math.Max(stdDev, floor)
+}
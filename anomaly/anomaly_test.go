@@ -0,0 +1,115 @@
+package anomaly
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"math"
+	"testing"
+	"time"
+)
+
+var approx = cmpopts.EquateApprox(0, 1e-9)
+
+func TestEWMA(t *testing.T) {
+	testCases := []struct {
+		alpha          float64
+		series         []float64
+		expectedMean   float64
+		expectedStdDev float64
+	}{
+		{0.1, []float64{}, 0, 0},
+		{0.1, []float64{5}, 5, 0},
+		{0.1, []float64{5, 5, 5, 5}, 5, 0},
+		// mean = 0 + 0.5 * 10, variance = 0.5 * (0 + 10 * 5)
+		{0.5, []float64{0, 10}, 5, 5},
+		// variance = 0.5 * (25 + -5 * -2.5) = 18.75
+		{0.5, []float64{0, 10, 0}, 2.5, math.Sqrt(18.75)},
+	}
+	for caseIdx, testCase := range testCases {
+		ewma := NewEWMA(testCase.alpha)
+		for _, value := range testCase.series {
+			ewma.Update(value)
+		}
+		if ewma.Count() != len(testCase.series) {
+			t.Errorf("Error on test case %d. Expected count %d, got %d", caseIdx, len(testCase.series), ewma.Count())
+		}
+		actual := []float64{ewma.Mean(), ewma.StdDev()}
+		expected := []float64{testCase.expectedMean, testCase.expectedStdDev}
+		if !cmp.Equal(expected, actual, approx) {
+			t.Errorf("Error on test case %d.\nExpected mean and standard deviation: %v\nActual: %v",
+				caseIdx, expected, actual)
+		}
+	}
+}
+
+func TestEWMAScoresSpike(t *testing.T) {
+	// A synthetic series alternating between 9 and 11 requests/second,
+	// followed by a spike and then by a value within the usual range
+	ewma := NewEWMA(DefaultAlpha)
+	for i := 0; i < 200; i++ {
+		ewma.Update(10 + float64(i%2*2-1))
+	}
+	if score := Score(11, ewma.Mean(), ewma.StdDev()); math.Abs(score) > 1.5 {
+		t.Errorf("Expected a usual value to score within 1.5 standard deviations, got %v", score)
+	}
+	if score := Score(20, ewma.Mean(), ewma.StdDev()); score < 5 {
+		t.Errorf("Expected a spike to score over 5 standard deviations, got %v", score)
+	}
+	if score := Score(0, ewma.Mean(), ewma.StdDev()); score > -5 {
+		t.Errorf("Expected a drop to score under -5 standard deviations, got %v", score)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	testCases := []struct {
+		samples        []float64
+		expectedMean   float64
+		expectedStdDev float64
+	}{
+		{nil, 0, 0},
+		{[]float64{4}, 4, 0},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+	for caseIdx, testCase := range testCases {
+		mean, stdDev := Baseline(testCase.samples)
+		actual := []float64{mean, stdDev}
+		expected := []float64{testCase.expectedMean, testCase.expectedStdDev}
+		if !cmp.Equal(expected, actual, approx) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, expected, actual)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		value    float64
+		mean     float64
+		stdDev   float64
+		expected float64
+	}{
+		{13, 10, 1, 3},
+		{7, 10, 1, -3},
+		{10, 10, 0, 0},
+		// The standard deviation is floored at 10% of the mean...
+		{12, 10, 0, 2},
+		// ...or 0.01 if the mean is 0
+		{0.05, 0, 0, 5},
+	}
+	for caseIdx, testCase := range testCases {
+		actual := Score(testCase.value, testCase.mean, testCase.stdDev)
+		if !cmp.Equal(testCase.expected, actual, approx) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestSeasonalTimes(t *testing.T) {
+	now := time.Date(2018, 5, 21, 9, 30, 0, 0, time.UTC)
+	expected := []time.Time{
+		time.Date(2018, 5, 14, 9, 30, 0, 0, time.UTC),
+		time.Date(2018, 5, 7, 9, 30, 0, 0, time.UTC),
+	}
+	if actual := SeasonalTimes(now, Week, 2); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Package api serves the data shown on the logr dashboard as a JSON API over HTTP.
+
+Every endpoint except /api/alert accepts `start` and `end` query parameters, given as
+RFC 3339 timestamps or Unix times in seconds, and an optional `filter` expression. If
+`end` is omitted it defaults to the current time, and if `start` is omitted it defaults
+to DefaultWindow before `end`.
+
+	GET /api/sections         counts of log lines by section
+	GET /api/statuses         counts of log lines by response status
+	GET /api/hosts?limit=N    the N most active remote hosts
+	GET /api/traffic?granularity=N
+	                          hits and bytes in each of N (at most 1000) buckets between
+	                          start and end
+	GET /api/traffic/average  average hits per second between start and end
+	GET /api/lines?limit=N    the N most recent log lines between start and end
+	GET /api/alert            the current state of every alert rule
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/timebucketer"
+	"github.com/jdormit/logr/timeseries"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultWindow is the length of the query window when `start` is not given
+const DefaultWindow = 5 * time.Minute
+
+const defaultGranularity = 10
+const maxGranularity = 1000
+const defaultLimit = 100
+
+// A Server serves the JSON API. It should be instantiated via api.NewServer().
+type Server struct {
+	ts     *timeseries.LogTimeSeries
+	engine *alerts.Engine
+	now    func() time.Time
+	mux    *http.ServeMux
+}
+
+// NewServer returns a Server that answers queries from `ts`. The alert endpoint
+// reports the statuses of the rules in `engine` as of its latest evaluation.
+func NewServer(ts *timeseries.LogTimeSeries, engine *alerts.Engine) *Server {
+	s := &Server{
+		ts:     ts,
+		engine: engine,
+		now:    time.Now,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/sections", s.handleSections)
+	s.mux.HandleFunc("/api/statuses", s.handleStatuses)
+	s.mux.HandleFunc("/api/hosts", s.handleHosts)
+	s.mux.HandleFunc("/api/traffic", s.handleTraffic)
+	s.mux.HandleFunc("/api/traffic/average", s.handleAverageTraffic)
+	s.mux.HandleFunc("/api/lines", s.handleLines)
+	s.mux.HandleFunc("/api/alert", s.handleAlert)
+	return s
+}
+
+// ServeHTTP dispatches a request to the endpoint for its path
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// A query holds the parameters common to every endpoint
+type query struct {
+	start  time.Time
+	end    time.Time
+	filter *filter.Filter
+}
+
+// The parseTimeParam function parses an RFC 3339 timestamp or a Unix time in seconds
+func parseTimeParam(value string) (t time.Time, err error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (s *Server) parseQuery(r *http.Request) (q query, err error) {
+	params := r.URL.Query()
+	q.end = s.now()
+	if value := params.Get("end"); value != "" {
+		q.end, err = parseTimeParam(value)
+		if err != nil {
+			return q, fmt.Errorf("Invalid end %q", value)
+		}
+	}
+	q.start = q.end.Add(-DefaultWindow)
+	if value := params.Get("start"); value != "" {
+		q.start, err = parseTimeParam(value)
+		if err != nil {
+			return q, fmt.Errorf("Invalid start %q", value)
+		}
+	}
+	// Log lines are stored with a resolution of one second
+	q.start, q.end = q.start.Truncate(time.Second), q.end.Truncate(time.Second)
+	if q.end.Before(q.start) {
+		return q, fmt.Errorf("start must not be after end")
+	}
+	q.filter, err = filter.Parse(params.Get("filter"))
+	return
+}
+
+// The parsePositiveInt function returns the positive integer query parameter `name`,
+// or `defaultValue` if it is not set
+func parsePositiveInt(r *http.Request, name string, defaultValue int) (value int, err error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+	value, err = strconv.Atoi(param)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("Invalid %s %q", name, param)
+	}
+	return
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// The counts function returns a non-nil slice so that empty results encode as []
+func counts(counts []timeseries.Count) []timeseries.Count {
+	if counts == nil {
+		return []timeseries.Count{}
+	}
+	return counts
+}
+
+func (s *Server) handleSections(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	sectionCounts, err := s.ts.GetSectionCounts(q.start, q.end, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, counts(sectionCounts))
+}
+
+func (s *Server) handleStatuses(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	statusCounts, err := s.ts.GetStatusCounts(q.start, q.end, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, counts(statusCounts))
+}
+
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parsePositiveInt(r, "limit", defaultLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hostCounts, err := s.ts.GetHostCounts(q.start, q.end, limit, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, counts(hostCounts))
+}
+
+// TrafficResponse is the response body of /api/traffic
+type TrafficResponse struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	BucketSeconds float64   `json:"bucketSeconds"`
+	Hits          []int     `json:"hits"`
+	Bytes         []int     `json:"bytes"`
+}
+
+func (s *Server) handleTraffic(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	granularity, err := parsePositiveInt(r, "granularity", defaultGranularity)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if granularity > maxGranularity {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("granularity must be at most %d", maxGranularity))
+		return
+	}
+	logLines, err := s.ts.GetLogLines(q.start, q.end, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	buckets := timebucketer.Bucket(q.start, q.end, granularity, logLines)
+	writeJSON(w, TrafficResponse{
+		Start:         q.start,
+		End:           q.end,
+		BucketSeconds: q.end.Sub(q.start).Seconds() / float64(granularity),
+		Hits:          buckets.Hits(),
+		Bytes:         buckets.Bytes(),
+	})
+}
+
+// AverageTrafficResponse is the response body of /api/traffic/average
+type AverageTrafficResponse struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Average float64   `json:"average"`
+}
+
+func (s *Server) handleAverageTraffic(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !q.end.After(q.start) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("start must be before end"))
+		return
+	}
+	avgTraffic, err := s.ts.GetAverageTraffic(q.start, q.end, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, AverageTrafficResponse{q.start, q.end, avgTraffic})
+}
+
+func (s *Server) handleLines(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parsePositiveInt(r, "limit", defaultLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logLines, err := s.ts.GetRecentLogLines(q.start, q.end, limit, q.filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if logLines == nil {
+		logLines = []timeseries.LogLine{}
+	}
+	writeJSON(w, logLines)
+}
+
+// An AlertStatus is an element of the response body of /api/alert
+type AlertStatus struct {
+	Name      string       `json:"name"`
+	Condition string       `json:"condition"`
+	State     alerts.State `json:"state"`
+	Since     *time.Time   `json:"since"`
+	Value     float64      `json:"value"`
+	// Label is the section or host with the highest value, for rules with a GroupBy
+	Label string `json:"label,omitempty"`
+}
+
+func (s *Server) handleAlert(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]AlertStatus, 0)
+	for _, status := range s.engine.Statuses() {
+		alertStatus := AlertStatus{
+			Name:      status.Rule.Name,
+			Condition: status.Rule.String(),
+			State:     status.State,
+			Value:     status.Value,
+			Label:     status.Label,
+		}
+		// Rules that have never changed state have no meaningful Since time
+		if !status.Since.IsZero() {
+			since := status.Since
+			alertStatus.Since = &since
+		}
+		statuses = append(statuses, alertStatus)
+	}
+	writeJSON(w, statuses)
+}
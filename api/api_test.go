@@ -0,0 +1,224 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/timeseries"
+	_ "github.com/mattn/go-sqlite3"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+func loadDB() (db *sql.DB, err error) {
+	db, err = sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return
+	}
+	_, err = db.Exec(timeseries.CreateLogLinesTableStmt)
+	return
+}
+
+func parseTime(timeStr string) time.Time {
+	time, err := time.Parse("02/Jan/2006:15:04:05 -0700", timeStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return time
+}
+
+var testLines = []timeseries.LogLine{
+	{Host: "127.0.0.1", User: "james", Timestamp: parseTime("09/May/2018:16:00:10 +0000"),
+		Method: "GET", Path: "/report", Status: 200, ResponseBytes: 100},
+	{Host: "127.0.0.1", User: "jill", Timestamp: parseTime("09/May/2018:16:00:20 +0000"),
+		Method: "GET", Path: "/api/user", Status: 200, ResponseBytes: 200},
+	{Host: "127.0.0.2", User: "frank", Timestamp: parseTime("09/May/2018:16:00:40 +0000"),
+		Method: "POST", Path: "/api/user", Status: 500, ResponseBytes: 300},
+	{Host: "127.0.0.3", User: "mary", Timestamp: parseTime("09/May/2018:16:02:00 +0000"),
+		Method: "GET", Path: "/report", Status: 404, ResponseBytes: 400},
+}
+
+func TestServeHTTP(t *testing.T) {
+	testCases := []struct {
+		method         string
+		target         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"GET",
+			"/api/sections?start=2018-05-09T16:00:00Z&end=2018-05-09T16:01:00Z",
+			200,
+			`[{"label":"api","count":2},{"label":"report","count":1}]`,
+		},
+		{
+			"GET",
+			"/api/sections?start=2018-05-09T16:00:00Z&end=2018-05-09T16:01:00Z&filter=method%3DGET",
+			200,
+			`[{"label":"api","count":1},{"label":"report","count":1}]`,
+		},
+		{
+			"GET",
+			"/api/sections?start=1525881600&end=1525881601",
+			200,
+			`[]`,
+		},
+		{
+			"GET",
+			"/api/statuses",
+			200,
+			`[{"label":"200","count":2},{"label":"404","count":1},{"label":"500","count":1}]`,
+		},
+		{
+			"GET",
+			"/api/hosts?limit=1",
+			200,
+			`[{"label":"127.0.0.1","count":2}]`,
+		},
+		{
+			"GET",
+			"/api/traffic?start=2018-05-09T16:00:00Z&end=2018-05-09T16:01:00Z&granularity=3",
+			200,
+			`{"start":"2018-05-09T16:00:00Z","end":"2018-05-09T16:01:00Z","bucketSeconds":20,` +
+				`"hits":[1,1,1],"bytes":[100,200,300]}`,
+		},
+		{
+			"GET",
+			"/api/traffic?start=2018-05-09T16:00:10.5Z&end=2018-05-09T16:00:30Z&granularity=2",
+			200,
+			`{"start":"2018-05-09T16:00:10Z","end":"2018-05-09T16:00:30Z","bucketSeconds":10,` +
+				`"hits":[1,1],"bytes":[100,200]}`,
+		},
+		{
+			"GET",
+			"/api/traffic?granularity=1000000000",
+			400,
+			`{"error":"granularity must be at most 1000"}`,
+		},
+		{
+			"GET",
+			"/api/traffic/average?start=2018-05-09T16:00:00Z&end=2018-05-09T16:01:00Z",
+			200,
+			`{"start":"2018-05-09T16:00:00Z","end":"2018-05-09T16:01:00Z","average":0.05}`,
+		},
+		{
+			"GET",
+			"/api/lines?limit=1&filter=status%3E%3D500",
+			200,
+			`[{"host":"127.0.0.2","user":"frank","authUser":"","timestamp":"2018-05-09T16:00:40Z",` +
+				`"method":"POST","path":"/api/user","status":500,"responseBytes":300,"duration":0,"hasDuration":false}]`,
+		},
+		{
+			"GET",
+			"/api/lines?limit=2",
+			200,
+			`[{"host":"127.0.0.3","user":"mary","authUser":"","timestamp":"2018-05-09T16:02:00Z",` +
+				`"method":"GET","path":"/report","status":404,"responseBytes":400,"duration":0,"hasDuration":false},` +
+				`{"host":"127.0.0.2","user":"frank","authUser":"","timestamp":"2018-05-09T16:00:40Z",` +
+				`"method":"POST","path":"/api/user","status":500,"responseBytes":300,"duration":0,"hasDuration":false}]`,
+		},
+		{
+			"GET",
+			"/api/alert",
+			200,
+			`[{"name":"traffic","condition":"traffic > 0.01 requests/second over 1m0s","state":"firing",` +
+				`"since":"2018-05-09T16:01:00Z","value":0.05},` +
+				`{"name":"bandwidth","condition":"bandwidth > 1000 bytes/second over 1m0s","state":"inactive",` +
+				`"since":null,"value":10},` +
+				`{"name":"busiest","condition":"traffic > 0.01 requests/second over 1m0s from any one section",` +
+				`"state":"firing","since":"2018-05-09T16:01:00Z","value":0.03333333333333333,"label":"api"}]`,
+		},
+		{
+			"GET",
+			"/api/sections?start=yesterday",
+			400,
+			`{"error":"Invalid start \"yesterday\""}`,
+		},
+		{
+			"GET",
+			"/api/sections?start=2018-05-09T16:01:00Z&end=2018-05-09T16:00:00Z",
+			400,
+			`{"error":"start must not be after end"}`,
+		},
+		{
+			"GET",
+			"/api/sections?filter=colour%3Dred",
+			400,
+			`{"error":"Invalid filter at position 0: unknown field \"colour\""}`,
+		},
+		{
+			"GET",
+			"/api/hosts?limit=0",
+			400,
+			`{"error":"Invalid limit \"0\""}`,
+		},
+		{
+			"POST",
+			"/api/sections",
+			405,
+			`{"error":"Method POST not allowed"}`,
+		},
+		{
+			"GET",
+			"/api/nothing",
+			404,
+			``,
+		},
+	}
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	for _, logLine := range testLines {
+		_, err := ts.Record(logLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine, err := alerts.NewEngine(&ts, []alerts.Rule{
+		{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 0.01, Window: time.Minute},
+		{Name: "bandwidth", Metric: alerts.Bandwidth, Comparison: ">", Threshold: 1000, Window: time.Minute},
+		{Name: "busiest", Metric: alerts.Traffic, Comparison: ">", Threshold: 0.01, Window: time.Minute,
+			GroupBy: "section"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = engine.Evaluate(parseTime("09/May/2018:16:01:00 +0000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(&ts, engine)
+	server.now = func() time.Time { return parseTime("09/May/2018:16:05:00 +0000") }
+	for caseIdx, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(testCase.method, testCase.target, nil))
+		if recorder.Code != testCase.expectedStatus {
+			t.Errorf("Error on test case %d.\nExpected status: %d\nActual: %d",
+				caseIdx, testCase.expectedStatus, recorder.Code)
+		}
+		if testCase.expectedBody == "" {
+			continue
+		}
+		var expected, actual interface{}
+		err := json.Unmarshal([]byte(testCase.expectedBody), &expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(recorder.Body.Bytes(), &actual)
+		if err != nil {
+			t.Errorf("Error on test case %d: %v\nBody: %s", caseIdx, err, recorder.Body.String())
+			continue
+		}
+		if !cmp.Equal(expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+/*
+Package filter implements a small expression language for filtering log lines.
+
+A filter expression is made up of comparisons between a log line field and a value,
+combined with `and`, `or`, `not` and parentheses. For example:
+
+	status>=500 and section=api and not host~"10.*"
+
+The supported fields are host, user, authuser, method, section, path, status and bytes.
+The supported operators are =, !=, <, <=, >, >=, ~ (glob match) and !~ (glob non-match).
+Values are either bare words or double-quoted strings.
+
+Parsed filters are rendered as a parameterized SQL expression over the loglines table,
+so user input never ends up in the SQL text itself.
+*/
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fields maps each filterable field name to its column in the loglines table
+var Fields = map[string]string{
+	"host":     "remote_host",
+	"user":     "user",
+	"authuser": "authuser",
+	"method":   "request_method",
+	"section":  "request_section",
+	"path":     "request_path",
+	"status":   "response_status",
+	"bytes":    "response_bytes",
+}
+
+var numericFields = map[string]bool{
+	"status": true,
+	"bytes":  true,
+}
+
+var operators = map[string]bool{
+	"=":  true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"~":  true,
+	"!~": true,
+}
+
+// A SyntaxError is returned when a filter expression cannot be parsed
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Invalid filter at position %d: %s", e.Pos, e.Msg)
+}
+
+// A Node is a node in the syntax tree of a parsed filter expression
+type Node interface {
+	// sql renders the node as a SQL expression, appending its arguments to args.
+	// Parameters are numbered starting from firstParam + len(*args).
+	sql(firstParam int, args *[]interface{}) string
+}
+
+// And matches log lines matched by both Left and Right
+type And struct {
+	Left  Node
+	Right Node
+}
+
+// Or matches log lines matched by either Left or Right
+type Or struct {
+	Left  Node
+	Right Node
+}
+
+// Not matches log lines that are not matched by Operand
+type Not struct {
+	Operand Node
+}
+
+// Comparison matches log lines whose Field compares to Value according to Op
+type Comparison struct {
+	Field string
+	Op    string
+	Value string
+}
+
+func (n And) sql(firstParam int, args *[]interface{}) string {
+	return fmt.Sprintf("(%s AND %s)", n.Left.sql(firstParam, args), n.Right.sql(firstParam, args))
+}
+
+func (n Or) sql(firstParam int, args *[]interface{}) string {
+	return fmt.Sprintf("(%s OR %s)", n.Left.sql(firstParam, args), n.Right.sql(firstParam, args))
+}
+
+func (n Not) sql(firstParam int, args *[]interface{}) string {
+	return fmt.Sprintf("(NOT %s)", n.Operand.sql(firstParam, args))
+}
+
+func (n Comparison) sql(firstParam int, args *[]interface{}) string {
+	column := Fields[n.Field]
+	param := fmt.Sprintf("$%d", firstParam+len(*args))
+	switch n.Op {
+	case "~", "!~":
+		*args = append(*args, n.Value)
+		if numericFields[n.Field] {
+			column = fmt.Sprintf("CAST(%s AS TEXT)", column)
+		}
+		if n.Op == "~" {
+			return fmt.Sprintf("%s GLOB %s", column, param)
+		}
+		return fmt.Sprintf("%s NOT GLOB %s", column, param)
+	default:
+		if numericFields[n.Field] {
+			value, _ := strconv.Atoi(n.Value)
+			*args = append(*args, value)
+		} else {
+			*args = append(*args, n.Value)
+		}
+		return fmt.Sprintf("%s %s %s", column, n.Op, param)
+	}
+}
+
+// A Filter is a parsed filter expression. It should be instantiated via filter.Parse().
+type Filter struct {
+	Expr string
+	Root Node
+}
+
+// String returns the expression the filter was parsed from
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.Expr
+}
+
+// SQL renders the filter as a SQL boolean expression over the columns of the
+// loglines table along with its arguments. Parameters are numbered $firstParam,
+// $firstParam+1, etc. so that the expression can follow a query's own parameters.
+func (f *Filter) SQL(firstParam int) (clause string, args []interface{}) {
+	args = make([]interface{}, 0)
+	clause = f.Root.sql(firstParam, &args)
+	return
+}
+
+// Parse parses a filter expression. It returns a nil Filter if the expression
+// is blank and a *SyntaxError if the expression is invalid.
+func Parse(expr string) (f *Filter, err error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := parser{tokens: tokens, end: len(expr)}
+	root, err := p.parseOr()
+	if err != nil {
+		return
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Filter{strings.TrimSpace(expr), root}, nil
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	operatorToken
+	leftParenToken
+	rightParenToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// The tokenize function splits a filter expression into words, quoted strings,
+// operators and parentheses
+func tokenize(expr string) (tokens []token, err error) {
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{leftParenToken, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{rightParenToken, ")", i})
+			i++
+		case c == '"':
+			start := i
+			var value strings.Builder
+			i++
+			for ; i < len(expr) && expr[i] != '"'; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				value.WriteByte(expr[i])
+			}
+			if i >= len(expr) {
+				return nil, &SyntaxError{start, "unterminated string"}
+			}
+			tokens = append(tokens, token{stringToken, value.String(), start})
+			i++
+		case strings.IndexByte("=!<>~", c) >= 0:
+			start := i
+			for i < len(expr) && strings.IndexByte("=!<>~", expr[i]) >= 0 {
+				i++
+			}
+			op := expr[start:i]
+			if !operators[op] {
+				return nil, &SyntaxError{start, fmt.Sprintf("unknown operator %q", op)}
+			}
+			tokens = append(tokens, token{operatorToken, op, start})
+		default:
+			start := i
+			for i < len(expr) && strings.IndexByte(" \t\n()\"=!<>~", expr[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, token{wordToken, expr[start:i], start})
+		}
+	}
+	return
+}
+
+// A parser is a recursive descent parser over a tokenized filter expression
+type parser struct {
+	tokens []token
+	pos    int
+	end    int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) *SyntaxError {
+	pos := p.end
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].pos
+	}
+	return &SyntaxError{pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) &&
+		p.tokens[p.pos].kind == wordToken &&
+		strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *parser) parseOr() (node Node, err error) {
+	node, err = p.parseAnd()
+	if err != nil {
+		return
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = Or{node, right}
+	}
+	return
+}
+
+func (p *parser) parseAnd() (node Node, err error) {
+	node, err = p.parseUnary()
+	if err != nil {
+		return
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = And{node, right}
+	}
+	return
+}
+
+func (p *parser) parseUnary() (node Node, err error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("unexpected end of filter")
+	}
+	if p.peekKeyword("not") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{operand}, nil
+	}
+	if p.tokens[p.pos].kind == leftParenToken {
+		p.pos++
+		node, err = p.parseOr()
+		if err != nil {
+			return
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != rightParenToken {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node Node, err error) {
+	fieldToken := p.tokens[p.pos]
+	field := strings.ToLower(fieldToken.text)
+	if _, ok := Fields[field]; fieldToken.kind != wordToken || !ok {
+		return nil, p.errorf("unknown field %q", fieldToken.text)
+	}
+	p.pos++
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != operatorToken {
+		return nil, p.errorf("expected an operator after %s", field)
+	}
+	op := p.tokens[p.pos].text
+	p.pos++
+	if p.pos >= len(p.tokens) ||
+		(p.tokens[p.pos].kind != wordToken && p.tokens[p.pos].kind != stringToken) {
+		return nil, p.errorf("expected a value after %s%s", field, op)
+	}
+	value := p.tokens[p.pos].text
+	if numericFields[field] && op != "~" && op != "!~" {
+		if _, err := strconv.Atoi(value); err != nil {
+			return nil, p.errorf("%s must be compared to a number", field)
+		}
+	}
+	p.pos++
+	return Comparison{field, op, value}, nil
+}
@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		expr          string
+		expectedRoot  Node
+		expectedError *SyntaxError
+	}{
+		{
+			`status>=500`,
+			Comparison{"status", ">=", "500"},
+			nil,
+		},
+		{
+			`status>=500 and section=api and not host~"10.*"`,
+			And{
+				And{
+					Comparison{"status", ">=", "500"},
+					Comparison{"section", "=", "api"},
+				},
+				Not{Comparison{"host", "~", "10.*"}},
+			},
+			nil,
+		},
+		{
+			`method = GET or (status != 200 AND path ~ "/api/*")`,
+			Or{
+				Comparison{"method", "=", "GET"},
+				And{
+					Comparison{"status", "!=", "200"},
+					Comparison{"path", "~", "/api/*"},
+				},
+			},
+			nil,
+		},
+		{
+			`user="say \"hi\""`,
+			Comparison{"user", "=", `say "hi"`},
+			nil,
+		},
+		{`status=`, nil, &SyntaxError{7, "expected a value after status="}},
+		{`size>10`, nil, &SyntaxError{0, `unknown field "size"`}},
+		{`status=ok`, nil, &SyntaxError{7, "status must be compared to a number"}},
+		{`status=>500`, nil, &SyntaxError{6, `unknown operator "=>"`}},
+		{`(status=500`, nil, &SyntaxError{11, "expected )"}},
+		{`host="10.0.0.1`, nil, &SyntaxError{5, "unterminated string"}},
+		{`status=500 section=api`, nil, &SyntaxError{11, `unexpected "section"`}},
+		{`not`, nil, &SyntaxError{3, "unexpected end of filter"}},
+	}
+	for caseIdx, testCase := range testCases {
+		f, err := Parse(testCase.expr)
+		if testCase.expectedError != nil {
+			if !cmp.Equal(testCase.expectedError, err) {
+				t.Errorf("Error on case %d.\nExpected: %#v\nActual: %#v",
+					caseIdx, testCase.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error on case %d: %v", caseIdx, err)
+			continue
+		}
+		if !cmp.Equal(testCase.expectedRoot, f.Root) {
+			t.Errorf("Error on case %d.\nExpected: %#v\nActual: %#v",
+				caseIdx, testCase.expectedRoot, f.Root)
+		}
+	}
+}
+
+func TestParseBlank(t *testing.T) {
+	f, err := Parse("   ")
+	if f != nil || err != nil {
+		t.Errorf("Expected a nil filter and error, got %#v, %v", f, err)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	testCases := []struct {
+		expr           string
+		firstParam     int
+		expectedClause string
+		expectedArgs   []interface{}
+	}{
+		{
+			`status>=500 and section=api and not host~"10.*"`,
+			4,
+			"((response_status >= $4 AND request_section = $5) AND (NOT remote_host GLOB $6))",
+			[]interface{}{500, "api", "10.*"},
+		},
+		{
+			`status~"4*" or bytes<100`,
+			1,
+			"(CAST(response_status AS TEXT) GLOB $1 OR response_bytes < $2)",
+			[]interface{}{"4*", 100},
+		},
+		{
+			`path="'; DROP TABLE loglines; --"`,
+			1,
+			"request_path = $1",
+			[]interface{}{"'; DROP TABLE loglines; --"},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		f, err := Parse(testCase.expr)
+		if err != nil {
+			t.Errorf("Error on case %d: %v", caseIdx, err)
+			continue
+		}
+		clause, args := f.SQL(testCase.firstParam)
+		if clause != testCase.expectedClause {
+			t.Errorf("Error on case %d.\nExpected: %s\nActual: %s",
+				caseIdx, testCase.expectedClause, clause)
+		}
+		if !cmp.Equal(testCase.expectedArgs, args) {
+			t.Errorf("Error on case %d.\nExpected: %#v\nActual: %#v",
+				caseIdx, testCase.expectedArgs, args)
+		}
+	}
+}
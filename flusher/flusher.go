@@ -0,0 +1,83 @@
+/*
+Package flusher periodically hands consecutive windows of log timestamps to a flush
+function, which sends metrics about the log lines recorded in each window.
+
+Windows are whole seconds long and each one starts where the previous successful flush
+ended, so a failed flush is retried with a longer window on the next tick. Windows
+follow the log's timestamps rather than the order in which lines are recorded, so a
+line recorded after its window has been flushed is never flushed.
+*/
+package flusher
+
+import (
+	"fmt"
+	"time"
+)
+
+// A FlushFunc sends the metrics for the log lines recorded from `start` up to but not
+// including `end`. Both are whole seconds.
+type FlushFunc func(start time.Time, end time.Time) error
+
+// A Flusher calls a FlushFunc every interval. It should be instantiated via
+// flusher.NewFlusher().
+type Flusher struct {
+	interval   time.Duration
+	flush      FlushFunc
+	lastFlush  time.Time
+	terminated chan bool
+}
+
+// NewFlusher returns a Flusher that calls `flush` every `interval`, which must be at
+// least a second, starting with the window that begins at `start`
+func NewFlusher(interval time.Duration, start time.Time, flush FlushFunc) (flusher *Flusher, err error) {
+	if interval < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s, got %v", interval)
+	}
+	return &Flusher{interval, flush, start.Truncate(time.Second), make(chan bool)}, nil
+}
+
+// Run flushes every interval until a call to Flusher.Terminate(), passing any error
+// to `onError`
+func (f *Flusher) Run(onError func(error)) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.terminated:
+			return
+		case now := <-ticker.C:
+			err := f.Flush(now)
+			if err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Terminate stops a running Flusher
+func (f *Flusher) Terminate() {
+	close(f.terminated)
+}
+
+// Flush calls the flush function with the window between the previous successful
+// flush and `now`, unless it would be empty
+func (f *Flusher) Flush(now time.Time) (err error) {
+	end := now.Truncate(time.Second)
+	if !end.After(f.lastFlush) {
+		return nil
+	}
+	err = f.flush(f.lastFlush, end)
+	if err != nil {
+		return
+	}
+	f.lastFlush = end
+	return
+}
+
+// Last returns the last second of the window that ends at `end`. Timestamps are
+// stored with a resolution of one second and the time series queries include both
+// ends of their window, so a flush queries up to Last(end) to avoid counting the
+// lines at the boundary in two consecutive windows.
+func Last(end time.Time) time.Time {
+	return end.Add(-time.Second)
+}
@@ -0,0 +1,89 @@
+package flusher
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+func TestNewFlusher(t *testing.T) {
+	flush := func(start time.Time, end time.Time) error { return nil }
+	for _, interval := range []time.Duration{0, -time.Second, 500 * time.Millisecond} {
+		_, err := NewFlusher(interval, start, flush)
+		if err == nil {
+			t.Errorf("Expected an error for an interval of %v", interval)
+		}
+	}
+	_, err := NewFlusher(time.Second, start, flush)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	var windows [][]time.Time
+	var flushErr error
+	flusher, err := NewFlusher(10*time.Second, start.Add(300*time.Millisecond),
+		func(start time.Time, end time.Time) error {
+			windows = append(windows, []time.Time{start, end})
+			return flushErr
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		now             time.Time
+		err             error
+		expectedWindows [][]time.Time
+	}{
+		{start.Add(10*time.Second + 500*time.Millisecond), nil,
+			[][]time.Time{{start, start.Add(10 * time.Second)}}},
+		// Nothing is flushed until a new second has started
+		{start.Add(10*time.Second + 900*time.Millisecond), nil, nil},
+		// A failed flush is retried from the same start
+		{start.Add(20 * time.Second), errors.New("unreachable"),
+			[][]time.Time{{start.Add(10 * time.Second), start.Add(20 * time.Second)}}},
+		{start.Add(30 * time.Second), nil,
+			[][]time.Time{{start.Add(10 * time.Second), start.Add(30 * time.Second)}}},
+	}
+	for caseIdx, testCase := range testCases {
+		windows, flushErr = nil, testCase.err
+		err := flusher.Flush(testCase.now)
+		if err != testCase.err {
+			t.Errorf("Error on test case %d.\nExpected error: %v\nActual: %v", caseIdx, testCase.err, err)
+		}
+		if !cmp.Equal(testCase.expectedWindows, windows) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expectedWindows, windows)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	flushed := make(chan bool, 10)
+	flusher, err := NewFlusher(time.Second, start, func(start time.Time, end time.Time) error {
+		flushed <- true
+		return errors.New("unreachable")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 10)
+	go flusher.Run(func(err error) { errs <- err })
+	defer flusher.Terminate()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a flush within 5 seconds")
+	}
+	select {
+	case err := <-errs:
+		if err.Error() != "unreachable" {
+			t.Errorf("Expected the flush error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the flush error to be passed on")
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Package headless writes dashboard statistics as machine-readable JSON lines.
+
+Each call to Writer.Write emits one JSON object on its own line containing the numbers
+the dashboard would display for a ui.UIState, the alerts that are firing, and the alert
+state transitions from the latest evaluation of the alert rules. This lets logr run as
+a daemon whose output is consumed by other tools instead of a human watching a
+terminal.
+*/
+package headless
+
+import (
+	"encoding/json"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/timeseries"
+	"github.com/jdormit/logr/ui"
+	"io"
+	"time"
+)
+
+// A Record is a single line of headless output
+type Record struct {
+	Time          time.Time           `json:"time"`
+	Begin         time.Time           `json:"begin"`
+	End           time.Time           `json:"end"`
+	Traffic       []int               `json:"traffic"`
+	TrafficBytes  []int               `json:"trafficBytes"`
+	SectionCounts []timeseries.Count  `json:"sectionCounts"`
+	StatusCounts  []timeseries.Count  `json:"statusCounts"`
+	HostCounts    []timeseries.Count  `json:"hostCounts"`
+	UniqueHosts   int                 `json:"uniqueHosts"`
+	Alerts        []string            `json:"alerts"`
+	Transitions   []alerts.Transition `json:"transitions,omitempty"`
+}
+
+// A Writer writes Records as JSON lines. It should be instantiated via headless.NewWriter().
+type Writer struct {
+	encoder *json.Encoder
+}
+
+// NewWriter returns a Writer that writes JSON lines to `w`
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{json.NewEncoder(w)}
+}
+
+// The firingAlerts function returns the names of the alerts firing in `state`
+func firingAlerts(state *ui.UIState) (names []string) {
+	names = make([]string, 0)
+	for _, status := range state.Alerts {
+		if status.State == alerts.Firing {
+			names = append(names, status.Rule.Name)
+		}
+	}
+	return
+}
+
+// NewRecord returns the Record for `state` and the alert `transitions` at time `now`
+func NewRecord(state *ui.UIState, transitions []alerts.Transition, now time.Time) Record {
+	return Record{
+		Time:          now,
+		Begin:         state.Begin,
+		End:           state.Begin.Add(time.Duration(state.Timescale) * time.Minute),
+		Traffic:       state.Traffic,
+		TrafficBytes:  state.TrafficBytes,
+		SectionCounts: state.SectionCounts,
+		StatusCounts:  state.StatusCounts,
+		HostCounts:    state.HostCounts,
+		UniqueHosts:   state.UniqueHosts,
+		Alerts:        firingAlerts(state),
+		Transitions:   transitions,
+	}
+}
+
+// Write writes the Record for `state` and the alert `transitions` at time `now`
+// as a single JSON line
+func (w *Writer) Write(state *ui.UIState, transitions []alerts.Transition, now time.Time) error {
+	return w.encoder.Encode(NewRecord(state, transitions, now))
+}
@@ -0,0 +1,93 @@
+package headless
+
+import (
+	"bytes"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/timeseries"
+	"github.com/jdormit/logr/ui"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	begin := time.Date(2018, time.May, 9, 18, 0, 0, 0, time.UTC)
+	traffic := alerts.Rule{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 10, Window: time.Minute}
+	bandwidth := alerts.Rule{Name: "bandwidth", Metric: alerts.Bandwidth, Comparison: ">", Threshold: 100, Window: time.Minute}
+	testCases := []struct {
+		state        *ui.UIState
+		transitions  []alerts.Transition
+		expectedLine string
+	}{
+		{
+			&ui.UIState{
+				Begin:         begin,
+				Timescale:     5,
+				Traffic:       []int{0, 1},
+				TrafficBytes:  []int{0, 123},
+				SectionCounts: []timeseries.Count{{"report", 1}},
+				StatusCounts:  []timeseries.Count{{"200", 1}},
+				HostCounts:    []timeseries.Count{{"127.0.0.1", 1}},
+				UniqueHosts:   1,
+				Alerts:        []alerts.Status{{Rule: traffic}, {Rule: bandwidth}},
+			},
+			nil,
+			`{"time":"2018-05-09T18:01:00Z","begin":"2018-05-09T18:00:00Z","end":"2018-05-09T18:05:00Z",` +
+				`"traffic":[0,1],"trafficBytes":[0,123],"sectionCounts":[{"label":"report","count":1}],` +
+				`"statusCounts":[{"label":"200","count":1}],"hostCounts":[{"label":"127.0.0.1","count":1}],` +
+				`"uniqueHosts":1,"alerts":[]}`,
+		},
+		{
+			&ui.UIState{
+				Begin:     begin,
+				Timescale: 5,
+				Alerts: []alerts.Status{
+					{Rule: traffic, State: alerts.Firing, Since: begin.Add(2 * time.Minute), Value: 12},
+					{Rule: bandwidth},
+				},
+			},
+			[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, begin.Add(2 * time.Minute), 12, ""}},
+			`{"time":"2018-05-09T18:02:00Z","begin":"2018-05-09T18:00:00Z","end":"2018-05-09T18:05:00Z",` +
+				`"traffic":null,"trafficBytes":null,"sectionCounts":null,"statusCounts":null,"hostCounts":null,` +
+				`"uniqueHosts":0,"alerts":["traffic"],"transitions":[{"alert":"traffic","from":"inactive",` +
+				`"state":"firing","time":"2018-05-09T18:02:00Z","value":12}]}`,
+		},
+		{
+			&ui.UIState{
+				Begin:     begin,
+				Timescale: 5,
+				Alerts: []alerts.Status{
+					{Rule: traffic, State: alerts.Resolved, Since: begin.Add(3 * time.Minute), Value: 2},
+					{Rule: bandwidth, State: alerts.Firing, Since: begin.Add(3 * time.Minute), Value: 150},
+				},
+			},
+			[]alerts.Transition{
+				{"traffic", alerts.Firing, alerts.Resolved, begin.Add(3 * time.Minute), 2, ""},
+				{"bandwidth", alerts.Pending, alerts.Firing, begin.Add(3 * time.Minute), 150, ""},
+			},
+			`{"time":"2018-05-09T18:03:00Z","begin":"2018-05-09T18:00:00Z","end":"2018-05-09T18:05:00Z",` +
+				`"traffic":null,"trafficBytes":null,"sectionCounts":null,"statusCounts":null,"hostCounts":null,` +
+				`"uniqueHosts":0,"alerts":["bandwidth"],"transitions":[` +
+				`{"alert":"traffic","from":"firing","state":"resolved","time":"2018-05-09T18:03:00Z","value":2},` +
+				`{"alert":"bandwidth","from":"pending","state":"firing","time":"2018-05-09T18:03:00Z","value":150}]}`,
+		},
+	}
+
+	var out bytes.Buffer
+	writer := NewWriter(&out)
+	for i, testCase := range testCases {
+		err := writer.Write(testCase.state, testCase.transitions, begin.Add(time.Duration(i+1)*time.Minute))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(testCases) {
+		t.Fatalf("Expected %d lines but got %d:\n%s", len(testCases), len(lines), out.String())
+	}
+	for i, line := range lines {
+		if line != testCases[i].expectedLine {
+			t.Errorf("Error on line %d.\nExpected: %s\nActual: %s", i, testCases[i].expectedLine, line)
+		}
+	}
+}
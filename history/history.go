@@ -0,0 +1,152 @@
+/*
+Package history stores alert incidents, so that alerts that have fired and recovered
+can be reviewed later.
+
+An incident starts when an alert rule starts firing and ends when it resolves. While
+it is firing, the incident keeps the most extreme value of the rule's metric: the
+highest value for rules that fire above their threshold and the lowest value for
+rules that fire below it.
+*/
+package history
+
+import (
+	"database/sql"
+	"github.com/jdormit/logr/alerts"
+	"strings"
+	"time"
+)
+
+const CreateAlertHistoryTableStmt = `
+CREATE TABLE IF NOT EXISTS alert_history (
+  id integer primary key,
+  log_file varchar(255),
+  rule varchar(255),
+  condition text,
+  label varchar(255),
+  start_time integer,
+  end_time integer,
+  peak real
+)
+`
+
+// An Incident is a period during which an alert rule was firing
+type Incident struct {
+	Rule string
+	// Condition describes the rule as it was when the incident started
+	Condition string
+	Start     time.Time
+	// End is the zero time while the incident is ongoing
+	End  time.Time
+	Peak float64
+	// Label is the section or host with the peak value, for rules with a GroupBy
+	Label string
+}
+
+// Ongoing returns true if the rule has not resolved since the incident started
+func (incident Incident) Ongoing() bool {
+	return incident.End.IsZero()
+}
+
+// Duration returns how long the incident lasted, or has lasted so far as of `now`
+func (incident Incident) Duration(now time.Time) time.Duration {
+	if incident.Ongoing() {
+		return now.Sub(incident.Start)
+	}
+	return incident.End.Sub(incident.Start)
+}
+
+// The Store struct is used to record and query the alert incidents of a log file
+type Store struct {
+	DB      *sql.DB
+	LogFile string
+}
+
+// Record starts an incident for every transition to firing in `transitions`, ends
+// the incident of every transition from firing, and updates the peak value of every
+// incident whose rule is firing in `statuses`
+func (s *Store) Record(statuses []alerts.Status, transitions []alerts.Transition) (err error) {
+	conditions := make(map[string]string)
+	for _, status := range statuses {
+		conditions[status.Rule.Name] = status.Rule.String()
+	}
+	for _, transition := range transitions {
+		if transition.From == alerts.Firing {
+			_, err = s.DB.Exec("UPDATE alert_history SET end_time = $1 "+
+				"WHERE log_file LIKE $2 AND rule = $3 AND end_time IS NULL",
+				transition.Time.Unix(), s.LogFile, transition.Rule)
+			if err != nil {
+				return
+			}
+		}
+		if transition.To == alerts.Firing {
+			_, err = s.DB.Exec("INSERT INTO alert_history "+
+				"(log_file, rule, condition, label, start_time, peak) "+
+				"VALUES ($1, $2, $3, $4, $5, $6)",
+				s.LogFile, transition.Rule, conditions[transition.Rule], transition.Label,
+				transition.Time.Unix(), transition.Value)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, status := range statuses {
+		if status.State != alerts.Firing {
+			continue
+		}
+		// Rules that fire below their threshold peak at their lowest value
+		exceeds := "peak < $1"
+		if strings.HasPrefix(status.Rule.Comparison, "<") {
+			exceeds = "peak > $1"
+		}
+		_, err = s.DB.Exec("UPDATE alert_history SET peak = $1, label = $2 "+
+			"WHERE log_file LIKE $3 AND rule = $4 AND end_time IS NULL AND "+exceeds,
+			status.Value, status.Label, s.LogFile, status.Rule.Name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EndOngoing ends every ongoing incident at `now`. Alert rules start out inactive
+// when logr starts, so incidents left ongoing by a previous run would otherwise
+// never end.
+func (s *Store) EndOngoing(now time.Time) (err error) {
+	_, err = s.DB.Exec("UPDATE alert_history SET end_time = $1 WHERE log_file LIKE $2 AND end_time IS NULL",
+		now.Unix(), s.LogFile)
+	return
+}
+
+// Incidents returns up to `limit` incidents that were ongoing at any point between
+// `start` and `end`, most recent first. A `limit` of 0 returns every such incident.
+func (s *Store) Incidents(start time.Time, end time.Time, limit int) (incidents []Incident, err error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.DB.Query("SELECT rule, condition, label, start_time, end_time, peak FROM alert_history "+
+		"WHERE log_file LIKE $1 AND start_time <= $2 AND (end_time IS NULL OR end_time >= $3) "+
+		"ORDER BY start_time DESC, id DESC LIMIT $4",
+		s.LogFile, end.Unix(), start.Unix(), limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	incidents = make([]Incident, 0)
+	for rows.Next() {
+		var incident Incident
+		var incidentStart int64
+		var incidentEnd sql.NullInt64
+		err = rows.Scan(&incident.Rule, &incident.Condition, &incident.Label,
+			&incidentStart, &incidentEnd, &incident.Peak)
+		if err != nil {
+			return
+		}
+		incident.Start = time.Unix(incidentStart, 0)
+		if incidentEnd.Valid {
+			incident.End = time.Unix(incidentEnd.Int64, 0)
+		}
+		incidents = append(incidents, incident)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,202 @@
+package history
+
+import (
+	"database/sql"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+var start = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+func loadStore(t *testing.T, logFile string) *Store {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(CreateAlertHistoryTableStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Store{db, logFile}
+}
+
+var traffic = alerts.Rule{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 10,
+	Window: 2 * time.Minute}
+var quiet = alerts.Rule{Name: "quiet", Metric: alerts.Traffic, Comparison: "<", Threshold: 1,
+	Window: time.Minute}
+
+// An evaluation is the statuses and transitions of one alert evaluation
+type evaluation struct {
+	statuses    []alerts.Status
+	transitions []alerts.Transition
+}
+
+func TestRecord(t *testing.T) {
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	testCases := []struct {
+		evaluations []evaluation
+		expected    []Incident
+	}{
+		{
+			// Pending rules don't start incidents
+			[]evaluation{
+				{
+					[]alerts.Status{{Rule: traffic, State: alerts.Pending, Since: at(0), Value: 12}},
+					[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Pending, at(0), 12, ""}},
+				},
+			},
+			[]Incident{},
+		},
+		{
+			// An incident keeps the peak value until the rule resolves
+			[]evaluation{
+				{
+					[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 12}},
+					[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, at(0), 12, ""}},
+				},
+				{[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 20}}, nil},
+				{[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 15}}, nil},
+				{
+					[]alerts.Status{{Rule: traffic, State: alerts.Resolved, Since: at(3), Value: 5}},
+					[]alerts.Transition{{"traffic", alerts.Firing, alerts.Resolved, at(3), 5, ""}},
+				},
+			},
+			[]Incident{{"traffic", traffic.String(), at(0), at(3), 20, ""}},
+		},
+		{
+			// Rules that fire below their threshold peak at their lowest value, and
+			// each time a rule fires starts a new incident
+			[]evaluation{
+				{
+					[]alerts.Status{{Rule: quiet, State: alerts.Firing, Since: at(0), Value: 0.5}},
+					[]alerts.Transition{{"quiet", alerts.Inactive, alerts.Firing, at(0), 0.5, ""}},
+				},
+				{[]alerts.Status{{Rule: quiet, State: alerts.Firing, Since: at(0), Value: 0.2}}, nil},
+				{
+					[]alerts.Status{{Rule: quiet, State: alerts.Resolved, Since: at(2), Value: 3}},
+					[]alerts.Transition{{"quiet", alerts.Firing, alerts.Resolved, at(2), 3, ""}},
+				},
+				{
+					[]alerts.Status{{Rule: quiet, State: alerts.Firing, Since: at(5), Value: 0.8}},
+					[]alerts.Transition{{"quiet", alerts.Resolved, alerts.Firing, at(5), 0.8, ""}},
+				},
+			},
+			[]Incident{
+				{"quiet", quiet.String(), at(5), time.Time{}, 0.8, ""},
+				{"quiet", quiet.String(), at(0), at(2), 0.2, ""},
+			},
+		},
+		{
+			// The label of a grouped rule is the group with the peak value
+			[]evaluation{
+				{
+					[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 12, Label: "api"}},
+					[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, at(0), 12, "api"}},
+				},
+				{[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 30, Label: "report"}}, nil},
+				{[]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: at(0), Value: 11, Label: "api"}}, nil},
+			},
+			[]Incident{{"traffic", traffic.String(), at(0), time.Time{}, 30, "report"}},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			store := loadStore(t, logFile)
+			defer store.DB.Close()
+			for _, eval := range testCase.evaluations {
+				err := store.Record(eval.statuses, eval.transitions)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			actual, err := store.Incidents(start, start.Add(time.Hour), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(testCase.expected, actual) {
+				t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v", caseIdx, testCase.expected, actual)
+			}
+		}()
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	store := loadStore(t, logFile)
+	defer store.DB.Close()
+	record := func(rule alerts.Rule, from time.Time, to time.Time) {
+		store.Record([]alerts.Status{{Rule: rule, State: alerts.Firing, Since: from, Value: 12}},
+			[]alerts.Transition{{rule.Name, alerts.Inactive, alerts.Firing, from, 12, ""}})
+		if !to.IsZero() {
+			store.Record([]alerts.Status{{Rule: rule, State: alerts.Resolved, Since: to, Value: 0}},
+				[]alerts.Transition{{rule.Name, alerts.Firing, alerts.Resolved, to, 0, ""}})
+		}
+	}
+	record(traffic, start, start.Add(time.Minute))
+	record(traffic, start.Add(time.Hour), start.Add(2*time.Hour))
+	record(quiet, start.Add(3*time.Hour), time.Time{})
+	// Incidents of other log files are ignored
+	other := &Store{store.DB, "other.log"}
+	other.Record([]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: start, Value: 12}},
+		[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, start, 12, ""}})
+
+	testCases := []struct {
+		start    time.Time
+		end      time.Time
+		limit    int
+		expected []time.Time
+	}{
+		{start, start.Add(4 * time.Hour), 0,
+			[]time.Time{start.Add(3 * time.Hour), start.Add(time.Hour), start}},
+		{start, start.Add(4 * time.Hour), 2,
+			[]time.Time{start.Add(3 * time.Hour), start.Add(time.Hour)}},
+		// Incidents overlapping the window are included
+		{start.Add(90 * time.Minute), start.Add(100 * time.Minute), 0,
+			[]time.Time{start.Add(time.Hour)}},
+		// Ongoing incidents overlap every window after they started
+		{start.Add(10 * time.Hour), start.Add(11 * time.Hour), 0,
+			[]time.Time{start.Add(3 * time.Hour)}},
+		{start.Add(2 * time.Minute), start.Add(3 * time.Minute), 0, []time.Time{}},
+	}
+	for caseIdx, testCase := range testCases {
+		incidents, err := store.Incidents(testCase.start, testCase.end, testCase.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := make([]time.Time, 0)
+		for _, incident := range incidents {
+			actual = append(actual, incident.Start)
+		}
+		if !cmp.Equal(testCase.expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestEndOngoing(t *testing.T) {
+	store := loadStore(t, logFile)
+	defer store.DB.Close()
+	store.Record([]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: start, Value: 12}},
+		[]alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, start, 12, ""}})
+	end := start.Add(time.Minute)
+	err := store.EndOngoing(end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incidents, err := store.Incidents(start, end, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 || !incidents[0].End.Equal(end) {
+		t.Errorf("Expected one incident ending at %v, got %+v", end, incidents)
+	}
+	if incidents[0].Duration(start.Add(time.Hour)) != time.Minute {
+		t.Errorf("Expected the incident to last a minute, got %v", incidents[0].Duration(start.Add(time.Hour)))
+	}
+}
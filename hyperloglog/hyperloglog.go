@@ -0,0 +1,93 @@
+/*
+Package hyperloglog implements the HyperLogLog cardinality estimator.
+
+A Sketch estimates the number of distinct strings added to it using a fixed
+amount of memory (2^precision bytes), regardless of how many strings are added.
+See Flajolet et al., "HyperLogLog: the analysis of a near-optimal cardinality
+estimation algorithm" (2007).
+*/
+package hyperloglog
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultPrecision gives a standard error of roughly 0.8% using 16KB of registers
+const DefaultPrecision = 14
+
+// A Sketch is a HyperLogLog sketch. It should be instantiated via hyperloglog.New().
+type Sketch struct {
+	precision uint8
+	registers []uint8
+}
+
+// New returns an empty Sketch with 2^precision registers. Precision is clamped
+// to the range [4, 16].
+func New(precision uint8) *Sketch {
+	if precision < 4 {
+		precision = 4
+	} else if precision > 16 {
+		precision = 16
+	}
+	return &Sketch{precision, make([]uint8, 1<<precision)}
+}
+
+// The hash function returns a well-mixed 64-bit hash of value. FNV-1a on its own
+// distributes short, similar strings such as IP addresses poorly in its high bits,
+// so its output is passed through the splitmix64 finalizer.
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add adds value to the sketch
+func (s *Sketch) Add(value string) {
+	x := hash(value)
+	index := x >> (64 - s.precision)
+	rank := uint8(bits.LeadingZeros64(x<<s.precision|1<<(s.precision-1))) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values added to the sketch
+func (s *Sketch) Count() uint64 {
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, register := range s.registers {
+		sum += 1.0 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(len(s.registers)) * m * m / sum
+	// Small range correction: linear counting is far more accurate
+	// while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
@@ -0,0 +1,45 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	testCases := []struct {
+		distinct  int
+		repeats   int
+		tolerance float64
+	}{
+		{0, 1, 0},
+		{1, 5, 0},
+		{10, 3, 0},
+		{1000, 2, 0.02},
+		{100000, 1, 0.02},
+	}
+	for caseIdx, testCase := range testCases {
+		sketch := New(DefaultPrecision)
+		for r := 0; r < testCase.repeats; r++ {
+			for i := 0; i < testCase.distinct; i++ {
+				sketch.Add(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+			}
+		}
+		actual := sketch.Count()
+		errorRate := math.Abs(float64(actual)-float64(testCase.distinct)) /
+			math.Max(float64(testCase.distinct), 1)
+		if errorRate > testCase.tolerance {
+			t.Errorf("Error on case %d.\nExpected: %d (+/- %.0f%%)\nActual: %d",
+				caseIdx, testCase.distinct, testCase.tolerance*100, actual)
+		}
+	}
+}
+
+func TestNewClampsPrecision(t *testing.T) {
+	if len(New(0).registers) != 1<<4 {
+		t.Errorf("Expected precision to be clamped to 4")
+	}
+	if len(New(20).registers) != 1<<16 {
+		t.Errorf("Expected precision to be clamped to 16")
+	}
+}
@@ -5,15 +5,26 @@ import (
 	"flag"
 	"fmt"
 	"github.com/gizak/termui"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/headless"
+	"github.com/jdormit/logr/history"
+	"github.com/jdormit/logr/metrics"
+	"github.com/jdormit/logr/notify"
 	"github.com/jdormit/logr/offsets"
+	"github.com/jdormit/logr/otlp"
+	"github.com/jdormit/logr/push"
 	"github.com/jdormit/logr/reader"
+	"github.com/jdormit/logr/silence"
 	"github.com/jdormit/logr/timeseries"
 	"github.com/jdormit/logr/ui"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"strings"
 	"time"
 )
 
@@ -21,28 +32,65 @@ const defaultTimescale = 5
 const defaultGranularity = 10
 const defaultAlertThreshold = 10.0
 const defaultAlertInterval = 120
+const defaultBandwidthAlertThreshold = 0.0
+const defaultPushInterval = 10
+const defaultOTLPInterval = 60
+const alertHistoryLimit = 100
 
 var defaultLogPath = path.Join(os.TempDir(), "access.log")
+var defaultDebugLogPath = path.Join(os.Getenv("HOME"), ".local", "share", "logr", "logr.log")
+var defaultDbPath = path.Join(os.Getenv("HOME"), ".local", "share", "logr", "logr.sqlite")
 
 func usage() {
 	fmt.Printf(`A small utility to monitor a server log file
 
 USAGE:
   %s [OPTIONS] [log_file_path]
+  %s query [OPTIONS]
+  %s serve [OPTIONS] [log_file_path]
+  %s alerts [OPTIONS]
 
 ARGS:
   log_file_path
         The path to the log file to monitor (default %s)
 
+COMMANDS:
+  query
+        Query the stored log lines and print the results (see query -h)
+  serve
+        Monitor the log file and serve its statistics over HTTP (see serve -h)
+  alerts
+        List past alert incidents (see alerts -h)
+
 OPTIONS:
   -h, -help
         Display this message and exit
-`, os.Args[0], defaultLogPath)
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], defaultLogPath)
 	flag.PrintDefaults()
 }
 
+// The openDebugLog function truncates the debug log file at `debugLogPath`, creating
+// it and its parent directories if necessary, and opens it for writing
+func openDebugLog(debugLogPath string) (debugLogFile *os.File, err error) {
+	err = os.MkdirAll(path.Dir(debugLogPath), 0755)
+	if err != nil {
+		return
+	}
+	err = os.Remove(debugLogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	return os.Create(debugLogPath)
+}
+
 func loadDB(dbPath string) (db *sql.DB, err error) {
-	db, err = sql.Open("sqlite3", fmt.Sprintf("%s", dbPath))
+	err = os.MkdirAll(path.Dir(dbPath), 0755)
+	if err != nil {
+		return
+	}
+	// The busy timeout lets `logr query` and `logr serve` read the database
+	// while another logr process is writing to it
+	db, err = sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=5000", dbPath))
 	if err != nil {
 		return
 	}
@@ -50,46 +98,262 @@ func loadDB(dbPath string) (db *sql.DB, err error) {
 	if err != nil {
 		return
 	}
+	err = timeseries.MigrateLogLinesTable(db)
+	if err != nil {
+		return
+	}
 	_, err = db.Exec(offsets.CreateOffsetsTableStmt)
+	if err != nil {
+		return
+	}
+	_, err = db.Exec(history.CreateAlertHistoryTableStmt)
+	if err != nil {
+		return
+	}
+	_, err = db.Exec(silence.CreateSilencesTableStmt)
+	return
+}
+
+// A stringList is a flag that can be given more than once, collecting every value
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// The alertNotifiers function returns the alert notifiers configured by the command-line
+// flags: a generic webhook for each of `webhooks`, a Slack webhook for each of
+// `slackWebhooks` and a command for `command`, if it is not empty
+func alertNotifiers(webhooks []string, slackWebhooks []string, command string, retries int) (notifiers []notify.Notifier, err error) {
+	for _, format := range []string{notify.Generic, notify.Slack} {
+		urls := webhooks
+		if format == notify.Slack {
+			urls = slackWebhooks
+		}
+		for _, url := range urls {
+			webhook, err := notify.NewWebhook(url, format, retries, notify.DefaultBackoff)
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, webhook)
+		}
+	}
+	if command != "" {
+		notifiers = append(notifiers, notify.NewCommand(command))
+	}
+	return
+}
+
+// The alertRules function returns the alert rules configured by the command-line flags:
+// a traffic rule, a bandwidth rule, a staleness rule and a reader lag rule, unless their
+// thresholds are 0, followed by the rules in the JSON file at `rulesPath`, if it is not empty
+func alertRules(alertThreshold float64, bandwidthAlertThreshold float64, alertInterval int,
+	staleAlertThreshold int, lagAlertThreshold int, rulesPath string) (rules []alerts.Rule, err error) {
+	window := time.Duration(alertInterval) * time.Second
+	if alertThreshold > 0 {
+		rules = append(rules, alerts.Rule{
+			Name:       "traffic",
+			Metric:     alerts.Traffic,
+			Comparison: ">",
+			Threshold:  alertThreshold,
+			Window:     window,
+		})
+	}
+	if bandwidthAlertThreshold > 0 {
+		rules = append(rules, alerts.Rule{
+			Name:       "bandwidth",
+			Metric:     alerts.Bandwidth,
+			Comparison: ">",
+			Threshold:  bandwidthAlertThreshold,
+			Window:     window,
+		})
+	}
+	if staleAlertThreshold > 0 {
+		rules = append(rules, alerts.Rule{
+			Name:       "stale",
+			Metric:     alerts.Staleness,
+			Comparison: ">",
+			Threshold:  float64(staleAlertThreshold),
+		})
+	}
+	if lagAlertThreshold > 0 {
+		rules = append(rules, alerts.Rule{
+			Name:       "lag",
+			Metric:     alerts.LagBytes,
+			Comparison: ">",
+			Threshold:  float64(lagAlertThreshold),
+		})
+	}
+	if rulesPath != "" {
+		fileRules, err := alerts.LoadRules(rulesPath)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+	for _, rule := range rules {
+		err = rule.Validate()
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
+// The alerting struct holds the alert engine and the stores and notifiers that act on
+// its evaluations
+type alerting struct {
+	engine     *alerts.Engine
+	history    *history.Store
+	silences   *silence.Store
+	dispatcher *notify.Dispatcher
+}
+
+// The evaluate method evaluates the alert rules at `now`, records the resulting incidents,
+// ends the acknowledgements of rules that aren't firing and notifies the transitions that aren't
+// muted, telling trackers such as Alertmanager about muted resolutions too. It returns
+// every transition, logging any errors.
+func (a *alerting) evaluate(now time.Time) []alerts.Transition {
+	transitions, err := a.engine.Evaluate(now)
+	if err != nil {
+		log.Printf("Error evaluating alerts: %v", err)
+	}
+	for _, transition := range transitions {
+		log.Printf("Alert %s is %s (value %.2f)", transition.Rule, transition.To, transition.Value)
+	}
+	statuses := a.engine.Statuses()
+	err = a.history.Record(statuses, transitions)
+	if err != nil {
+		log.Printf("Error recording alert history: %v", err)
+	}
+	silences, err := a.silences.Active(now)
+	if err != nil {
+		log.Printf("Error reading alert silences: %v", err)
+	}
+	a.dispatcher.Send(statuses, silence.Notifiable(silences, transitions))
+	a.dispatcher.Untrack(statuses, transitions)
+	err = a.silences.Record(statuses)
+	if err != nil {
+		log.Printf("Error ending alert acknowledgements: %v", err)
+	}
+	return transitions
+}
+
+// The updateUIState method sets the alert statuses, silences and history of `state`
+// as of `now`, logging any errors
+func (a *alerting) updateUIState(state *ui.UIState, now time.Time) {
+	state.Alerts = a.engine.Statuses()
+	silences, err := a.silences.Active(now)
+	if err != nil {
+		log.Printf("Error reading alert silences: %v", err)
+	} else {
+		state.Silences = silences
+	}
+	incidents, err := a.history.Incidents(time.Time{}, now, alertHistoryLimit)
+	if err != nil {
+		log.Printf("Error reading alert history: %v", err)
+	} else {
+		state.AlertHistory = incidents
+	}
+}
+
+// The saveSilences method persists the acknowledgements and silences made from the
+// dashboard since it was last called
+func (a *alerting) saveSilences(state *ui.UIState) {
+	for _, s := range state.SilenceChanges {
+		err := a.silences.Save(s)
+		if err != nil {
+			log.Printf("Error saving alert silence: %v", err)
+		}
+	}
+	state.SilenceChanges = nil
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	flag.Usage = usage
 
-	defaultDebugLogPath := path.Join(os.Getenv("HOME"), ".local", "share", "logr", "logr.log")
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		runQuery(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "alerts" {
+		runAlerts(os.Args[2:])
+		return
+	}
+
 	debugLogPath := flag.String("debugLogPath", defaultDebugLogPath, "The `path` to the file where logr will write debug logs")
 
-	defaultDbPath := path.Join(os.Getenv("HOME"), ".local", "share", "logr", "logr.sqlite")
 	dbPath := flag.String("dbPath", defaultDbPath, "The `path` to the SQLite database")
 
-	alertThreshold := flag.Float64("alertThreshold", defaultAlertThreshold, "The average number of requests per second over the alerting interval that will trigger an alert")
+	alertThreshold := flag.Float64("alertThreshold", defaultAlertThreshold, "The average number of requests per second over the alerting interval that will trigger an alert, or 0 to disable traffic alerts")
+	bandwidthAlertThreshold := flag.Float64("bandwidthAlertThreshold", defaultBandwidthAlertThreshold, "The average number of response bytes per second over the alerting interval that will trigger a bandwidth alert, or 0 to disable bandwidth alerts")
 	alertInterval := flag.Int("alertInterval", defaultAlertInterval, "The interval of time in seconds during which the number of requests per second must exceed the alert threshold to trigger an alert")
+	alertRulesPath := flag.String("alertRules", "", "The `path` to a JSON file of additional alert rules")
+	staleAlertThreshold := flag.Int("staleAlertThreshold", 0, "The number of seconds without new log lines that will trigger a stale alert, or 0 to disable stale alerts")
+	lagAlertThreshold := flag.Int("lagAlertThreshold", 0, "The number of bytes the log reader can fall behind the end of the log file before triggering a lag alert, or 0 to disable lag alerts")
+	var webhooks, slackWebhooks stringList
+	flag.Var(&webhooks, "webhook", "A `URL` to POST a JSON notification to when an alert fires or resolves. May be given more than once")
+	flag.Var(&slackWebhooks, "slackWebhook", "A Slack incoming webhook `URL` to post a message to when an alert fires or resolves. May be given more than once")
+	webhookRetries := flag.Int("webhookRetries", notify.DefaultRetries, "The number of times a failed webhook request is retried, with exponential backoff")
+	alertmanagerURL := flag.String("alertmanagerURL", "", "The base `URL` of a Prometheus Alertmanager to send alerts to, e.g. http://localhost:9093. Sending is disabled if this is empty")
+	alertmanagerInterval := flag.Int("alertmanagerInterval", int(notify.DefaultResendInterval.Seconds()), "The interval in seconds between re-sends of firing alerts to Alertmanager")
+	alertCommand := flag.String("alertCommand", "", "A shell `command` to run when an alert fires or resolves, with the alert's details in LOGR_* environment variables")
 	timescale := flag.Int("timescale", defaultTimescale, "The size of the reporting time window in minutes")
 	granularity := flag.Int("granularity", defaultGranularity, "The granularity of the traffic graph, i.e. the number of buckets into which traffic is divided.")
+	rolling := flag.Bool("rolling", false, "Show the last timescale minutes, sliding the window forward every second instead of jumping forward when it expires")
+	filterExpr := flag.String("filter", "", "A filter `expression` restricting the log lines shown on the dashboard, e.g. 'status>=500 and section=api'")
+	headlessMode := flag.Bool("headless", false, "Run without the dashboard, writing statistics as JSON lines every second instead")
+	metricsAddr := flag.String("metricsAddr", "", "The `address` on which to serve Prometheus metrics at /metrics, e.g. :9100. Metrics are disabled if this is empty")
+	pushAddr := flag.String("pushAddr", "", "The `address` of a StatsD or Graphite server to push metrics to, e.g. localhost:8125. Pushing is disabled if this is empty")
+	pushFormat := flag.String("pushFormat", push.StatsD, "The `protocol` used to push metrics: statsd (UDP) or graphite (TCP plaintext)")
+	pushPrefix := flag.String("pushPrefix", "logr", "The `prefix` prepended to the name of every pushed metric")
+	pushInterval := flag.Int("pushInterval", defaultPushInterval, "The interval in seconds between metric pushes")
+	otlpEndpoint := flag.String("otlpEndpoint", "", "The `URL` of an OTLP/HTTP metrics endpoint to export metrics to, e.g. http://localhost:4318/v1/metrics. Exporting is disabled if this is empty")
+	otlpInterval := flag.Int("otlpInterval", defaultOTLPInterval, "The interval in seconds between OTLP metric exports")
+	headlessOutput := flag.String("headlessOutput", "-", "The `path` to the file where headless mode appends JSON lines, or - for standard output")
 
 	flag.Parse()
 
-	err := os.MkdirAll(path.Dir(*debugLogPath), 0755)
+	logFilter, err := filter.Parse(*filterExpr)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	err = os.Remove(*debugLogPath)
-	if err != nil && !os.IsNotExist(err) {
-		log.Fatal(err)
+
+	rules, err := alertRules(*alertThreshold, *bandwidthAlertThreshold, *alertInterval,
+		*staleAlertThreshold, *lagAlertThreshold, *alertRulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	debugLogFile, err := os.Create(*debugLogPath)
+	notifiers, err := alertNotifiers(webhooks, slackWebhooks, *alertCommand, *webhookRetries)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *alertmanagerURL != "" {
+		alertmanager := notify.NewAlertmanager(*alertmanagerURL, time.Duration(*alertmanagerInterval)*time.Second)
+		notifiers = append(notifiers, alertmanager)
+		go alertmanager.Run()
+		defer alertmanager.Terminate()
 	}
-	defer debugLogFile.Close()
-	log.SetOutput(debugLogFile)
 
-	err = os.MkdirAll(path.Dir(*dbPath), 0755)
+	debugLogFile, err := openDebugLog(*debugLogPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer debugLogFile.Close()
+	log.SetOutput(debugLogFile)
 
 	var logPath string
 	if flag.Arg(0) != "" {
@@ -117,17 +381,112 @@ func main() {
 
 	logTimeSeries := timeseries.LogTimeSeries{db, logPath}
 
-	err = termui.Init()
+	var registry *metrics.Registry
+	if *metricsAddr != "" {
+		registry = metrics.NewRegistry(&logReader)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
+	if *pushAddr != "" {
+		pusher, err := push.NewPusher(&logTimeSeries, *pushAddr, *pushFormat, *pushPrefix,
+			time.Duration(*pushInterval)*time.Second, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		go pusher.Run()
+		defer pusher.Terminate()
+	}
+
+	if *otlpEndpoint != "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatal(err)
+		}
+		exporter, err := otlp.NewExporter(&logTimeSeries, *otlpEndpoint, hostname,
+			time.Duration(*otlpInterval)*time.Second, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		go exporter.Run()
+		defer exporter.Terminate()
+	}
+
+	recordLogLine := func(logLine timeseries.LogLine) {
+		_, err := logTimeSeries.Record(logLine)
+		if err != nil {
+			log.Printf("Error writing log line to database: %v", err)
+		}
+		if registry != nil {
+			registry.Observe(logLine)
+		}
+	}
+
+	alertEngine, err := alerts.NewEngine(&logTimeSeries, rules)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer termui.Close()
+	alertEngine.WatchReader(&logReader)
+	alertHistory := history.Store{db, logPath}
+	err = alertHistory.EndOngoing(time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	dispatcher := notify.NewDispatcher(logPath, notifiers)
+	go dispatcher.Run()
+	defer dispatcher.Terminate()
+	alertSilences := silence.Store{db, logPath}
+	alertPipeline := alerting{alertEngine, &alertHistory, &alertSilences, dispatcher}
 
-	uiState, err := ui.GetInitialUIState(&logTimeSeries, *timescale, *granularity,
-		*alertThreshold, *alertInterval)
+	uiState, err := ui.GetInitialUIState(&logTimeSeries, *timescale, *granularity, logFilter)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *rolling {
+		uiState.Rolling = true
+		ui.NextUIState(uiState, &logTimeSeries, time.Now())
+	}
+	alertPipeline.updateUIState(uiState, time.Now())
+
+	if *headlessMode {
+		output := os.Stdout
+		if *headlessOutput != "-" {
+			output, err = os.OpenFile(*headlessOutput, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer output.Close()
+		}
+		statsWriter := headless.NewWriter(output)
+		for {
+			select {
+			case <-interrupts:
+				logReader.Terminate()
+				return
+			case logLine := <-logChan:
+				recordLogLine(logLine)
+			case <-updateTicker:
+				now := time.Now()
+				transitions := alertPipeline.evaluate(now)
+				uiState := ui.NextUIState(uiState, &logTimeSeries, now)
+				uiState.Alerts = alertEngine.Statuses()
+				err = statsWriter.Write(uiState, transitions, now)
+				if err != nil {
+					log.Printf("Error writing statistics: %v", err)
+				}
+			}
+		}
+	}
+
+	err = termui.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer termui.Close()
+
 	ui.Render(uiState)
 
 	uiEvents := termui.PollEvents()
@@ -144,14 +503,20 @@ func main() {
 				return
 			case "<Resize>":
 				ui.Render(uiState)
+			default:
+				if ui.HandleKey(uiState, e.ID) {
+					alertPipeline.saveSilences(uiState)
+					ui.NextUIState(uiState, &logTimeSeries, time.Now())
+					ui.Render(uiState)
+				}
 			}
 		case logLine := <-logChan:
-			_, err = logTimeSeries.Record(logLine)
-			if err != nil {
-				log.Printf("Error writing log line to database: %v", err)
-			}
+			recordLogLine(logLine)
 		case <-updateTicker:
-			uiState := ui.NextUIState(uiState, &logTimeSeries, time.Now())
+			now := time.Now()
+			alertPipeline.evaluate(now)
+			uiState := ui.NextUIState(uiState, &logTimeSeries, now)
+			alertPipeline.updateUIState(uiState, now)
 			ui.Render(uiState)
 		}
 	}
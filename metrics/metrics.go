@@ -0,0 +1,179 @@
+/*
+Package metrics exports statistics about ingested log lines in the Prometheus text
+exposition format.
+
+A Registry accumulates counters and histograms as log lines are observed, and serves
+them over HTTP so that logr can act as a bridge between a log file and Prometheus.
+See https://prometheus.io/docs/instrumenting/exposition_formats/
+*/
+package metrics
+
+import (
+	"fmt"
+	"github.com/jdormit/logr/timeseries"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DurationBuckets are the upper bounds in seconds of the request duration histogram buckets
+var DurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the upper bounds in bytes of the response size histogram buckets
+var SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// A ReaderProgress reports how far a log reader has got through its log file
+type ReaderProgress interface {
+	Lag() (int64, error)
+	ParseErrors() int64
+}
+
+type requestKey struct {
+	section string
+	status  string
+	method  string
+}
+
+type histogram struct {
+	bounds []float64
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// A Registry holds the metrics derived from observed log lines. It should be
+// instantiated via metrics.NewRegistry().
+type Registry struct {
+	mu            sync.Mutex
+	progress      ReaderProgress
+	requests      map[requestKey]int64
+	sectionBytes  map[string]int64
+	durations     *histogram
+	responseSizes *histogram
+}
+
+// NewRegistry returns an empty Registry. If `progress` is not nil, reader lag and
+// parse errors are read from it whenever the metrics are written.
+func NewRegistry(progress ReaderProgress) *Registry {
+	return &Registry{
+		progress:      progress,
+		requests:      make(map[requestKey]int64),
+		sectionBytes:  make(map[string]int64),
+		durations:     newHistogram(DurationBuckets),
+		responseSizes: newHistogram(SizeBuckets),
+	}
+}
+
+// Observe updates the metrics with a newly ingested log line
+func (r *Registry) Observe(logLine timeseries.LogLine) {
+	section := logLine.Section()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[requestKey{section, strconv.Itoa(int(logLine.Status)), logLine.Method}]++
+	r.sectionBytes[section] += int64(logLine.ResponseBytes)
+	r.responseSizes.observe(float64(logLine.ResponseBytes))
+	if logLine.HasDuration {
+		r.durations.observe(logLine.Duration.Seconds())
+	}
+}
+
+// The escapeLabel function escapes a label value for the text exposition format
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeHistogram(w io.Writer, name string, help string, h *histogram) {
+	writeHeader(w, name, "histogram", help)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// Write writes every metric to `w` in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].section != keys[j].section {
+			return keys[i].section < keys[j].section
+		}
+		if keys[i].status != keys[j].status {
+			return keys[i].status < keys[j].status
+		}
+		return keys[i].method < keys[j].method
+	})
+	writeHeader(w, "logr_requests_total", "counter", "Requests read from the log file.")
+	for _, key := range keys {
+		fmt.Fprintf(w, "logr_requests_total{section=\"%s\",status=\"%s\",method=\"%s\"} %d\n",
+			escapeLabel(key.section), escapeLabel(key.status), escapeLabel(key.method), r.requests[key])
+	}
+
+	sections := make([]string, 0, len(r.sectionBytes))
+	for section := range r.sectionBytes {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	writeHeader(w, "logr_response_bytes_total", "counter", "Response bytes sent, by section.")
+	for _, section := range sections {
+		fmt.Fprintf(w, "logr_response_bytes_total{section=\"%s\"} %d\n",
+			escapeLabel(section), r.sectionBytes[section])
+	}
+
+	writeHistogram(w, "logr_response_size_bytes", "Response sizes in bytes.", r.responseSizes)
+	writeHistogram(w, "logr_request_duration_seconds",
+		"Request durations in seconds, for log lines that include one.", r.durations)
+
+	if r.progress != nil {
+		writeHeader(w, "logr_parse_errors_total", "counter", "Lines in the log file that could not be parsed.")
+		fmt.Fprintf(w, "logr_parse_errors_total %d\n", r.progress.ParseErrors())
+		lag, err := r.progress.Lag()
+		if err != nil {
+			log.Printf("Unable to measure reader lag: %v", err)
+		} else {
+			writeHeader(w, "logr_reader_lag_bytes", "gauge", "Bytes between the reader and the end of the log file.")
+			fmt.Fprintf(w, "logr_reader_lag_bytes %d\n", lag)
+		}
+	}
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
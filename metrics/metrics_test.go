@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/jdormit/logr/timeseries"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeProgress struct {
+	lag         int64
+	lagErr      error
+	parseErrors int64
+}
+
+func (p fakeProgress) Lag() (int64, error) {
+	return p.lag, p.lagErr
+}
+
+func (p fakeProgress) ParseErrors() int64 {
+	return p.parseErrors
+}
+
+func TestWrite(t *testing.T) {
+	testCases := []struct {
+		progress      ReaderProgress
+		logLines      []timeseries.LogLine
+		expectedLines []string
+		missingLines  []string
+	}{
+		{
+			nil,
+			[]timeseries.LogLine{
+				{Method: "GET", Path: "/api/user", Status: 200, ResponseBytes: 150,
+					Duration: 20 * time.Millisecond, HasDuration: true},
+				{Method: "GET", Path: "/api/user", Status: 200, ResponseBytes: 50, HasDuration: true},
+				{Method: "POST", Path: "/re\"port", Status: 500, ResponseBytes: 5000,
+					Duration: 2 * time.Second, HasDuration: true},
+			},
+			[]string{
+				`# TYPE logr_requests_total counter`,
+				`logr_requests_total{section="api",status="200",method="GET"} 2`,
+				`logr_requests_total{section="re\"port",status="500",method="POST"} 1`,
+				`logr_response_bytes_total{section="api"} 200`,
+				`logr_response_bytes_total{section="re\"port"} 5000`,
+				`# TYPE logr_response_size_bytes histogram`,
+				`logr_response_size_bytes_bucket{le="100"} 1`,
+				`logr_response_size_bytes_bucket{le="1000"} 2`,
+				`logr_response_size_bytes_bucket{le="10000"} 3`,
+				`logr_response_size_bytes_bucket{le="+Inf"} 3`,
+				`logr_response_size_bytes_sum 5200`,
+				`logr_request_duration_seconds_bucket{le="0.01"} 1`,
+				`logr_request_duration_seconds_bucket{le="0.025"} 2`,
+				`logr_request_duration_seconds_bucket{le="2.5"} 3`,
+				`logr_request_duration_seconds_sum 2.02`,
+				`logr_request_duration_seconds_count 3`,
+			},
+			[]string{"logr_parse_errors_total", "logr_reader_lag_bytes"},
+		},
+		{
+			fakeProgress{lag: 42, parseErrors: 3},
+			nil,
+			[]string{
+				`logr_parse_errors_total 3`,
+				`# TYPE logr_reader_lag_bytes gauge`,
+				`logr_reader_lag_bytes 42`,
+				`logr_request_duration_seconds_count 0`,
+			},
+			nil,
+		},
+		{
+			fakeProgress{lagErr: errors.New("no such file"), parseErrors: 3},
+			nil,
+			[]string{`logr_parse_errors_total 3`},
+			[]string{"logr_reader_lag_bytes"},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		registry := NewRegistry(testCase.progress)
+		for _, logLine := range testCase.logLines {
+			registry.Observe(logLine)
+		}
+		var out strings.Builder
+		registry.Write(&out)
+		lines := strings.Split(out.String(), "\n")
+		for _, expected := range testCase.expectedLines {
+			found := false
+			for _, line := range lines {
+				if line == expected {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Error on case %d.\nExpected line: %s\nActual output:\n%s",
+					caseIdx, expected, out.String())
+			}
+		}
+		for _, missing := range testCase.missingLines {
+			if strings.Contains(out.String(), missing) {
+				t.Errorf("Error on case %d.\nUnexpected metric: %s\nActual output:\n%s",
+					caseIdx, missing, out.String())
+			}
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	registry := NewRegistry(nil)
+	registry.Observe(timeseries.LogLine{Method: "GET", Path: "/report", Status: 200})
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/plain; version=0.0.4" {
+		t.Errorf("Unexpected content type %s", contentType)
+	}
+	expected := `logr_requests_total{section="report",status="200",method="GET"} 1`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("Expected body to contain %s\nActual:\n%s", expected, body)
+	}
+}
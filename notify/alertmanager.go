@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jdormit/logr/alerts"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertsPath is the path of the Alertmanager v2 API endpoint alerts are posted to
+const alertsPath = "/api/v2/alerts"
+
+// DefaultResendInterval is the default interval between re-sends of firing alerts
+const DefaultResendInterval = time.Minute
+
+// An AlertmanagerAlert is an alert in the format of the Alertmanager v2 API
+type AlertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// An Alertmanager forwards notifications to a Prometheus Alertmanager. Alertmanager
+// resolves alerts that are not re-sent before their end time, so while a rule is
+// firing its alert is re-sent every resend interval with an end time four intervals
+// later, as Prometheus does. It should be instantiated via notify.NewAlertmanager().
+type Alertmanager struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	mu       sync.Mutex
+	// firing holds the notification that started each firing alert, by rule name
+	firing     map[string]Notification
+	terminated chan bool
+}
+
+// NewAlertmanager returns an Alertmanager that posts alerts to the Alertmanager at
+// `baseURL`, e.g. http://localhost:9093, re-sending firing alerts every `interval`
+func NewAlertmanager(baseURL string, interval time.Duration) *Alertmanager {
+	return &Alertmanager{
+		url:        strings.TrimSuffix(baseURL, "/") + alertsPath,
+		interval:   interval,
+		client:     &http.Client{Timeout: webhookTimeout},
+		firing:     make(map[string]Notification),
+		terminated: make(chan bool),
+	}
+}
+
+// The alert method returns `notification` as an Alertmanager alert that ends at `endsAt`
+func (am *Alertmanager) alert(notification Notification, endsAt time.Time) AlertmanagerAlert {
+	labels := map[string]string{
+		"alertname": notification.Alert,
+		"rule":      notification.Alert,
+		"log_file":  notification.LogFile,
+	}
+	if notification.Section != "" {
+		labels["section"] = notification.Section
+	}
+	annotations := map[string]string{
+		"summary":     notification.Summary(),
+		"description": notification.Condition,
+		"value":       fmt.Sprintf("%.2f", notification.Value),
+	}
+	if notification.Label != "" {
+		annotations["label"] = notification.Label
+	}
+	return AlertmanagerAlert{labels, annotations, notification.Time, endsAt}
+}
+
+// Alerts returns the alerts to send at `now`: one for each firing rule in order of
+// rule name, ending four resend intervals after `now`
+func (am *Alertmanager) Alerts(now time.Time) []AlertmanagerAlert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	names := make([]string, 0, len(am.firing))
+	for name := range am.firing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	batch := make([]AlertmanagerAlert, 0, len(names))
+	for _, name := range names {
+		batch = append(batch, am.alert(am.firing[name], now.Add(4*am.interval)))
+	}
+	return batch
+}
+
+// Notify sends the alert for `notification`. A resolved alert is sent with its
+// resolution time as its end time and is no longer re-sent.
+func (am *Alertmanager) Notify(notification Notification) error {
+	am.mu.Lock()
+	var alert AlertmanagerAlert
+	if notification.State == alerts.Firing {
+		am.firing[notification.Alert] = notification
+		alert = am.alert(notification, notification.Time.Add(4*am.interval))
+	} else {
+		// Alertmanager identifies alerts by their labels, but keep the original start
+		if started, ok := am.firing[notification.Alert]; ok {
+			delete(am.firing, notification.Alert)
+			alert = am.alert(notification, notification.Time)
+			alert.StartsAt = started.Time
+		} else {
+			alert = am.alert(notification, notification.Time)
+		}
+	}
+	am.mu.Unlock()
+	return am.post([]AlertmanagerAlert{alert})
+}
+
+// Tracking returns true if the alert of the rule named `alert` is being re-sent
+func (am *Alertmanager) Tracking(alert string) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	_, ok := am.firing[alert]
+	return ok
+}
+
+// Resend re-sends the alerts of every firing rule as of `now`
+func (am *Alertmanager) Resend(now time.Time) error {
+	batch := am.Alerts(now)
+	if len(batch) == 0 {
+		return nil
+	}
+	return am.post(batch)
+}
+
+// Run re-sends firing alerts every resend interval until a call to Alertmanager.Terminate()
+func (am *Alertmanager) Run() {
+	ticker := time.NewTicker(am.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-am.terminated:
+			return
+		case now := <-ticker.C:
+			err := am.Resend(now)
+			if err != nil {
+				log.Printf("Error re-sending alerts to Alertmanager: %v", err)
+			}
+		}
+	}
+}
+
+// Terminate stops a running Alertmanager
+func (am *Alertmanager) Terminate() {
+	close(am.terminated)
+}
+
+// The post method posts `batch` to the Alertmanager
+func (am *Alertmanager) post(batch []AlertmanagerAlert) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := am.client.Post(am.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &WebhookError{am.url, resp.StatusCode, string(respBody)}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The alertmanagerServer function returns a stub Alertmanager that records the
+// alerts posted to its v2 API
+func alertmanagerServer(t *testing.T) (server *httptest.Server, posts *[][]AlertmanagerAlert) {
+	posts = new([][]AlertmanagerAlert)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v2/alerts" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var batch []AlertmanagerAlert
+		err := json.NewDecoder(r.Body).Decode(&batch)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*posts = append(*posts, batch)
+	}))
+	return
+}
+
+func TestAlertmanager(t *testing.T) {
+	server, posts := alertmanagerServer(t)
+	defer server.Close()
+	am := NewAlertmanager(server.URL+"/", time.Minute)
+
+	api := firing
+	api.Alert = "api"
+	api.Condition = "traffic > 5 requests/second over 1m0s in section api"
+	api.Section = "api"
+	api.Time = now.Add(30 * time.Second)
+	resolved := firing
+	resolved.State = alerts.Resolved
+	resolved.From = alerts.Firing
+	resolved.Time = now.Add(3 * time.Minute)
+	resolved.Value = 2
+
+	trafficLabels := map[string]string{"alertname": "traffic", "rule": "traffic", "log_file": logFile}
+	trafficAnnotations := map[string]string{
+		"summary":     firing.Summary(),
+		"description": "traffic > 10 requests/second over 2m0s",
+		"value":       "12.50",
+	}
+	apiAlert := AlertmanagerAlert{
+		map[string]string{"alertname": "api", "rule": "api", "log_file": logFile, "section": "api"},
+		map[string]string{
+			"summary":     api.Summary(),
+			"description": "traffic > 5 requests/second over 1m0s in section api",
+			"value":       "12.50",
+		},
+		api.Time,
+		now.Add(6 * time.Minute),
+	}
+
+	steps := []struct {
+		send     func() error
+		expected [][]AlertmanagerAlert
+	}{
+		{
+			func() error { return am.Notify(firing) },
+			[][]AlertmanagerAlert{
+				{{trafficLabels, trafficAnnotations, now, now.Add(4 * time.Minute)}},
+			},
+		},
+		{
+			func() error { return am.Notify(api) },
+			[][]AlertmanagerAlert{
+				{{
+					apiAlert.Labels, apiAlert.Annotations, api.Time, api.Time.Add(4 * time.Minute),
+				}},
+			},
+		},
+		// Firing alerts are re-sent with a later end time
+		{
+			func() error { return am.Resend(now.Add(2 * time.Minute)) },
+			[][]AlertmanagerAlert{
+				{apiAlert, {trafficLabels, trafficAnnotations, now, now.Add(6 * time.Minute)}},
+			},
+		},
+		// A resolved alert keeps its start time and ends when it resolved
+		{
+			func() error { return am.Notify(resolved) },
+			[][]AlertmanagerAlert{
+				{{trafficLabels, map[string]string{
+					"summary":     resolved.Summary(),
+					"description": "traffic > 10 requests/second over 2m0s",
+					"value":       "2.00",
+				}, now, now.Add(3 * time.Minute)}},
+			},
+		},
+		// Resolved alerts are no longer re-sent
+		{
+			func() error { return am.Resend(now.Add(2 * time.Minute)) },
+			[][]AlertmanagerAlert{{apiAlert}},
+		},
+	}
+	for stepIdx, step := range steps {
+		*posts = nil
+		err := step.send()
+		if err != nil {
+			t.Fatalf("Error on step %d: %v", stepIdx, err)
+		}
+		if !cmp.Equal(step.expected, *posts) {
+			t.Errorf("Error on step %d.\nExpected: %+v\nActual: %+v", stepIdx, step.expected, *posts)
+		}
+	}
+}
+
+func TestAlertmanagerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid alert"))
+	}))
+	defer server.Close()
+	err := NewAlertmanager(server.URL, time.Minute).Notify(firing)
+	if err == nil || !strings.HasSuffix(err.Error(), "responded with status 400: invalid alert") {
+		t.Errorf("Expected the Alertmanager's status and response in the error, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// A Command runs a shell command for every notification, with the notification
+// in its environment:
+//
+//	LOGR_ALERT            the name of the alert rule
+//	LOGR_ALERT_STATE      firing or resolved
+//	LOGR_ALERT_FROM       the rule's previous state
+//	LOGR_ALERT_TIME       when the rule changed state, in RFC 3339 format
+//	LOGR_ALERT_VALUE      the value of the rule's metric
+//	LOGR_ALERT_LABEL      the section or host with the highest value, for grouped rules
+//	LOGR_ALERT_CONDITION  a description of the rule
+//	LOGR_ALERT_SUMMARY    a one-line summary of the notification
+//	LOGR_LOG_FILE         the log file being monitored
+type Command struct {
+	command string
+}
+
+// NewCommand returns a Command that runs `command` with `sh -c`
+func NewCommand(command string) *Command {
+	return &Command{command}
+}
+
+// The env function returns the environment variables describing `notification`
+func env(notification Notification) []string {
+	return []string{
+		"LOGR_ALERT=" + notification.Alert,
+		"LOGR_ALERT_STATE=" + notification.State.String(),
+		"LOGR_ALERT_FROM=" + notification.From.String(),
+		"LOGR_ALERT_TIME=" + notification.Time.Format(time.RFC3339),
+		"LOGR_ALERT_VALUE=" + strconv.FormatFloat(notification.Value, 'f', -1, 64),
+		"LOGR_ALERT_LABEL=" + notification.Label,
+		"LOGR_ALERT_CONDITION=" + notification.Condition,
+		"LOGR_ALERT_SUMMARY=" + notification.Summary(),
+		"LOGR_LOG_FILE=" + notification.LogFile,
+	}
+}
+
+// Notify runs the command and waits for it to exit
+func (c *Command) Notify(notification Notification) error {
+	cmd := exec.Command("sh", "-c", c.command)
+	cmd.Env = append(os.Environ(), env(notification)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Alert command %q failed: %v: %s", c.command, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "alert.txt")
+	command := NewCommand(`echo "$LOGR_ALERT $LOGR_ALERT_STATE $LOGR_ALERT_FROM $LOGR_ALERT_TIME $LOGR_ALERT_VALUE` +
+		` $LOGR_LOG_FILE" > ` + output)
+	err := command.Notify(firing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "traffic firing pending 2018-05-09T16:00:00Z 12.5 /tmp/access.log\n"
+	if string(actual) != expected {
+		t.Errorf("Expected: %q\nActual: %q", expected, actual)
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	err := NewCommand("echo oops; exit 3").Notify(firing)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: oops") {
+		t.Errorf("Expected the command's exit status and output in the error, got %v", err)
+	}
+}
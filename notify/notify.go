@@ -0,0 +1,191 @@
+/*
+Package notify sends alert notifications to places other than the dashboard.
+
+When an alert rule starts firing or resolves, a Dispatcher builds a Notification
+describing it and passes it to every configured Notifier: a Webhook POSTs it as JSON,
+either in logr's own format or as a Slack message, a Command runs a local command
+with the notification in its environment, and an Alertmanager forwards it to a
+Prometheus Alertmanager. Notifiers run on the Dispatcher's own
+goroutine, so that a slow webhook doesn't hold up alert evaluation.
+
+An Alertmanager is a Tracker: it keeps re-sending the alerts it was told are firing,
+so it is told when they resolve even if the resolution itself is muted.
+*/
+package notify
+
+import (
+	"fmt"
+	"github.com/jdormit/logr/alerts"
+	"log"
+	"time"
+)
+
+// queueSize is the number of notifications a Dispatcher holds before dropping new ones
+const queueSize = 64
+
+// A Notification describes an alert rule starting to fire or resolving
+type Notification struct {
+	Alert string       `json:"alert"`
+	State alerts.State `json:"state"`
+	From  alerts.State `json:"from"`
+	Time  time.Time    `json:"time"`
+	Value float64      `json:"value"`
+	// Label is the section or host with the highest value, for rules with a GroupBy
+	Label     string `json:"label,omitempty"`
+	Condition string `json:"condition"`
+	// Section is the section the rule is scoped to, if any
+	Section string `json:"section,omitempty"`
+	LogFile string `json:"logFile"`
+}
+
+// Summary describes the notification in a single line of text, e.g.
+// "[FIRING] traffic: traffic > 10 requests/second over 2m0s (currently 12.50) on /tmp/access.log"
+func (n Notification) Summary() string {
+	current := fmt.Sprintf("%.2f", n.Value)
+	if n.Label != "" {
+		current = fmt.Sprintf("%s for %s", current, n.Label)
+	}
+	if n.State == alerts.Firing {
+		return fmt.Sprintf("[FIRING] %s: %s (currently %s) on %s", n.Alert, n.Condition, current, n.LogFile)
+	}
+	return fmt.Sprintf("[RESOLVED] %s: %s (currently %s) on %s", n.Alert, n.Condition, current, n.LogFile)
+}
+
+// Notifications returns a notification for every transition in `transitions` in which
+// a rule started firing or resolved. The conditions of the rules are taken from `statuses`.
+func Notifications(logFile string, statuses []alerts.Status, transitions []alerts.Transition) []Notification {
+	rules := make(map[string]alerts.Rule)
+	for _, status := range statuses {
+		rules[status.Rule.Name] = status.Rule
+	}
+	notifications := make([]Notification, 0)
+	for _, transition := range transitions {
+		if transition.To != alerts.Firing && transition.To != alerts.Resolved {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			Alert:     transition.Rule,
+			State:     transition.To,
+			From:      transition.From,
+			Time:      transition.Time,
+			Value:     transition.Value,
+			Label:     transition.Label,
+			Condition: rules[transition.Rule].String(),
+			Section:   rules[transition.Rule].Section,
+			LogFile:   logFile,
+		})
+	}
+	return notifications
+}
+
+// A Notifier delivers a notification
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// A Tracker is a Notifier that keeps track of the alerts that are firing
+type Tracker interface {
+	Notifier
+	// Tracking returns true if the tracker holds `alert` as firing
+	Tracking(alert string) bool
+}
+
+// A delivery is a queued notification. Untrack is true for the resolutions of muted
+// alerts, which are only delivered to the trackers still holding them as firing.
+type delivery struct {
+	notification Notification
+	untrack      bool
+}
+
+// A Dispatcher passes notifications to a set of notifiers. It should be instantiated
+// via notify.NewDispatcher().
+type Dispatcher struct {
+	logFile    string
+	notifiers  []Notifier
+	queue      chan delivery
+	terminated chan bool
+}
+
+// NewDispatcher returns a Dispatcher that sends notifications about the alerts on
+// `logFile` to each of `notifiers`
+func NewDispatcher(logFile string, notifiers []Notifier) *Dispatcher {
+	return &Dispatcher{logFile, notifiers, make(chan delivery, queueSize), make(chan bool)}
+}
+
+// Send queues a notification for every rule in `transitions` that started firing or
+// resolved. If the queue is full, the notification is dropped and logged.
+func (d *Dispatcher) Send(statuses []alerts.Status, transitions []alerts.Transition) {
+	d.enqueue(statuses, transitions, false)
+}
+
+// Untrack queues the resolutions in `transitions` for the trackers that still hold
+// their rules as firing, so that the trackers hear about resolutions that aren't sent
+// because they are muted. Resolutions that are also sent reach each tracker once.
+func (d *Dispatcher) Untrack(statuses []alerts.Status, transitions []alerts.Transition) {
+	resolved := make([]alerts.Transition, 0, len(transitions))
+	for _, transition := range transitions {
+		if transition.To == alerts.Resolved {
+			resolved = append(resolved, transition)
+		}
+	}
+	d.enqueue(statuses, resolved, true)
+}
+
+func (d *Dispatcher) enqueue(statuses []alerts.Status, transitions []alerts.Transition, untrack bool) {
+	if len(d.notifiers) == 0 {
+		return
+	}
+	for _, notification := range Notifications(d.logFile, statuses, transitions) {
+		select {
+		case d.queue <- delivery{notification, untrack}:
+		default:
+			log.Printf("Dropped alert notification: %s", notification.Summary())
+		}
+	}
+}
+
+// Run delivers queued notifications until a call to Dispatcher.Terminate()
+func (d *Dispatcher) Run() {
+	for {
+		select {
+		case <-d.terminated:
+			return
+		case queued := <-d.queue:
+			d.deliver(queued)
+		}
+	}
+}
+
+// Terminate stops a running Dispatcher
+func (d *Dispatcher) Terminate() {
+	close(d.terminated)
+}
+
+// Dispatch delivers `notification` to every notifier in turn, logging any errors
+func (d *Dispatcher) Dispatch(notification Notification) {
+	for _, notifier := range d.notifiers {
+		err := notifier.Notify(notification)
+		if err != nil {
+			log.Printf("Error sending alert notification: %v", err)
+		}
+	}
+}
+
+// The deliver method dispatches a queued notification, or passes the resolution of a
+// muted alert to the trackers still holding it as firing
+func (d *Dispatcher) deliver(queued delivery) {
+	if !queued.untrack {
+		d.Dispatch(queued.notification)
+		return
+	}
+	for _, notifier := range d.notifiers {
+		tracker, ok := notifier.(Tracker)
+		if !ok || !tracker.Tracking(queued.notification.Alert) {
+			continue
+		}
+		err := tracker.Notify(queued.notification)
+		if err != nil {
+			log.Printf("Error sending alert notification: %v", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"testing"
+	"time"
+)
+
+const logFile = "/tmp/access.log"
+
+var now = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+var traffic = alerts.Rule{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 10,
+	Window: 2 * time.Minute}
+
+var firing = Notification{
+	Alert:     "traffic",
+	State:     alerts.Firing,
+	From:      alerts.Pending,
+	Time:      now,
+	Value:     12.5,
+	Condition: "traffic > 10 requests/second over 2m0s",
+	LogFile:   logFile,
+}
+
+func TestNotifications(t *testing.T) {
+	statuses := []alerts.Status{{Rule: traffic, State: alerts.Firing, Since: now, Value: 12.5}}
+	testCases := []struct {
+		transitions []alerts.Transition
+		expected    []Notification
+	}{
+		{nil, []Notification{}},
+		// Rules becoming pending or inactive aren't notified
+		{
+			[]alerts.Transition{
+				{"traffic", alerts.Inactive, alerts.Pending, now, 12.5, ""},
+				{"traffic", alerts.Pending, alerts.Inactive, now, 2, ""},
+			},
+			[]Notification{},
+		},
+		{
+			[]alerts.Transition{{"traffic", alerts.Pending, alerts.Firing, now, 12.5, ""}},
+			[]Notification{firing},
+		},
+		{
+			[]alerts.Transition{{"traffic", alerts.Firing, alerts.Resolved, now, 2, "api"}},
+			[]Notification{{"traffic", alerts.Resolved, alerts.Firing, now, 2, "api",
+				"traffic > 10 requests/second over 2m0s", "", logFile}},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		actual := Notifications(logFile, statuses, testCase.transitions)
+		if !cmp.Equal(testCase.expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	resolved := firing
+	resolved.State = alerts.Resolved
+	resolved.From = alerts.Firing
+	resolved.Value = 2
+	resolved.Label = "api"
+	testCases := []struct {
+		notification Notification
+		expected     string
+	}{
+		{firing, "[FIRING] traffic: traffic > 10 requests/second over 2m0s (currently 12.50) on /tmp/access.log"},
+		{resolved, "[RESOLVED] traffic: traffic > 10 requests/second over 2m0s (currently 2.00 for api) on /tmp/access.log"},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := testCase.notification.Summary(); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+// A recorder is a Notifier that sends every notification it receives to a channel
+type recorder chan Notification
+
+func (r recorder) Notify(notification Notification) error {
+	r <- notification
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	first, second := make(recorder, 1), make(recorder, 1)
+	dispatcher := NewDispatcher(logFile, []Notifier{first, second})
+	go dispatcher.Run()
+	defer dispatcher.Terminate()
+	dispatcher.Send([]alerts.Status{{Rule: traffic, State: alerts.Firing, Since: now, Value: 12.5}},
+		[]alerts.Transition{{"traffic", alerts.Pending, alerts.Firing, now, 12.5, ""}})
+	for i, notifier := range []recorder{first, second} {
+		select {
+		case notification := <-notifier:
+			if !cmp.Equal(firing, notification) {
+				t.Errorf("Error on notifier %d.\nExpected: %+v\nActual: %+v", i, firing, notification)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Notifier %d did not receive a notification", i)
+		}
+	}
+}
+
+func TestUntrack(t *testing.T) {
+	server, posts := alertmanagerServer(t)
+	defer server.Close()
+	am := NewAlertmanager(server.URL, time.Minute)
+	other := make(recorder, 4)
+	dispatcher := NewDispatcher(logFile, []Notifier{other, am})
+	statuses := []alerts.Status{{Rule: traffic, State: alerts.Resolved, Since: now.Add(3 * time.Minute), Value: 2}}
+	fired := []alerts.Transition{{Rule: "traffic", From: alerts.Pending, To: alerts.Firing, Time: now, Value: 12.5}}
+	resolved := []alerts.Transition{
+		{Rule: "traffic", From: alerts.Firing, To: alerts.Resolved, Time: now.Add(3 * time.Minute), Value: 2},
+	}
+	deliverAll := func() {
+		for len(dispatcher.queue) > 0 {
+			dispatcher.deliver(<-dispatcher.queue)
+		}
+	}
+	dispatcher.Send(statuses, fired)
+	dispatcher.Untrack(statuses, fired)
+	deliverAll()
+	if !am.Tracking("traffic") || len(other) != 1 {
+		t.Fatalf("Expected the firing alert to reach both notifiers once")
+	}
+	<-other
+
+	// The rule is silenced while it fires, so its resolution is muted
+	*posts = nil
+	dispatcher.Send(statuses, nil)
+	dispatcher.Untrack(statuses, resolved)
+	deliverAll()
+	if len(other) != 0 {
+		t.Errorf("Expected the muted resolution not to be notified, got %+v", <-other)
+	}
+	if len(*posts) != 1 || len((*posts)[0]) != 1 || !(*posts)[0][0].EndsAt.Equal(now.Add(3*time.Minute)) {
+		t.Errorf("Expected the muted resolution to end the alert in Alertmanager, got %+v", *posts)
+	}
+	*posts = nil
+	err := am.Resend(now.Add(4 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*posts) != 0 {
+		t.Errorf("Expected the resolved alert not to be re-sent, got %+v", *posts)
+	}
+
+	// A resolution that is notified reaches the Alertmanager once
+	dispatcher.Send(statuses, fired)
+	deliverAll()
+	<-other
+	*posts = nil
+	dispatcher.Send(statuses, resolved)
+	dispatcher.Untrack(statuses, resolved)
+	deliverAll()
+	if len(*posts) != 1 || len(other) != 1 {
+		t.Errorf("Expected the resolution to be sent once to each notifier, got %d posts and %d notifications",
+			len(*posts), len(other))
+	}
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The supported webhook payload formats
+const (
+	// Generic webhooks receive the Notification as a JSON object
+	Generic = "generic"
+	// Slack webhooks receive a Slack incoming webhook message, {"text": "..."}
+	Slack = "slack"
+)
+
+// DefaultRetries is the default number of times a failed webhook request is retried
+const DefaultRetries = 3
+
+// DefaultBackoff is the default delay before the first retry. Each later retry
+// waits twice as long as the one before.
+const DefaultBackoff = time.Second
+
+// webhookTimeout bounds each webhook request
+const webhookTimeout = 10 * time.Second
+
+// An UnknownFormatError is returned when a Webhook is created with an unsupported format
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return fmt.Sprintf("Unknown webhook format %q: expected %s or %s", e.Format, Generic, Slack)
+}
+
+// A WebhookError is returned when a webhook responds with a non-2xx status
+type WebhookError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("Webhook %s responded with status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// A Webhook POSTs notifications to a URL. It should be instantiated via notify.NewWebhook().
+type Webhook struct {
+	url     string
+	format  string
+	retries int
+	backoff time.Duration
+	client  *http.Client
+	sleep   func(time.Duration)
+}
+
+// NewWebhook returns a Webhook that POSTs notifications to `url` in `format`.
+// Requests that fail with a network error, a 429 or a 5xx status are retried up to
+// `retries` times, first after `backoff` and then with the delay doubling each time.
+func NewWebhook(url string, format string, retries int, backoff time.Duration) (webhook *Webhook, err error) {
+	if format != Generic && format != Slack {
+		return nil, &UnknownFormatError{format}
+	}
+	return &Webhook{url, format, retries, backoff, &http.Client{Timeout: webhookTimeout}, time.Sleep}, nil
+}
+
+// The payload method returns the JSON body of the request for `notification`
+func (w *Webhook) payload(notification Notification) ([]byte, error) {
+	if w.format == Slack {
+		return json.Marshal(map[string]string{"text": notification.Summary()})
+	}
+	return json.Marshal(notification)
+}
+
+// Notify POSTs `notification` to the webhook, retrying failed requests
+func (w *Webhook) Notify(notification Notification) (err error) {
+	body, err := w.payload(notification)
+	if err != nil {
+		return
+	}
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.post(body)
+		if err == nil || !retry || attempt == w.retries {
+			return
+		}
+		w.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// The post method makes a single request with `body`, and returns whether a
+// failed request should be retried
+func (w *Webhook) post(body []byte) (retry bool, err error) {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, &WebhookError{w.url, resp.StatusCode, string(respBody)}
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The webhookServer function returns a server that responds to each request with the
+// next status in `statuses`, or 200 once they run out, and records the request bodies
+func webhookServer(statuses []int) (server *httptest.Server, bodies *[]string) {
+	bodies = new([]string)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*bodies = append(*bodies, string(body))
+		status := http.StatusOK
+		if len(*bodies) <= len(statuses) {
+			status = statuses[len(*bodies)-1]
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	return
+}
+
+func TestWebhookPayload(t *testing.T) {
+	expectedGeneric, _ := json.Marshal(map[string]interface{}{
+		"alert":     "traffic",
+		"state":     "firing",
+		"from":      "pending",
+		"time":      "2018-05-09T16:00:00Z",
+		"value":     12.5,
+		"condition": "traffic > 10 requests/second over 2m0s",
+		"logFile":   logFile,
+	})
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{Generic, string(expectedGeneric)},
+		{Slack, `{"text":"[FIRING] traffic: traffic > 10 requests/second over 2m0s (currently 12.50) on /tmp/access.log"}`},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			server, bodies := webhookServer(nil)
+			defer server.Close()
+			webhook, err := NewWebhook(server.URL, testCase.format, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = webhook.Notify(firing)
+			if err != nil {
+				t.Error(err)
+			}
+			var expected, actual interface{}
+			json.Unmarshal([]byte(testCase.expected), &expected)
+			json.Unmarshal([]byte((*bodies)[0]), &actual)
+			if len(*bodies) != 1 || !cmp.Equal(expected, actual) {
+				t.Errorf("Error on test case %d.\nExpected: %s\nActual: %v", caseIdx, testCase.expected, *bodies)
+			}
+		}()
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	testCases := []struct {
+		statuses         []int
+		retries          int
+		expectedRequests int
+		expectedBackoffs []time.Duration
+		expectedError    string
+	}{
+		{nil, 3, 1, []time.Duration{}, ""},
+		// Server errors and rate limiting are retried with exponential backoff...
+		{[]int{500, 429}, 3, 3, []time.Duration{time.Second, 2 * time.Second}, ""},
+		// ...up to the retry limit
+		{[]int{503, 503, 503}, 2, 3, []time.Duration{time.Second, 2 * time.Second},
+			"responded with status 503: Service Unavailable"},
+		// Client errors are not retried
+		{[]int{400}, 3, 1, []time.Duration{}, "responded with status 400: Bad Request"},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			server, bodies := webhookServer(testCase.statuses)
+			defer server.Close()
+			webhook, err := NewWebhook(server.URL, Generic, testCase.retries, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backoffs := make([]time.Duration, 0)
+			webhook.sleep = func(d time.Duration) { backoffs = append(backoffs, d) }
+			err = webhook.Notify(firing)
+			actualError := ""
+			if err != nil {
+				actualError = err.Error()[len("Webhook "+server.URL+" "):]
+			}
+			if actualError != testCase.expectedError {
+				t.Errorf("Error on test case %d.\nExpected error: %q\nActual: %q", caseIdx, testCase.expectedError, actualError)
+			}
+			if len(*bodies) != testCase.expectedRequests {
+				t.Errorf("Error on test case %d.\nExpected %d requests, got %d", caseIdx, testCase.expectedRequests, len(*bodies))
+			}
+			if !cmp.Equal(testCase.expectedBackoffs, backoffs) {
+				t.Errorf("Error on test case %d.\nExpected backoffs: %v\nActual: %v", caseIdx, testCase.expectedBackoffs, backoffs)
+			}
+		}()
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	_, err := NewWebhook("http://localhost", "teams", 0, 0)
+	if err == nil || err.Error() != `Unknown webhook format "teams": expected generic or slack` {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Package otlp exports metrics derived from the stored log lines to an OpenTelemetry
+collector using OTLP over HTTP.
+
+Every export interval, an Exporter queries the log lines recorded since the previous
+export and posts them to the collector as JSON-encoded OTLP metrics with delta
+temporality:
+
+	logr.requests            a sum of requests by section
+	logr.responses           a sum of responses by status code
+	logr.response.bytes      a sum of response bytes by section
+	logr.response.size       a histogram of response sizes in bytes
+	logr.request.duration    a histogram of request durations in seconds
+
+The histograms use the same bucket bounds as the Prometheus exporter in package metrics.
+Every export carries resource attributes naming the log file and the host logr runs on.
+Like pushes, exports cover consecutive windows of log timestamps, so a log line recorded
+after its window has been exported is left out.
+*/
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jdormit/logr/flusher"
+	"github.com/jdormit/logr/metrics"
+	"github.com/jdormit/logr/timeseries"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const scopeName = "github.com/jdormit/logr/otlp"
+
+// The value of AggregationTemporality for delta metrics in the OTLP data model
+const deltaTemporality = 1
+
+const exportTimeout = 10 * time.Second
+
+// The following types mirror the JSON encoding of the OTLP ExportMetricsServiceRequest.
+// 64-bit integers are encoded as strings, as required by the protobuf JSON mapping.
+
+// A MetricsRequest is the body of an OTLP/HTTP metrics export
+type MetricsRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeMetrics struct {
+	Scope   Scope    `json:"scope"`
+	Metrics []Metric `json:"metrics"`
+}
+
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// A Metric holds either a Sum or a Histogram
+type Metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *Sum       `json:"sum,omitempty"`
+	Histogram   *Histogram `json:"histogram,omitempty"`
+}
+
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             string     `json:"asInt"`
+}
+
+type Histogram struct {
+	DataPoints             []HistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type HistogramDataPoint struct {
+	StartTimeUnixNano string    `json:"startTimeUnixNano"`
+	TimeUnixNano      string    `json:"timeUnixNano"`
+	Count             string    `json:"count"`
+	Sum               float64   `json:"sum"`
+	BucketCounts      []string  `json:"bucketCounts"`
+	ExplicitBounds    []float64 `json:"explicitBounds"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func attribute(key string, value string) KeyValue {
+	return KeyValue{key, AnyValue{value}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// An ExportError is returned when the collector rejects an export
+type ExportError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("OTLP export failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// An Exporter posts metrics to an OTLP/HTTP endpoint. It should be instantiated
+// via otlp.NewExporter().
+type Exporter struct {
+	ts       *timeseries.LogTimeSeries
+	endpoint string
+	hostname string
+	client   *http.Client
+	flusher  *flusher.Flusher
+}
+
+// NewExporter returns an Exporter that posts metrics about the log lines in `ts` to
+// `endpoint`, e.g. http://localhost:4318/v1/metrics, every `interval`. `hostname` is
+// reported as the host.name resource attribute. Only log lines recorded after `start`
+// are exported. The interval must be at least a second.
+func NewExporter(ts *timeseries.LogTimeSeries, endpoint string, hostname string, interval time.Duration, start time.Time) (exporter *Exporter, err error) {
+	exporter = &Exporter{
+		ts:       ts,
+		endpoint: endpoint,
+		hostname: hostname,
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+	exporter.flusher, err = flusher.NewFlusher(interval, start, exporter.export)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid OTLP export interval: %v", err)
+	}
+	return
+}
+
+// Run exports metrics every interval until a call to Exporter.Terminate()
+func (e *Exporter) Run() {
+	e.flusher.Run(func(err error) {
+		log.Printf("Error exporting metrics to %s: %v", e.endpoint, err)
+	})
+}
+
+// Terminate stops a running Exporter
+func (e *Exporter) Terminate() {
+	e.flusher.Terminate()
+}
+
+// Export posts the metrics for the log lines recorded between the previous export and `now`
+func (e *Exporter) Export(now time.Time) error {
+	return e.flusher.Flush(now)
+}
+
+// The export method posts the metrics for the log lines recorded from `start` up to
+// but not including `end`
+func (e *Exporter) export(start time.Time, end time.Time) (err error) {
+	request, err := e.NewRequest(start, end)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &ExportError{resp.StatusCode, string(respBody)}
+	}
+	return
+}
+
+// NewRequest returns the export request for the log lines recorded from `start` up to
+// but not including `end`. Both must be whole seconds.
+func (e *Exporter) NewRequest(start time.Time, end time.Time) (request MetricsRequest, err error) {
+	last := flusher.Last(end)
+
+	sectionCounts, err := e.ts.GetSectionCounts(start, last, nil)
+	if err != nil {
+		return
+	}
+	statusCounts, err := e.ts.GetStatusCounts(start, last, nil)
+	if err != nil {
+		return
+	}
+	sectionBytes, err := e.ts.GetSectionBytes(start, last, nil)
+	if err != nil {
+		return
+	}
+	logLines, err := e.ts.GetLogLines(start, last, nil)
+	if err != nil {
+		return
+	}
+
+	sizes := make([]float64, 0, len(logLines))
+	durations := make([]float64, 0, len(logLines))
+	for _, logLine := range logLines {
+		sizes = append(sizes, float64(logLine.ResponseBytes))
+		if logLine.HasDuration {
+			durations = append(durations, logLine.Duration.Seconds())
+		}
+	}
+
+	request.ResourceMetrics = []ResourceMetrics{{
+		Resource: Resource{[]KeyValue{
+			attribute("service.name", "logr"),
+			attribute("log.file.path", e.ts.LogFile),
+			attribute("host.name", e.hostname),
+		}},
+		ScopeMetrics: []ScopeMetrics{{
+			Scope: Scope{scopeName},
+			Metrics: []Metric{
+				sum("logr.requests", "Requests by section", "{request}", "section", sectionCounts, start, end),
+				sum("logr.responses", "Responses by status code", "{response}", "status", statusCounts, start, end),
+				sum("logr.response.bytes", "Response bytes by section", "By", "section", sectionBytes, start, end),
+				histogram("logr.response.size", "Response sizes", "By", metrics.SizeBuckets, sizes, start, end),
+				histogram("logr.request.duration", "Request durations", "s", metrics.DurationBuckets, durations, start, end),
+			},
+		}},
+	}}
+	return
+}
+
+// The sum function returns a delta Sum with a data point for each count, labeled by
+// the attribute `key`
+func sum(name string, description string, unit string, key string, counts []timeseries.Count, start time.Time, end time.Time) Metric {
+	dataPoints := make([]NumberDataPoint, 0, len(counts))
+	for _, count := range counts {
+		dataPoints = append(dataPoints, NumberDataPoint{
+			Attributes:        []KeyValue{attribute(key, count.Label)},
+			StartTimeUnixNano: unixNano(start),
+			TimeUnixNano:      unixNano(end),
+			AsInt:             strconv.Itoa(count.Count),
+		})
+	}
+	return Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+		Sum:         &Sum{dataPoints, deltaTemporality, true},
+	}
+}
+
+// The histogram function returns a delta Histogram with a single data point
+// distributing `values` into buckets with the upper bounds `bounds`
+func histogram(name string, description string, unit string, bounds []float64, values []float64, start time.Time, end time.Time) Metric {
+	// OTLP histograms have an implicit overflow bucket after the last bound
+	counts := make([]int, len(bounds)+1)
+	total := 0.0
+	for _, value := range values {
+		i := 0
+		for i < len(bounds) && value > bounds[i] {
+			i++
+		}
+		counts[i]++
+		total += value
+	}
+	bucketCounts := make([]string, len(counts))
+	for i, count := range counts {
+		bucketCounts[i] = strconv.Itoa(count)
+	}
+	return Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+		Histogram: &Histogram{
+			DataPoints: []HistogramDataPoint{{
+				StartTimeUnixNano: unixNano(start),
+				TimeUnixNano:      unixNano(end),
+				Count:             strconv.Itoa(len(values)),
+				Sum:               total,
+				BucketCounts:      bucketCounts,
+				ExplicitBounds:    bounds,
+			}},
+			AggregationTemporality: deltaTemporality,
+		},
+	}
+}
@@ -0,0 +1,201 @@
+package otlp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/metrics"
+	"github.com/jdormit/logr/timeseries"
+	_ "github.com/mattn/go-sqlite3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+var start = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+var testLines = []timeseries.LogLine{
+	{Host: "127.0.0.1", Timestamp: start, Path: "/api/user", Status: 200, ResponseBytes: 50,
+		Duration: 20 * time.Millisecond, HasDuration: true},
+	{Host: "127.0.0.1", Timestamp: start.Add(4 * time.Second), Path: "/api/user", Status: 200, ResponseBytes: 500},
+	{Host: "127.0.0.2", Timestamp: start.Add(9 * time.Second), Path: "/report", Status: 500, ResponseBytes: 20000000,
+		Duration: 3 * time.Second, HasDuration: true},
+	// Recorded at the end of the window, so it belongs to the next export
+	{Host: "127.0.0.2", Timestamp: start.Add(10 * time.Second), Path: "/report", Status: 404, ResponseBytes: 5},
+}
+
+func loadTimeSeries(t *testing.T) *timeseries.LogTimeSeries {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(timeseries.CreateLogLinesTableStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &timeseries.LogTimeSeries{db, logFile}
+	for _, logLine := range testLines {
+		_, err := ts.Record(logLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts
+}
+
+// A collector is a stand-in for an OpenTelemetry collector that records the
+// requests it receives and responds with `status`
+type collector struct {
+	status   int
+	requests []MetricsRequest
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request MetricsRequest
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/metrics" ||
+		r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.requests = append(c.requests, request)
+	w.WriteHeader(c.status)
+	w.Write([]byte("{}"))
+}
+
+func TestExport(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	stub := &collector{status: http.StatusOK}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	exporter, err := NewExporter(ts, server.URL+"/v1/metrics", "web-1", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.Export(start.Add(10*time.Second + 500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(stub.requests))
+	}
+
+	startNano := "1525881600000000000"
+	endNano := "1525881610000000000"
+	expected := MetricsRequest{[]ResourceMetrics{{
+		Resource: Resource{[]KeyValue{
+			{"service.name", AnyValue{"logr"}},
+			{"log.file.path", AnyValue{logFile}},
+			{"host.name", AnyValue{"web-1"}},
+		}},
+		ScopeMetrics: []ScopeMetrics{{
+			Scope: Scope{scopeName},
+			Metrics: []Metric{
+				{
+					Name: "logr.requests", Description: "Requests by section", Unit: "{request}",
+					Sum: &Sum{[]NumberDataPoint{
+						{[]KeyValue{{"section", AnyValue{"api"}}}, startNano, endNano, "2"},
+						{[]KeyValue{{"section", AnyValue{"report"}}}, startNano, endNano, "1"},
+					}, deltaTemporality, true},
+				},
+				{
+					Name: "logr.responses", Description: "Responses by status code", Unit: "{response}",
+					Sum: &Sum{[]NumberDataPoint{
+						{[]KeyValue{{"status", AnyValue{"200"}}}, startNano, endNano, "2"},
+						{[]KeyValue{{"status", AnyValue{"500"}}}, startNano, endNano, "1"},
+					}, deltaTemporality, true},
+				},
+				{
+					Name: "logr.response.bytes", Description: "Response bytes by section", Unit: "By",
+					Sum: &Sum{[]NumberDataPoint{
+						{[]KeyValue{{"section", AnyValue{"report"}}}, startNano, endNano, "20000000"},
+						{[]KeyValue{{"section", AnyValue{"api"}}}, startNano, endNano, "550"},
+					}, deltaTemporality, true},
+				},
+				{
+					Name: "logr.response.size", Description: "Response sizes", Unit: "By",
+					Histogram: &Histogram{[]HistogramDataPoint{{
+						StartTimeUnixNano: startNano,
+						TimeUnixNano:      endNano,
+						Count:             "3",
+						Sum:               20000550,
+						BucketCounts:      []string{"1", "1", "0", "0", "0", "0", "1"},
+						ExplicitBounds:    metrics.SizeBuckets,
+					}}, deltaTemporality},
+				},
+				{
+					Name: "logr.request.duration", Description: "Request durations", Unit: "s",
+					Histogram: &Histogram{[]HistogramDataPoint{{
+						StartTimeUnixNano: startNano,
+						TimeUnixNano:      endNano,
+						Count:             "2",
+						Sum:               3.02,
+						BucketCounts:      []string{"0", "0", "1", "0", "0", "0", "0", "0", "0", "1", "0", "0"},
+						ExplicitBounds:    metrics.DurationBuckets,
+					}}, deltaTemporality},
+				},
+			},
+		}},
+	}}}
+	if !cmp.Equal(expected, stub.requests[0]) {
+		t.Errorf("Unexpected request:\n%s", cmp.Diff(expected, stub.requests[0]))
+	}
+
+	// The next export starts where the previous one ended
+	err = exporter.Export(start.Add(20 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPoints := stub.requests[1].ResourceMetrics[0].ScopeMetrics[0].Metrics[1].Sum.DataPoints
+	expectedPoints := []NumberDataPoint{
+		{[]KeyValue{{"status", AnyValue{"404"}}}, endNano, "1525881620000000000", "1"},
+	}
+	if !cmp.Equal(expectedPoints, dataPoints) {
+		t.Errorf("Unexpected data points in second export:\n%s", cmp.Diff(expectedPoints, dataPoints))
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	_, err := NewExporter(nil, "http://localhost:4318/v1/metrics", "web-1", 0, start)
+	if err == nil {
+		t.Error("Expected an error for an interval of 0s")
+	}
+}
+
+func TestExportError(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	stub := &collector{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	exporter, err := NewExporter(ts, server.URL+"/v1/metrics", "web-1", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.Export(start.Add(10 * time.Second))
+	exportErr, ok := err.(*ExportError)
+	if !ok || exportErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected an ExportError with status 503, got %v", err)
+	}
+
+	// A failed export is retried with the same window on the next export
+	stub.status = http.StatusOK
+	err = exporter.Export(start.Add(20 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPoints := stub.requests[1].ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Sum.DataPoints
+	if len(dataPoints) == 0 || dataPoints[0].StartTimeUnixNano != "1525881600000000000" {
+		t.Errorf("Expected the retried export to start at the original window, got %v", dataPoints)
+	}
+}
@@ -96,6 +96,14 @@ func ParseLogLine(line string) (logLine timeseries.LogLine, err error) {
 			} else {
 				logLine.ResponseBytes = responseBytes
 			}
+		case 7:
+			// Some servers append the request time in seconds, e.g. nginx's
+			// $request_time. Anything else in this position is ignored.
+			seconds, err := strconv.ParseFloat(token, 64)
+			if err == nil && seconds >= 0 {
+				logLine.Duration = time.Duration(seconds * float64(time.Second))
+				logLine.HasDuration = true
+			}
 		default:
 			break
 		}
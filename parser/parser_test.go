@@ -33,6 +33,8 @@ func TestParseLogLine(t *testing.T) {
 				"/report",
 				200,
 				123,
+				0,
+				false,
 			},
 		},
 		{
@@ -54,6 +56,37 @@ func TestParseLogLine(t *testing.T) {
 				"/report",
 				200,
 				123,
+				0,
+				false,
+			},
+		},
+		{
+			inputLine: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 0.250`,
+			expectedOutput: timeseries.LogLine{
+				Host:          "127.0.0.1",
+				User:          "-",
+				AuthUser:      "james",
+				Timestamp:     parseTime("09/May/2018:16:00:39 +0000"),
+				Method:        "GET",
+				Path:          "/report",
+				Status:        200,
+				ResponseBytes: 123,
+				Duration:      250 * time.Millisecond,
+				HasDuration:   true,
+			},
+		},
+		{
+			inputLine: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 0.000`,
+			expectedOutput: timeseries.LogLine{
+				Host:          "127.0.0.1",
+				User:          "-",
+				AuthUser:      "james",
+				Timestamp:     parseTime("09/May/2018:16:00:39 +0000"),
+				Method:        "GET",
+				Path:          "/report",
+				Status:        200,
+				ResponseBytes: 123,
+				HasDuration:   true,
 			},
 		},
 	}
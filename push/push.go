@@ -0,0 +1,196 @@
+/*
+Package push periodically pushes metrics derived from the stored log lines to a StatsD
+or Graphite server.
+
+Every flush interval, a Pusher queries the log lines recorded since the previous flush
+and sends a counter for each section and response status plus gauges for the average
+hits and response bytes per second over the interval. StatsD metrics are sent as UDP
+packets in the StatsD line protocol, e.g. `logr.sections.api:12|c`, and Graphite
+metrics over TCP in the plaintext protocol, e.g. `logr.sections.api 12 1525881600`.
+
+Flushes cover consecutive windows of log timestamps (see package flusher), so a log
+line that is recorded after its window has been flushed is never pushed. This happens
+when the reader falls more than a flush interval behind the log file or the log's lines
+are out of order.
+*/
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jdormit/logr/flusher"
+	"github.com/jdormit/logr/timeseries"
+	"log"
+	"net"
+	"regexp"
+	"time"
+)
+
+// The supported output formats
+const (
+	StatsD   = "statsd"
+	Graphite = "graphite"
+)
+
+// StatsD servers commonly drop UDP packets larger than a typical network MTU,
+// so metrics are split into packets of at most this many bytes
+const maxPacketSize = 1432
+
+// An UnknownFormatError is returned when a Pusher is created with an unsupported format
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return fmt.Sprintf("Unknown push format %q: expected %s or %s", e.Format, StatsD, Graphite)
+}
+
+// A Metric is a single value pushed to the server
+type Metric struct {
+	Name  string
+	Value float64
+	// Counter is true for counts since the previous flush and false for gauges
+	Counter bool
+}
+
+// A Pusher sends metrics to a StatsD or Graphite server. It should be instantiated
+// via push.NewPusher().
+type Pusher struct {
+	ts      *timeseries.LogTimeSeries
+	addr    string
+	format  string
+	prefix  string
+	flusher *flusher.Flusher
+}
+
+// NewPusher returns a Pusher that sends metrics about the log lines in `ts` to `addr`
+// every `interval` in the given format, with every metric name prefixed by `prefix`.
+// Only log lines recorded after `start` are pushed. The interval must be at least
+// a second.
+func NewPusher(ts *timeseries.LogTimeSeries, addr string, format string, prefix string, interval time.Duration, start time.Time) (pusher *Pusher, err error) {
+	if format != StatsD && format != Graphite {
+		return nil, &UnknownFormatError{format}
+	}
+	pusher = &Pusher{ts: ts, addr: addr, format: format, prefix: prefix}
+	pusher.flusher, err = flusher.NewFlusher(interval, start, pusher.push)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid push interval: %v", err)
+	}
+	return
+}
+
+// Run flushes metrics every interval until a call to Pusher.Terminate()
+func (p *Pusher) Run() {
+	p.flusher.Run(func(err error) {
+		log.Printf("Error pushing metrics to %s: %v", p.addr, err)
+	})
+}
+
+// Terminate stops a running Pusher
+func (p *Pusher) Terminate() {
+	p.flusher.Terminate()
+}
+
+// Flush sends the metrics for the log lines recorded between the previous flush and `now`
+func (p *Pusher) Flush(now time.Time) error {
+	return p.flusher.Flush(now)
+}
+
+// The push method sends the metrics for the log lines recorded from `start` up to but
+// not including `end`
+func (p *Pusher) push(start time.Time, end time.Time) (err error) {
+	metrics, err := p.Metrics(start, end)
+	if err != nil {
+		return
+	}
+	return p.send(metrics, end)
+}
+
+// Metrics returns the metrics for the log lines recorded from `start` up to but not
+// including `end`. Both must be whole seconds.
+func (p *Pusher) Metrics(start time.Time, end time.Time) (metrics []Metric, err error) {
+	last := flusher.Last(end)
+	seconds := end.Sub(start).Seconds()
+
+	sectionCounts, err := p.ts.GetSectionCounts(start, last, nil)
+	if err != nil {
+		return
+	}
+	statusCounts, err := p.ts.GetStatusCounts(start, last, nil)
+	if err != nil {
+		return
+	}
+	totalBytes, err := p.ts.GetTotalBytes(start, last, nil)
+	if err != nil {
+		return
+	}
+
+	hits := 0
+	for _, count := range sectionCounts {
+		metrics = append(metrics, Metric{"sections." + sanitize(count.Label), float64(count.Count), true})
+		hits += count.Count
+	}
+	for _, count := range statusCounts {
+		metrics = append(metrics, Metric{"statuses." + sanitize(count.Label), float64(count.Count), true})
+	}
+	metrics = append(metrics,
+		Metric{"traffic.hits_per_second", float64(hits) / seconds, false},
+		Metric{"traffic.bytes_per_second", float64(totalBytes) / seconds, false})
+	return
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// The sanitize function makes a label safe to use as one component of a dotted
+// metric name, which can't contain the separators used by either protocol
+func sanitize(label string) string {
+	if label == "" {
+		return "_"
+	}
+	return unsafeChars.ReplaceAllString(label, "_")
+}
+
+// The formatLine function renders `metric` as a single line of the Pusher's format
+func (p *Pusher) formatLine(metric Metric, now time.Time) string {
+	name := metric.Name
+	if p.prefix != "" {
+		name = p.prefix + "." + name
+	}
+	if p.format == Graphite {
+		return fmt.Sprintf("%s %v %d\n", name, metric.Value, now.Unix())
+	}
+	metricType := "g"
+	if metric.Counter {
+		metricType = "c"
+	}
+	return fmt.Sprintf("%s:%v|%s\n", name, metric.Value, metricType)
+}
+
+func (p *Pusher) send(metrics []Metric, now time.Time) (err error) {
+	network := "tcp"
+	if p.format == StatsD {
+		network = "udp"
+	}
+	conn, err := net.Dial(network, p.addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		line := p.formatLine(metric, now)
+		if p.format == StatsD && buf.Len() > 0 && buf.Len()+len(line) > maxPacketSize {
+			_, err = conn.Write(buf.Bytes())
+			if err != nil {
+				return
+			}
+			buf.Reset()
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		_, err = conn.Write(buf.Bytes())
+	}
+	return
+}
@@ -0,0 +1,264 @@
+package push
+
+import (
+	"database/sql"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/timeseries"
+	_ "github.com/mattn/go-sqlite3"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+var start = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+var testLines = []timeseries.LogLine{
+	{Host: "127.0.0.1", Timestamp: start, Path: "/api/user", Status: 200, ResponseBytes: 100},
+	{Host: "127.0.0.1", Timestamp: start.Add(4 * time.Second), Path: "/api/user", Status: 200, ResponseBytes: 200},
+	{Host: "127.0.0.2", Timestamp: start.Add(9 * time.Second), Path: "/a.b:c|d", Status: 500, ResponseBytes: 300},
+	// Recorded at the end of the window, so it belongs to the next flush
+	{Host: "127.0.0.2", Timestamp: start.Add(10 * time.Second), Path: "/", Status: 404, ResponseBytes: 400},
+}
+
+func loadTimeSeries(t *testing.T) *timeseries.LogTimeSeries {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(timeseries.CreateLogLinesTableStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &timeseries.LogTimeSeries{DB: db, LogFile: logFile}
+	for _, logLine := range testLines {
+		_, err := ts.Record(logLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts
+}
+
+func TestNewPusher(t *testing.T) {
+	_, err := NewPusher(nil, "localhost:8125", "influx", "logr", time.Second, start)
+	if _, ok := err.(*UnknownFormatError); !ok {
+		t.Errorf("Expected an UnknownFormatError, got %v", err)
+	}
+	for _, interval := range []time.Duration{0, -time.Second, 500 * time.Millisecond} {
+		_, err = NewPusher(nil, "localhost:8125", StatsD, "logr", interval, start)
+		if err == nil {
+			t.Errorf("Expected an error for an interval of %v", interval)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	testCases := []struct {
+		start    time.Time
+		end      time.Time
+		expected []Metric
+	}{
+		{
+			start,
+			start.Add(10 * time.Second),
+			[]Metric{
+				{"sections.api", 2, true},
+				{"sections.a_b_c_d", 1, true},
+				{"statuses.200", 2, true},
+				{"statuses.500", 1, true},
+				{"traffic.hits_per_second", 0.3, false},
+				{"traffic.bytes_per_second", 60, false},
+			},
+		},
+		{
+			start.Add(10 * time.Second),
+			start.Add(20 * time.Second),
+			[]Metric{
+				{"sections._", 1, true},
+				{"statuses.404", 1, true},
+				{"traffic.hits_per_second", 0.1, false},
+				{"traffic.bytes_per_second", 40, false},
+			},
+		},
+		{
+			start.Add(20 * time.Second),
+			start.Add(30 * time.Second),
+			[]Metric{
+				{"traffic.hits_per_second", 0, false},
+				{"traffic.bytes_per_second", 0, false},
+			},
+		},
+	}
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	pusher, err := NewPusher(ts, "localhost:8125", StatsD, "logr", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for caseIdx, testCase := range testCases {
+		actual, err := pusher.Metrics(testCase.start, testCase.end)
+		if err != nil {
+			t.Error(err)
+		}
+		if !cmp.Equal(testCase.expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func sortedLines(payload string) []string {
+	lines := strings.Split(strings.TrimSuffix(payload, "\n"), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestFlushStatsD(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	pusher, err := NewPusher(ts, listener.LocalAddr().String(), StatsD, "logr", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pusher.Flush(start.Add(10*time.Second + 500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	packet := make([]byte, maxPacketSize)
+	n, _, err := listener.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"logr.sections.a_b_c_d:1|c",
+		"logr.sections.api:2|c",
+		"logr.statuses.200:2|c",
+		"logr.statuses.500:1|c",
+		"logr.traffic.bytes_per_second:60|g",
+		"logr.traffic.hits_per_second:0.3|g",
+	}
+	if actual := sortedLines(string(packet[:n])); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
+
+func TestFlushGraphite(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			payload, _ := ioutil.ReadAll(conn)
+			conn.Close()
+			received <- string(payload)
+		}
+	}()
+	pusher, err := NewPusher(ts, listener.Addr().String(), Graphite, "web.logr", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		now      time.Time
+		expected []string
+	}{
+		{
+			start.Add(10 * time.Second),
+			[]string{
+				"web.logr.sections.a_b_c_d 1 1525881610",
+				"web.logr.sections.api 2 1525881610",
+				"web.logr.statuses.200 2 1525881610",
+				"web.logr.statuses.500 1 1525881610",
+				"web.logr.traffic.bytes_per_second 60 1525881610",
+				"web.logr.traffic.hits_per_second 0.3 1525881610",
+			},
+		},
+		{
+			start.Add(20 * time.Second),
+			[]string{
+				"web.logr.sections._ 1 1525881620",
+				"web.logr.statuses.404 1 1525881620",
+				"web.logr.traffic.bytes_per_second 40 1525881620",
+				"web.logr.traffic.hits_per_second 0.1 1525881620",
+			},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		err = pusher.Flush(testCase.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case payload := <-received:
+			if actual := sortedLines(payload); !cmp.Equal(testCase.expected, actual) {
+				t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Error on test case %d. Did not receive metrics after 2 seconds", caseIdx)
+		}
+	}
+}
+
+func TestFlushLateLine(t *testing.T) {
+	ts := loadTimeSeries(t)
+	defer ts.DB.Close()
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	pusher, err := NewPusher(ts, listener.LocalAddr().String(), StatsD, "logr", 10*time.Second, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() []string {
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		packet := make([]byte, maxPacketSize)
+		n, _, err := listener.ReadFrom(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sortedLines(string(packet[:n]))
+	}
+	err = pusher.Flush(start.Add(10 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read()
+	// A line recorded after its window was flushed is left out of every later flush
+	_, err = ts.Record(timeseries.LogLine{Timestamp: start.Add(5 * time.Second), Path: "/late", Status: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pusher.Flush(start.Add(20 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"logr.sections._:1|c",
+		"logr.statuses.404:1|c",
+		"logr.traffic.bytes_per_second:40|g",
+		"logr.traffic.hits_per_second:0.1|g",
+	}
+	if actual := read(); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/report"
+	"github.com/jdormit/logr/timeseries"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultQueryWindow = time.Hour
+
+func queryUsage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Printf(`Query the log lines stored by logr
+
+USAGE:
+  %s query [OPTIONS]
+
+OPTIONS:
+  -h, -help
+        Display this message and exit
+`, os.Args[0])
+		flags.PrintDefaults()
+	}
+}
+
+// The parseTimeArg function parses a -start or -end argument, which is either an
+// absolute RFC 3339 timestamp or a duration before `now`, e.g. "90m"
+func parseTimeArg(arg string, now time.Time) (t time.Time, err error) {
+	duration, err := time.ParseDuration(arg)
+	if err == nil {
+		return now.Add(-duration), nil
+	}
+	t, err = time.Parse(time.RFC3339, arg)
+	if err != nil {
+		err = fmt.Errorf("Invalid time %q: expected an RFC 3339 timestamp or a duration", arg)
+	}
+	return
+}
+
+// The parsePercentile function parses an aggregation of the form "pNN",
+// e.g. "p99", into the percentile NN
+func parsePercentile(agg string) (p float64, ok bool) {
+	if !strings.HasPrefix(agg, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(agg[1:], 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+// The queryTable function runs an aggregation over the log lines between `start`
+// and `end`, grouped by `groupBy`, and returns the results as a report.Table
+func queryTable(ts *timeseries.LogTimeSeries, groupBy string, agg string, start time.Time, end time.Time, f *filter.Filter) (table report.Table, err error) {
+	switch agg {
+	case "count":
+		counts, err := ts.GetCountsBy(groupBy, start, end, f)
+		if err != nil {
+			return table, err
+		}
+		table.Columns = []string{groupBy, "count"}
+		for _, count := range counts {
+			table.Rows = append(table.Rows, []interface{}{count.Label, count.Count})
+		}
+	case "bytes":
+		counts, err := ts.GetBytesBy(groupBy, start, end, f)
+		if err != nil {
+			return table, err
+		}
+		table.Columns = []string{groupBy, "bytes"}
+		for _, count := range counts {
+			table.Rows = append(table.Rows, []interface{}{count.Label, count.Count})
+		}
+	default:
+		p, ok := parsePercentile(agg)
+		if !ok {
+			return table, fmt.Errorf("Unknown aggregation %q", agg)
+		}
+		percentiles, err := ts.GetDurationPercentilesBy(groupBy, p, start, end, f)
+		if err != nil {
+			return table, err
+		}
+		table.Columns = []string{groupBy, agg + "_duration_ms", "count"}
+		for _, percentile := range percentiles {
+			ms := percentile.Duration.Seconds() * 1000
+			table.Rows = append(table.Rows, []interface{}{percentile.Label, ms, percentile.Count})
+		}
+	}
+	return
+}
+
+func runQuery(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	flags.Usage = queryUsage(flags)
+	dbPath := flags.String("dbPath", defaultDbPath, "The `path` to the SQLite database")
+	logPath := flags.String("logFile", defaultLogPath, "The `path` of the log file to query. SQL LIKE wildcards are allowed, e.g. % queries every log file")
+	startArg := flags.String("start", defaultQueryWindow.String(), "The start of the query window, as an RFC 3339 `time` or a duration before now")
+	endArg := flags.String("end", "0s", "The end of the query window, as an RFC 3339 `time` or a duration before now")
+	groupBy := flags.String("groupBy", "section", "The `field` to group by: section, status, host, method or path")
+	agg := flags.String("agg", "count", "The `aggregation` to compute for each group: count, bytes, or a request duration percentile such as p50 or p99")
+	format := flags.String("format", "table", "The output `format`: table, csv or json")
+	filterExpr := flags.String("filter", "", "A filter `expression` restricting the log lines queried, e.g. 'status>=500'")
+	flags.Parse(args)
+
+	exitOnError := func(err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	now := time.Now()
+	start, err := parseTimeArg(*startArg, now)
+	exitOnError(err)
+	end, err := parseTimeArg(*endArg, now)
+	exitOnError(err)
+	f, err := filter.Parse(*filterExpr)
+	exitOnError(err)
+	if _, ok := filter.Fields[*groupBy]; !ok {
+		exitOnError(fmt.Errorf("Unknown field %q", *groupBy))
+	}
+
+	db, err := loadDB(*dbPath)
+	exitOnError(err)
+	defer db.Close()
+
+	ts := timeseries.LogTimeSeries{db, *logPath}
+	table, err := queryTable(&ts, *groupBy, *agg, start, end, f)
+	exitOnError(err)
+	exitOnError(table.Write(os.Stdout, *format))
+}
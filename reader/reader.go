@@ -9,6 +9,8 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync/atomic"
+	"time"
 )
 
 // A logReader tails a log file. It should be instantiated via reader.NewLogReader().
@@ -17,11 +19,17 @@ type logReader struct {
 	terminated      bool
 	filepath        string
 	offset          int64
+	// position, parseErrors and newest are read from other goroutines,
+	// so they must only be accessed atomically
+	position    int64
+	parseErrors int64
+	// newest is the Unix timestamp of the newest log line read so far, or 0
+	newest int64
 }
 
 // NewLogReader returns a new logReader struct.
 func NewLogReader(offsetPersister *offsets.OffsetPersister, filename string) logReader {
-	return logReader{offsetPersister, true, filename, 0}
+	return logReader{offsetPersister, true, filename, 0, 0, 0, 0}
 }
 
 // TailLogFile reads lines from the end of a log file and sends them over `logChan`.
@@ -39,16 +47,19 @@ func (lr *logReader) TailLogFile(logChan chan<- timeseries.LogLine) {
 		log.Fatal(err)
 	}
 	lr.offset = latestOffset
+	atomic.StoreInt64(&lr.position, 0)
 
 	reader := bufio.NewReader(file)
 
 	// Skip to the latest offset
 	for i := int64(0); i < lr.offset; i++ {
-		reader.ReadString('\n')
+		line, _ := reader.ReadString('\n')
+		atomic.AddInt64(&lr.position, int64(len(line)))
 	}
 
 	for !lr.terminated {
 		line, err := reader.ReadString('\n')
+		atomic.AddInt64(&lr.position, int64(len(line)))
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("Fatal error scanning log file: %v\nTerminating\n", err)
@@ -58,12 +69,50 @@ func (lr *logReader) TailLogFile(logChan chan<- timeseries.LogLine) {
 			lr.offset = lr.offset + 1
 			logLine, err := parser.ParseLogLine(line)
 			if err == nil {
+				if timestamp := logLine.Timestamp.Unix(); timestamp > atomic.LoadInt64(&lr.newest) {
+					atomic.StoreInt64(&lr.newest, timestamp)
+				}
 				logChan <- logLine
+			} else {
+				atomic.AddInt64(&lr.parseErrors, 1)
 			}
 		}
 	}
 }
 
+// Position returns the number of bytes of the log file that have been read so far
+func (lr *logReader) Position() int64 {
+	return atomic.LoadInt64(&lr.position)
+}
+
+// Lag returns the number of bytes between the reader's position and the end of the log file
+func (lr *logReader) Lag() (lag int64, err error) {
+	info, err := os.Stat(lr.filepath)
+	if err != nil {
+		return
+	}
+	lag = info.Size() - lr.Position()
+	if lag < 0 {
+		lag = 0
+	}
+	return
+}
+
+// Newest returns the timestamp of the newest log line read so far, and false if no
+// log lines have been read
+func (lr *logReader) Newest() (newest time.Time, ok bool) {
+	timestamp := atomic.LoadInt64(&lr.newest)
+	if timestamp == 0 {
+		return
+	}
+	return time.Unix(timestamp, 0), true
+}
+
+// ParseErrors returns the number of lines that could not be parsed as log lines
+func (lr *logReader) ParseErrors() int64 {
+	return atomic.LoadInt64(&lr.parseErrors)
+}
+
 func (lr *logReader) Terminate() (err error) {
 	lr.terminated = true
 	err = lr.offsetPersister.PersistOffset(lr.filepath, lr.offset)
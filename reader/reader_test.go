@@ -79,6 +79,8 @@ func TestTailLogFile(t *testing.T) {
 			"/report",
 			200,
 			123,
+			0,
+			false,
 		}
 		if !cmp.Equal(logLine, expected) {
 			t.Errorf("Expected: %#v\nActual: %#v\n", expected, logLine)
@@ -95,6 +97,8 @@ func TestTailLogFile(t *testing.T) {
 			"/api/user",
 			200,
 			234,
+			0,
+			false,
 		}
 		if !cmp.Equal(logLine, expected) {
 			t.Errorf("Expected: %#v\nActual: %#v\n", expected, logLine)
@@ -136,11 +140,66 @@ func TestTailLogFile(t *testing.T) {
 			"/api/user",
 			200,
 			234,
+			0,
+			false,
 		}
 		if !cmp.Equal(logLine, expected) {
 			t.Errorf("Expected: %#v\nActual: %#v\n", expected, logLine)
 		}
 	})
 
+	t.Run("progress", func(t *testing.T) {
+		os.Remove(logPath)
+		os.Create(logPath)
+		db, err := loadDB("progress")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		offsetPersister := offsets.OffsetPersister{db}
+		logReader := NewLogReader(&offsetPersister, logPath)
+		logChan := make(chan timeseries.LogLine)
+		file, err := os.OpenFile(logPath, os.O_RDWR, 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		validLine := "127.0.0.1 - james [09/May/2018:16:00:39 +0000] " +
+			"\"GET /report HTTP/1.0\" 200 123\n"
+		invalidLine := "not a log line\n"
+		fileSize := int64(len(invalidLine) + len(validLine))
+		file.WriteString(invalidLine + validLine)
+		if _, ok := logReader.Newest(); ok {
+			t.Error("Expected no newest log line before reading")
+		}
+		lag, err := logReader.Lag()
+		if err != nil {
+			t.Error(err)
+		}
+		if lag != fileSize {
+			t.Errorf("Expected lag of %d bytes before reading, got %d", fileSize, lag)
+		}
+		go logReader.TailLogFile(logChan)
+		defer logReader.Terminate()
+		awaitLogLine(t, logChan, 2)
+		if parseErrors := logReader.ParseErrors(); parseErrors != 1 {
+			t.Errorf("Expected 1 parse error, got %d", parseErrors)
+		}
+		if position := logReader.Position(); position != fileSize {
+			t.Errorf("Expected position %d, got %d", fileSize, position)
+		}
+		lag, err = logReader.Lag()
+		if err != nil {
+			t.Error(err)
+		}
+		if lag != 0 {
+			t.Errorf("Expected no lag after reading, got %d", lag)
+		}
+		expectedNewest := parseTime("09/May/2018:16:00:39 +0000")
+		if newest, ok := logReader.Newest(); !ok || !newest.Equal(expectedNewest) {
+			t.Errorf("Expected newest log line at %v, got %v", expectedNewest, newest)
+		}
+	})
+
 	os.Remove(logPath)
 }
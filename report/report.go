@@ -0,0 +1,90 @@
+// Package report provides functions to write tabular query results as text, CSV or JSON
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// An UnknownFormatError is returned when a table is written in an unsupported format
+var UnknownFormatError = errors.New("Unknown output format")
+
+// A Table is a set of rows of values with named columns
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Write writes the table to `w` in `format`, which is one of "table", "csv" or "json"
+func (t *Table) Write(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		return t.WriteText(w)
+	case "csv":
+		return t.WriteCSV(w)
+	case "json":
+		return t.WriteJSON(w)
+	default:
+		return UnknownFormatError
+	}
+}
+
+// The formatValue function formats a table cell for text and CSV output
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return fmt.Sprintf("%.3f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteText writes the table as aligned, human-readable columns
+func (t *Table) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.Columns, "\t")))
+	for _, row := range t.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = formatValue(value)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the table as CSV with a header row
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(t.Columns)
+	for _, row := range t.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = formatValue(value)
+		}
+		cw.Write(cells)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the table as a JSON array with one object per row,
+// keyed by column name
+func (t *Table) WriteJSON(w io.Writer) error {
+	objects := make([]map[string]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		object := make(map[string]interface{})
+		for j, value := range row {
+			object[t.Columns[j]] = value
+		}
+		objects[i] = object
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	table := Table{
+		Columns: []string{"section", "count"},
+		Rows: [][]interface{}{
+			{"api", 12},
+			{"report, daily", 3},
+		},
+	}
+	testCases := []struct {
+		format         string
+		expectedOutput string
+		expectedError  error
+	}{
+		{
+			"table",
+			"SECTION        COUNT\napi            12\nreport, daily  3\n",
+			nil,
+		},
+		{
+			"csv",
+			"section,count\napi,12\n\"report, daily\",3\n",
+			nil,
+		},
+		{
+			"json",
+			"[\n  {\n    \"count\": 12,\n    \"section\": \"api\"\n  },\n" +
+				"  {\n    \"count\": 3,\n    \"section\": \"report, daily\"\n  }\n]\n",
+			nil,
+		},
+		{"xml", "", UnknownFormatError},
+	}
+	for caseIdx, testCase := range testCases {
+		var out bytes.Buffer
+		err := table.Write(&out, testCase.format)
+		if err != testCase.expectedError {
+			t.Errorf("Error on case %d.\nExpected: %v\nActual: %v",
+				caseIdx, testCase.expectedError, err)
+		}
+		if out.String() != testCase.expectedOutput {
+			t.Errorf("Error on case %d.\nExpected: %q\nActual: %q",
+				caseIdx, testCase.expectedOutput, out.String())
+		}
+	}
+}
+
+func TestWriteEmptyJSON(t *testing.T) {
+	table := Table{Columns: []string{"section", "count"}}
+	var out bytes.Buffer
+	table.WriteJSON(&out)
+	if out.String() != "[]\n" {
+		t.Errorf("Expected: %q\nActual: %q", "[]\n", out.String())
+	}
+}
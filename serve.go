@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/api"
+	"github.com/jdormit/logr/history"
+	"github.com/jdormit/logr/notify"
+	"github.com/jdormit/logr/offsets"
+	"github.com/jdormit/logr/reader"
+	"github.com/jdormit/logr/silence"
+	"github.com/jdormit/logr/timeseries"
+	"github.com/jdormit/logr/ui"
+	"github.com/jdormit/logr/web"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const defaultServeAddr = ":8080"
+
+func serveUsage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Printf(`Monitor a log file and serve its statistics over HTTP, both as a JSON API
+under /api/ and as a dashboard in the browser at /
+
+USAGE:
+  %s serve [OPTIONS] [log_file_path]
+
+ARGS:
+  log_file_path
+        The path to the log file to monitor (default %s)
+
+OPTIONS:
+  -h, -help
+        Display this message and exit
+`, os.Args[0], defaultLogPath)
+		flags.PrintDefaults()
+	}
+}
+
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = serveUsage(flags)
+	addr := flags.String("addr", defaultServeAddr, "The `address` on which to serve the API")
+	debugLogPath := flags.String("debugLogPath", defaultDebugLogPath, "The `path` to the file where logr will write debug logs")
+	dbPath := flags.String("dbPath", defaultDbPath, "The `path` to the SQLite database")
+	alertThreshold := flags.Float64("alertThreshold", defaultAlertThreshold, "The average number of requests per second over the alerting interval that will trigger an alert, or 0 to disable traffic alerts")
+	bandwidthAlertThreshold := flags.Float64("bandwidthAlertThreshold", defaultBandwidthAlertThreshold, "The average number of response bytes per second over the alerting interval that will trigger a bandwidth alert, or 0 to disable bandwidth alerts")
+	alertInterval := flags.Int("alertInterval", defaultAlertInterval, "The interval of time in seconds during which the number of requests per second must exceed the alert threshold to trigger an alert")
+	alertRulesPath := flags.String("alertRules", "", "The `path` to a JSON file of additional alert rules")
+	staleAlertThreshold := flags.Int("staleAlertThreshold", 0, "The number of seconds without new log lines that will trigger a stale alert, or 0 to disable stale alerts")
+	lagAlertThreshold := flags.Int("lagAlertThreshold", 0, "The number of bytes the log reader can fall behind the end of the log file before triggering a lag alert, or 0 to disable lag alerts")
+	var webhooks, slackWebhooks stringList
+	flags.Var(&webhooks, "webhook", "A `URL` to POST a JSON notification to when an alert fires or resolves. May be given more than once")
+	flags.Var(&slackWebhooks, "slackWebhook", "A Slack incoming webhook `URL` to post a message to when an alert fires or resolves. May be given more than once")
+	webhookRetries := flags.Int("webhookRetries", notify.DefaultRetries, "The number of times a failed webhook request is retried, with exponential backoff")
+	alertmanagerURL := flags.String("alertmanagerURL", "", "The base `URL` of a Prometheus Alertmanager to send alerts to, e.g. http://localhost:9093. Sending is disabled if this is empty")
+	alertmanagerInterval := flags.Int("alertmanagerInterval", int(notify.DefaultResendInterval.Seconds()), "The interval in seconds between re-sends of firing alerts to Alertmanager")
+	alertCommand := flags.String("alertCommand", "", "A shell `command` to run when an alert fires or resolves, with the alert's details in LOGR_* environment variables")
+	timescale := flags.Int("timescale", defaultTimescale, "The size of the browser dashboard's reporting time window in minutes")
+	granularity := flags.Int("granularity", defaultGranularity, "The granularity of the browser dashboard's traffic graph, i.e. the number of buckets into which traffic is divided.")
+	flags.Parse(args)
+
+	rules, err := alertRules(*alertThreshold, *bandwidthAlertThreshold, *alertInterval,
+		*staleAlertThreshold, *lagAlertThreshold, *alertRulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	notifiers, err := alertNotifiers(webhooks, slackWebhooks, *alertCommand, *webhookRetries)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *alertmanagerURL != "" {
+		alertmanager := notify.NewAlertmanager(*alertmanagerURL, time.Duration(*alertmanagerInterval)*time.Second)
+		notifiers = append(notifiers, alertmanager)
+		go alertmanager.Run()
+		defer alertmanager.Terminate()
+	}
+
+	debugLogFile, err := openDebugLog(*debugLogPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer debugLogFile.Close()
+	log.SetOutput(debugLogFile)
+
+	logPath := defaultLogPath
+	if flags.Arg(0) != "" {
+		logPath = flags.Arg(0)
+	}
+
+	db, err := loadDB(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	offsetPersister := offsets.OffsetPersister{db}
+	logReader := reader.NewLogReader(&offsetPersister, logPath)
+	logChan := make(chan timeseries.LogLine, 24)
+	go logReader.TailLogFile(logChan)
+	defer logReader.Terminate()
+
+	logTimeSeries := timeseries.LogTimeSeries{db, logPath}
+
+	alertEngine, err := alerts.NewEngine(&logTimeSeries, rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	alertEngine.WatchReader(&logReader)
+	alertHistory := history.Store{db, logPath}
+	err = alertHistory.EndOngoing(time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	dispatcher := notify.NewDispatcher(logPath, notifiers)
+	go dispatcher.Run()
+	defer dispatcher.Terminate()
+	alertSilences := silence.Store{db, logPath}
+	alertPipeline := alerting{alertEngine, &alertHistory, &alertSilences, dispatcher}
+	uiState, err := ui.GetInitialUIState(&logTimeSeries, *timescale, *granularity, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	broker := web.NewBroker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", api.NewServer(&logTimeSeries, alertEngine))
+	mux.Handle("/", web.Handler(broker))
+	go func() {
+		log.Fatal(http.ListenAndServe(*addr, mux))
+	}()
+	fmt.Printf("Serving statistics for %s on %s\n", logPath, *addr)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	updateTicker := time.NewTicker(time.Second).C
+
+	for {
+		select {
+		case <-interrupts:
+			logReader.Terminate()
+			return
+		case logLine := <-logChan:
+			_, err := logTimeSeries.Record(logLine)
+			if err != nil {
+				log.Printf("Error writing log line to database: %v", err)
+			}
+		case <-updateTicker:
+			now := time.Now()
+			transitions := alertPipeline.evaluate(now)
+			uiState = ui.NextUIState(uiState, &logTimeSeries, now)
+			alertPipeline.updateUIState(uiState, now)
+			err := broker.Publish(web.NewSnapshot(uiState, transitions, now))
+			if err != nil {
+				log.Printf("Error publishing dashboard snapshot: %v", err)
+			}
+		}
+	}
+}
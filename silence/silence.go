@@ -0,0 +1,165 @@
+/*
+Package silence stores alert acknowledgements and silences, so that alerts someone is
+already dealing with stop demanding attention, even across restarts.
+
+Acknowledging a firing alert mutes it until its rule next resolves, or is found not to
+be firing when logr starts. Silencing a rule
+mutes it until a chosen time, whether or not it is firing. A muted alert is not shown
+in the dashboard's alert area, and no notifications are sent about it while it is
+silenced. An acknowledged alert is not notified again when it fires, e.g. when logr
+restarts while the alert's condition still holds, but its resolution is notified. A
+rule that resolves while silenced is only reported to notifiers that are still
+re-sending its alert, such as an Alertmanager, so they stop.
+*/
+package silence
+
+import (
+	"database/sql"
+	"github.com/jdormit/logr/alerts"
+	"time"
+)
+
+const CreateSilencesTableStmt = `
+CREATE TABLE IF NOT EXISTS silences (
+  log_file varchar(255),
+  rule varchar(255),
+  until integer,
+  primary key (log_file, rule)
+)
+`
+
+// A Silence mutes the alerts of a rule
+type Silence struct {
+	Rule string
+	// Until is when the silence expires, or the zero time for an acknowledgement,
+	// which lasts until the rule resolves
+	Until time.Time
+}
+
+// Acknowledged returns true if the silence is an acknowledgement
+func (s Silence) Acknowledged() bool {
+	return s.Until.IsZero()
+}
+
+// Active returns true if the silence mutes its rule at `now`
+func (s Silence) Active(now time.Time) bool {
+	return s.Acknowledged() || s.Until.After(now)
+}
+
+// Muted returns true if one of `silences` mutes `rule` at `now`
+func Muted(silences []Silence, rule string, now time.Time) bool {
+	for _, s := range silences {
+		if s.Rule == rule && s.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifiable returns the transitions that should be notified given `silences`: every
+// transition except those of silenced rules and those of acknowledged rules firing
+func Notifiable(silences []Silence, transitions []alerts.Transition) []alerts.Transition {
+	notifiable := make([]alerts.Transition, 0, len(transitions))
+	for _, transition := range transitions {
+		muted := false
+		for _, s := range silences {
+			if s.Rule != transition.Rule {
+				continue
+			}
+			if (s.Acknowledged() && transition.To == alerts.Firing) || s.Until.After(transition.Time) {
+				muted = true
+			}
+		}
+		if !muted {
+			notifiable = append(notifiable, transition)
+		}
+	}
+	return notifiable
+}
+
+// The Store struct is used to persist the silences of a log file's alert rules
+type Store struct {
+	DB      *sql.DB
+	LogFile string
+}
+
+// Save stores `s`, replacing any existing silence of the same rule. Saving a
+// silence that has already expired lifts the rule's silence.
+func (store *Store) Save(s Silence) (err error) {
+	var until interface{}
+	if !s.Acknowledged() {
+		until = s.Until.Unix()
+	}
+	_, err = store.DB.Exec("INSERT INTO silences (log_file, rule, until) VALUES ($1, $2, $3) "+
+		"ON CONFLICT(log_file, rule) DO UPDATE SET until = $3",
+		store.LogFile, s.Rule, until)
+	return
+}
+
+// Record ends the acknowledgement of every rule that isn't pending or firing in
+// `statuses`. This includes rules that resolved while logr wasn't running, which are
+// inactive when it starts, and rules that no longer exist.
+func (store *Store) Record(statuses []alerts.Status) (err error) {
+	holding := make(map[string]bool)
+	for _, status := range statuses {
+		if status.State == alerts.Pending || status.State == alerts.Firing {
+			holding[status.Rule.Name] = true
+		}
+	}
+	rows, err := store.DB.Query("SELECT rule FROM silences WHERE log_file = $1 AND until IS NULL",
+		store.LogFile)
+	if err != nil {
+		return
+	}
+	ended := make([]string, 0)
+	for rows.Next() {
+		var rule string
+		err = rows.Scan(&rule)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		if !holding[rule] {
+			ended = append(ended, rule)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return
+	}
+	for _, rule := range ended {
+		_, err = store.DB.Exec("DELETE FROM silences WHERE log_file = $1 AND rule = $2 AND until IS NULL",
+			store.LogFile, rule)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Active returns the silences that mute their rules at `now`, in order of rule name
+func (store *Store) Active(now time.Time) (silences []Silence, err error) {
+	rows, err := store.DB.Query("SELECT rule, until FROM silences "+
+		"WHERE log_file = $1 AND (until IS NULL OR until > $2) ORDER BY rule",
+		store.LogFile, now.Unix())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	silences = make([]Silence, 0)
+	for rows.Next() {
+		var s Silence
+		var until sql.NullInt64
+		err = rows.Scan(&s.Rule, &until)
+		if err != nil {
+			return
+		}
+		if until.Valid {
+			s.Until = time.Unix(until.Int64, 0)
+		}
+		silences = append(silences, s)
+	}
+	err = rows.Err()
+	return
+}
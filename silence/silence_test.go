@@ -0,0 +1,146 @@
+package silence
+
+import (
+	"database/sql"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"time"
+)
+
+const logFile = "logfile.log"
+
+var now = time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+
+func loadStore(t *testing.T) *Store {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(CreateSilencesTableStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Store{db, logFile}
+}
+
+func TestMuted(t *testing.T) {
+	silences := []Silence{{"traffic", time.Time{}}, {"bandwidth", now.Add(time.Hour)}, {"errors", now}}
+	testCases := []struct {
+		rule     string
+		expected bool
+	}{
+		{"traffic", true},
+		{"bandwidth", true},
+		// Silences expire at their end time
+		{"errors", false},
+		{"quiet", false},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := Muted(silences, testCase.rule, now); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestNotifiable(t *testing.T) {
+	silences := []Silence{{"acked", time.Time{}}, {"silenced", now.Add(time.Hour)}}
+	transitions := []alerts.Transition{
+		{Rule: "acked", From: alerts.Pending, To: alerts.Firing, Time: now, Value: 12},
+		{Rule: "acked", From: alerts.Firing, To: alerts.Resolved, Time: now, Value: 2},
+		{Rule: "silenced", From: alerts.Pending, To: alerts.Firing, Time: now, Value: 12},
+		{Rule: "silenced", From: alerts.Firing, To: alerts.Resolved, Time: now.Add(time.Hour), Value: 2},
+		{Rule: "traffic", From: alerts.Pending, To: alerts.Firing, Time: now, Value: 12},
+	}
+	expected := []alerts.Transition{
+		{Rule: "acked", From: alerts.Firing, To: alerts.Resolved, Time: now, Value: 2},
+		{Rule: "silenced", From: alerts.Firing, To: alerts.Resolved, Time: now.Add(time.Hour), Value: 2},
+		{Rule: "traffic", From: alerts.Pending, To: alerts.Firing, Time: now, Value: 12},
+	}
+	if actual := Notifiable(silences, transitions); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := loadStore(t)
+	defer store.DB.Close()
+	other := &Store{store.DB, "other.log"}
+	steps := []struct {
+		apply    func() error
+		expected []Silence
+	}{
+		{func() error { return nil }, []Silence{}},
+		{func() error { return store.Save(Silence{"traffic", time.Time{}}) }, []Silence{{"traffic", time.Time{}}}},
+		{
+			func() error { return store.Save(Silence{"bandwidth", now.Add(time.Hour)}) },
+			[]Silence{{"bandwidth", now.Add(time.Hour)}, {"traffic", time.Time{}}},
+		},
+		// Silences of other log files are ignored
+		{
+			func() error { return other.Save(Silence{"errors", now.Add(time.Hour)}) },
+			[]Silence{{"bandwidth", now.Add(time.Hour)}, {"traffic", time.Time{}}},
+		},
+		// Saving a silence replaces the rule's previous silence
+		{
+			func() error { return store.Save(Silence{"bandwidth", now.Add(2 * time.Hour)}) },
+			[]Silence{{"bandwidth", now.Add(2 * time.Hour)}, {"traffic", time.Time{}}},
+		},
+		// Resolving ends acknowledgements but not silences
+		{
+			func() error {
+				return store.Record([]alerts.Status{
+					{Rule: alerts.Rule{Name: "traffic"}, State: alerts.Resolved},
+					{Rule: alerts.Rule{Name: "bandwidth"}, State: alerts.Resolved},
+				})
+			},
+			[]Silence{{"bandwidth", now.Add(2 * time.Hour)}},
+		},
+		{
+			func() error {
+				for _, rule := range []string{"traffic", "errors", "quiet", "removed"} {
+					err := store.Save(Silence{rule, time.Time{}})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			[]Silence{{"bandwidth", now.Add(2 * time.Hour)}, {"errors", time.Time{}}, {"quiet", time.Time{}},
+				{"removed", time.Time{}}, {"traffic", time.Time{}}},
+		},
+		// Acknowledgements last while their rules hold, but end for rules that are
+		// inactive, e.g. because they resolved while logr wasn't running, and for rules
+		// that no longer exist
+		{
+			func() error {
+				return store.Record([]alerts.Status{
+					{Rule: alerts.Rule{Name: "traffic"}, State: alerts.Firing},
+					{Rule: alerts.Rule{Name: "errors"}, State: alerts.Pending},
+					{Rule: alerts.Rule{Name: "quiet"}, State: alerts.Inactive},
+					{Rule: alerts.Rule{Name: "bandwidth"}, State: alerts.Inactive},
+				})
+			},
+			[]Silence{{"bandwidth", now.Add(2 * time.Hour)}, {"errors", time.Time{}}, {"traffic", time.Time{}}},
+		},
+		// Saving an expired silence lifts the silence
+		{
+			func() error { return store.Save(Silence{"bandwidth", now}) },
+			[]Silence{{"errors", time.Time{}}, {"traffic", time.Time{}}},
+		},
+	}
+	for stepIdx, step := range steps {
+		err := step.apply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := store.Active(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(step.expected, actual) {
+			t.Errorf("Error on step %d.\nExpected: %v\nActual: %v", stepIdx, step.expected, actual)
+		}
+	}
+}
@@ -9,9 +9,10 @@ import (
 type TimeBuckets [][]timeseries.LogLine
 
 // The whichBucket function returns the index of the bucket in which timestamp belongs
-// by performing a binary search over the timestamps of each bucket
+// by performing a binary search over the timestamps of each bucket. Timestamps before
+// `begin` belong in the first bucket and timestamps after `end` in the last.
 func whichBucket(begin time.Time, end time.Time, numBuckets int, beginBucket int, endBucket int, timestamp time.Time) int {
-	if beginBucket == endBucket {
+	if beginBucket >= endBucket {
 		return beginBucket
 	}
 
@@ -33,7 +34,9 @@ func whichBucket(begin time.Time, end time.Time, numBuckets int, beginBucket int
 // A bucket is an even slice of time such that there are `numBuckets`
 // buckets between `begin` and `end`. In other words, Bucket will group
 // the log lines into `numBuckets` groups, where log lines in the same bucket
-// were all logged in the same slice of time.
+// were all logged in the same slice of time. Log lines are stored with a
+// resolution of one second, so those logged before `begin` or after `end` in
+// the same second are counted in the first or last bucket.
 func Bucket(begin time.Time, end time.Time, numBuckets int, logLines []timeseries.LogLine) TimeBuckets {
 	buckets := make([][]timeseries.LogLine, numBuckets)
 	for i := 0; i < len(logLines); i++ {
@@ -43,3 +46,23 @@ func Bucket(begin time.Time, end time.Time, numBuckets int, logLines []timeserie
 	}
 	return buckets
 }
+
+// Hits returns the number of log lines in each bucket
+func (buckets TimeBuckets) Hits() []int {
+	hits := make([]int, len(buckets))
+	for i, bucket := range buckets {
+		hits[i] = len(bucket)
+	}
+	return hits
+}
+
+// Bytes returns the total response bytes of the log lines in each bucket
+func (buckets TimeBuckets) Bytes() []int {
+	bytes := make([]int, len(buckets))
+	for i, bucket := range buckets {
+		for _, logLine := range bucket {
+			bytes[i] = bytes[i] + logLine.ResponseBytes
+		}
+	}
+	return bytes
+}
@@ -49,6 +49,31 @@ func TestBucket(t *testing.T) {
 				nil,
 			},
 		},
+		{
+			time.Unix(1000, 5e8),
+			time.Unix(1300, 5e8),
+			2,
+			[]timeseries.LogLine{
+				timeseries.LogLine{
+					Timestamp: time.Unix(1000, 0),
+				},
+				timeseries.LogLine{
+					Timestamp: time.Unix(1300, 9e8),
+				},
+			},
+			TimeBuckets{
+				{
+					timeseries.LogLine{
+						Timestamp: time.Unix(1000, 0),
+					},
+				},
+				{
+					timeseries.LogLine{
+						Timestamp: time.Unix(1300, 9e8),
+					},
+				},
+			},
+		},
 	}
 	for caseIdx, testCase := range testCases {
 		buckets := Bucket(testCase.begin, testCase.end, testCase.numBuckets, testCase.logLines)
@@ -58,3 +83,24 @@ func TestBucket(t *testing.T) {
 		}
 	}
 }
+
+func TestHitsAndBytes(t *testing.T) {
+	buckets := TimeBuckets{
+		{
+			timeseries.LogLine{ResponseBytes: 100},
+			timeseries.LogLine{ResponseBytes: 23},
+		},
+		nil,
+		{
+			timeseries.LogLine{ResponseBytes: 5},
+		},
+	}
+	expectedHits := []int{2, 0, 1}
+	if hits := buckets.Hits(); !cmp.Equal(hits, expectedHits) {
+		t.Errorf("Expected: %v\nActual: %v", expectedHits, hits)
+	}
+	expectedBytes := []int{123, 0, 5}
+	if bytes := buckets.Bytes(); !cmp.Equal(bytes, expectedBytes) {
+		t.Errorf("Expected: %v\nActual: %v", expectedBytes, bytes)
+	}
+}
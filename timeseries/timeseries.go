@@ -10,6 +10,12 @@ package timeseries
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/hyperloglog"
+	"math"
+	"sort"
 	"strings"
 	"time"
 )
@@ -28,23 +34,69 @@ CREATE TABLE IF NOT EXISTS loglines (
   request_path varchar(255),
   response_status integer,
   response_bytes integer,
-  log_file varchar(255)
+  log_file varchar(255),
+  request_duration integer
 )
 `
 
+// MigrateLogLinesTable adds any columns that are missing from a loglines table
+// created by an earlier version of logr. It should be run after CreateLogLinesTableStmt.
+func MigrateLogLinesTable(db *sql.DB) (err error) {
+	rows, err := db.Query("PRAGMA table_info(loglines)")
+	if err != nil {
+		return
+	}
+	hasDuration := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		if name == "request_duration" {
+			hasDuration = true
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return
+	}
+	if !hasDuration {
+		_, err = db.Exec("ALTER TABLE loglines ADD COLUMN request_duration integer")
+	}
+	return
+}
+
+// An UnknownFieldError is returned when a query is grouped by a field that does not exist
+var UnknownFieldError = errors.New("Unknown field")
+
+// ExactUniqueHostsWindow is the longest time window for which CountUniqueHosts
+// counts distinct hosts exactly. Longer windows are estimated with a HyperLogLog sketch.
+const ExactUniqueHostsWindow = time.Hour
+
 // LogLine is the data structure representing a single line in a server log
 type LogLine struct {
-	Host          string
-	User          string
-	AuthUser      string
-	Timestamp     time.Time
-	Method        string
-	Path          string
-	Status        uint16
-	ResponseBytes int
+	Host          string    `json:"host"`
+	User          string    `json:"user"`
+	AuthUser      string    `json:"authUser"`
+	Timestamp     time.Time `json:"timestamp"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        uint16    `json:"status"`
+	ResponseBytes int       `json:"responseBytes"`
+	// Duration is the time taken to serve the request, and HasDuration is whether the
+	// log line includes it. Fast requests are often logged with a duration of 0.
+	Duration    time.Duration `json:"duration"`
+	HasDuration bool          `json:"hasDuration"`
 }
 
-// The LogTimeSeries struct is used to record and query log lines
+// The LogTimeSeries struct is used to record and query log lines.
+// Every query method takes a *filter.Filter which further restricts the log lines
+// it considers; a nil filter considers every log line in the time window.
 type LogTimeSeries struct {
 	DB      *sql.DB
 	LogFile string
@@ -61,43 +113,73 @@ func extractSection(path string) string {
 	}
 }
 
+// Section returns the section of the log line's path, e.g. "api" for "/api/user"
+func (logLine LogLine) Section() string {
+	return extractSection(logLine.Path)
+}
+
+// The where method returns the WHERE clause shared by every query, which restricts
+// rows to this log file, the window between `start` and `end` and, if `f` is not nil,
+// the filter `f`. Parameters are numbered from `firstParam` so that a query can
+// place its own parameters before the clause.
+func (ts *LogTimeSeries) where(start time.Time, end time.Time, f *filter.Filter, firstParam int) (clause string, args []interface{}) {
+	clause = fmt.Sprintf("WHERE log_file LIKE $%d AND timestamp BETWEEN $%d AND $%d",
+		firstParam, firstParam+1, firstParam+2)
+	args = []interface{}{ts.LogFile, start.Unix(), end.Unix()}
+	if f != nil {
+		filterClause, filterArgs := f.SQL(firstParam + len(args))
+		clause = clause + " AND " + filterClause
+		args = append(args, filterArgs...)
+	}
+	return
+}
+
 // Record persists a LogLine to the time series datastore
 func (ts *LogTimeSeries) Record(logLine LogLine) (result sql.Result, err error) {
 	result, err = ts.DB.Exec("INSERT INTO loglines "+
 		"(remote_host, user, authuser, timestamp, request_method, "+
 		"request_section, request_path, response_status, "+
-		"response_bytes, log_file) "+
-		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		"response_bytes, log_file, request_duration) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
 		logLine.Host, logLine.User, logLine.AuthUser, logLine.Timestamp.Unix(),
 		logLine.Method, extractSection(logLine.Path), logLine.Path,
-		logLine.Status, logLine.ResponseBytes, ts.LogFile)
+		logLine.Status, logLine.ResponseBytes, ts.LogFile, durationColumn(logLine))
 	return
 }
 
+// The durationColumn function returns the value stored in the request_duration column
+// for a log line: NULL if it has no duration, otherwise the duration in microseconds
+func durationColumn(logLine LogLine) interface{} {
+	if !logLine.HasDuration {
+		return nil
+	}
+	return int64(logLine.Duration / time.Microsecond)
+}
+
 // MostCommonStatus returns the most common response status in all the LogLines
 // recorded between `start` and `end`.
-func (ts *LogTimeSeries) MostCommonStatus(start time.Time, end time.Time) (status uint16, err error) {
-	row := ts.DB.QueryRow("SELECT response_status FROM loglines "+
-		"WHERE log_file LIKE $1 AND timestamp BETWEEN $2 AND $3 "+
-		"GROUP BY response_status "+
-		"ORDER BY count(*) DESC "+
-		"LIMIT 1", ts.LogFile, start.Unix(), end.Unix())
+func (ts *LogTimeSeries) MostCommonStatus(start time.Time, end time.Time, f *filter.Filter) (status uint16, err error) {
+	where, args := ts.where(start, end, f, 1)
+	row := ts.DB.QueryRow("SELECT response_status FROM loglines "+where+
+		" GROUP BY response_status "+
+		"ORDER BY count(*) DESC, response_status "+
+		"LIMIT 1", args...)
 	err = row.Scan(&status)
 	return
 }
 
 type Count struct {
-	Label string
-	Count int
+	Label string `json:"label"`
+	Count int    `json:"count"`
 }
 
 // GetStatusCounts returns a slice of (status code, count) tuples sorted by count
 // (descending) from log lines recorded between `start` and `end`
-func (ts *LogTimeSeries) GetStatusCounts(start time.Time, end time.Time) (counts []Count, err error) {
-	rows, err := ts.DB.Query("SELECT response_status, count(*) FROM loglines "+
-		"WHERE log_file LIKE $1 AND timestamp BETWEEN $2 AND $3 "+
-		"GROUP BY response_status "+
-		"ORDER BY count(*) DESC", ts.LogFile, start.Unix(), end.Unix())
+func (ts *LogTimeSeries) GetStatusCounts(start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT response_status, count(*) FROM loglines "+where+
+		" GROUP BY response_status "+
+		"ORDER BY count(*) DESC, response_status", args...)
 	if err != nil {
 		return
 	}
@@ -113,23 +195,43 @@ func (ts *LogTimeSeries) GetStatusCounts(start time.Time, end time.Time) (counts
 // MostRequested Section returns the most common path section in all the LogLines
 // recorded between `start` and `end`. A path section is the part of the path
 // after the first '/', e.g. the section for "/api/user" is "api"
-func (ts *LogTimeSeries) MostRequestedSection(start time.Time, end time.Time) (section string, err error) {
-	row := ts.DB.QueryRow("SELECT request_section FROM loglines "+
-		"WHERE log_file LIKE $1 AND timestamp BETWEEN $2 AND $3 "+
-		"GROUP BY request_section "+
-		"ORDER BY count(*) DESC "+
-		"LIMIT 1", ts.LogFile, start.Unix(), end.Unix())
+func (ts *LogTimeSeries) MostRequestedSection(start time.Time, end time.Time, f *filter.Filter) (section string, err error) {
+	where, args := ts.where(start, end, f, 1)
+	row := ts.DB.QueryRow("SELECT request_section FROM loglines "+where+
+		" GROUP BY request_section "+
+		"ORDER BY count(*) DESC, request_section "+
+		"LIMIT 1", args...)
 	err = row.Scan(&section)
 	return
 }
 
 // GetSectionCounts returns a slice of (section, count) tuples sorted by count
 // (descending) from log lines recorded between `start` and `end`
-func (ts *LogTimeSeries) GetSectionCounts(start time.Time, end time.Time) (counts []Count, err error) {
-	rows, err := ts.DB.Query("SELECT request_section, count(*) FROM loglines "+
-		"WHERE log_file LIKE $1 AND timestamp BETWEEN $2 AND $3 "+
-		"GROUP BY request_section "+
-		"ORDER BY count(*) DESC", ts.LogFile, start.Unix(), end.Unix())
+func (ts *LogTimeSeries) GetSectionCounts(start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT request_section, count(*) FROM loglines "+where+
+		" GROUP BY request_section "+
+		"ORDER BY count(*) DESC, request_section", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		count := Count{}
+		rows.Scan(&count.Label, &count.Count)
+		counts = append(counts, count)
+	}
+	return
+}
+
+// GetHostCounts returns a slice of (remote host, count) tuples for the `limit` most
+// active hosts, sorted by count (descending), from log lines recorded between `start` and `end`
+func (ts *LogTimeSeries) GetHostCounts(start time.Time, end time.Time, limit int, f *filter.Filter) (counts []Count, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT remote_host, count(*) FROM loglines "+where+
+		" GROUP BY remote_host "+
+		"ORDER BY count(*) DESC, remote_host "+
+		fmt.Sprintf("LIMIT %d", limit), args...)
 	if err != nil {
 		return
 	}
@@ -142,12 +244,64 @@ func (ts *LogTimeSeries) GetSectionCounts(start time.Time, end time.Time) (count
 	return
 }
 
-func (ts *LogTimeSeries) GetLogLines(start time.Time, end time.Time) (logLines []LogLine, err error) {
+// CountUniqueHosts returns the number of distinct remote hosts in the log lines
+// recorded between `start` and `end`. The count is exact for windows up to
+// ExactUniqueHostsWindow long; for longer windows it is a HyperLogLog estimate,
+// which avoids holding every distinct host in memory at once.
+func (ts *LogTimeSeries) CountUniqueHosts(start time.Time, end time.Time, f *filter.Filter) (uniqueHosts int, err error) {
+	where, args := ts.where(start, end, f, 1)
+	if end.Sub(start) <= ExactUniqueHostsWindow {
+		row := ts.DB.QueryRow("SELECT count(DISTINCT remote_host) FROM loglines "+where, args...)
+		err = row.Scan(&uniqueHosts)
+		return
+	}
+	rows, err := ts.DB.Query("SELECT remote_host FROM loglines "+where, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	sketch := hyperloglog.New(hyperloglog.DefaultPrecision)
+	for rows.Next() {
+		var host string
+		rows.Scan(&host)
+		sketch.Add(host)
+	}
+	uniqueHosts = int(sketch.Count())
+	return
+}
+
+// GetFirstTimestamp returns the timestamp of the earliest log line recorded for this
+// log file, and false if no log lines have been recorded
+func (ts *LogTimeSeries) GetFirstTimestamp() (first time.Time, ok bool, err error) {
+	var timestamp sql.NullInt64
+	row := ts.DB.QueryRow("SELECT min(timestamp) FROM loglines WHERE log_file LIKE $1", ts.LogFile)
+	err = row.Scan(&timestamp)
+	if err != nil || !timestamp.Valid {
+		return
+	}
+	return time.Unix(timestamp.Int64, 0), true, nil
+}
+
+func (ts *LogTimeSeries) GetLogLines(start time.Time, end time.Time, f *filter.Filter) (logLines []LogLine, err error) {
+	where, args := ts.where(start, end, f, 1)
+	return ts.queryLogLines(where+" ORDER BY timestamp DESC", args)
+}
+
+// GetRecentLogLines returns at most `limit` of the newest log lines recorded between
+// `start` and `end`, newest first. Lines with the same timestamp are ordered newest
+// recorded first.
+func (ts *LogTimeSeries) GetRecentLogLines(start time.Time, end time.Time, limit int, f *filter.Filter) (logLines []LogLine, err error) {
+	where, args := ts.where(start, end, f, 1)
+	return ts.queryLogLines(where+fmt.Sprintf(" ORDER BY timestamp DESC, id DESC LIMIT %d", limit), args)
+}
+
+// The queryLogLines method returns the log lines selected by a WHERE clause, which
+// may be followed by ORDER BY and LIMIT clauses
+func (ts *LogTimeSeries) queryLogLines(clauses string, args []interface{}) (logLines []LogLine, err error) {
 	rows, err := ts.DB.Query("SELECT remote_host, user, authuser, timestamp, "+
-		"request_method, request_path, response_status, response_bytes "+
-		"FROM loglines "+
-		"WHERE log_file LIKE $1 AND timestamp BETWEEN $2 AND $3 "+
-		"ORDER BY timestamp DESC", ts.LogFile, start.Unix(), end.Unix())
+		"request_method, request_path, response_status, response_bytes, "+
+		"request_duration "+
+		"FROM loglines "+clauses, args...)
 	if err != nil {
 		return
 	}
@@ -155,19 +309,219 @@ func (ts *LogTimeSeries) GetLogLines(start time.Time, end time.Time) (logLines [
 	for rows.Next() {
 		logLine := LogLine{}
 		var timestamp int64
+		var duration sql.NullInt64
 		rows.Scan(&logLine.Host, &logLine.User, &logLine.AuthUser, &timestamp,
-			&logLine.Method, &logLine.Path, &logLine.Status, &logLine.ResponseBytes)
+			&logLine.Method, &logLine.Path, &logLine.Status, &logLine.ResponseBytes,
+			&duration)
 		logLine.Timestamp = time.Unix(timestamp, 0)
+		logLine.Duration = time.Duration(duration.Int64) * time.Microsecond
+		logLine.HasDuration = duration.Valid
 		logLines = append(logLines, logLine)
 	}
 	return
 }
 
 // GetAverageTraffic returns the average traffic per second between `start` and `end`.
-func (ts *LogTimeSeries) GetAverageTraffic(start time.Time, end time.Time) (avgTraffic float64, err error) {
-	row := ts.DB.QueryRow("SELECT CAST(count(*) AS FLOAT) / ($1 - $2) FROM loglines "+
-		"WHERE log_file LIKE $3 AND timestamp BETWEEN $4 AND $5",
-		end.Unix(), start.Unix(), ts.LogFile, start.Unix(), end.Unix())
+func (ts *LogTimeSeries) GetAverageTraffic(start time.Time, end time.Time, f *filter.Filter) (avgTraffic float64, err error) {
+	where, args := ts.where(start, end, f, 3)
+	row := ts.DB.QueryRow("SELECT CAST(count(*) AS FLOAT) / ($1 - $2) FROM loglines "+where,
+		append([]interface{}{end.Unix(), start.Unix()}, args...)...)
 	err = row.Scan(&avgTraffic)
 	return
 }
+
+// GetTotalBytes returns the total number of response bytes in the log lines
+// recorded between `start` and `end`.
+func (ts *LogTimeSeries) GetTotalBytes(start time.Time, end time.Time, f *filter.Filter) (totalBytes int, err error) {
+	where, args := ts.where(start, end, f, 1)
+	row := ts.DB.QueryRow("SELECT coalesce(sum(response_bytes), 0) FROM loglines "+where, args...)
+	err = row.Scan(&totalBytes)
+	return
+}
+
+// GetAverageBandwidth returns the average number of response bytes per second
+// between `start` and `end`.
+func (ts *LogTimeSeries) GetAverageBandwidth(start time.Time, end time.Time, f *filter.Filter) (avgBandwidth float64, err error) {
+	where, args := ts.where(start, end, f, 3)
+	row := ts.DB.QueryRow("SELECT CAST(coalesce(sum(response_bytes), 0) AS FLOAT) / ($1 - $2) FROM loglines "+where,
+		append([]interface{}{end.Unix(), start.Unix()}, args...)...)
+	err = row.Scan(&avgBandwidth)
+	return
+}
+
+// GetSectionBytes returns a slice of (section, total response bytes) tuples sorted
+// by bytes (descending) from log lines recorded between `start` and `end`
+func (ts *LogTimeSeries) GetSectionBytes(start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT request_section, sum(response_bytes) FROM loglines "+where+
+		" GROUP BY request_section "+
+		"ORDER BY sum(response_bytes) DESC, request_section", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		count := Count{}
+		rows.Scan(&count.Label, &count.Count)
+		counts = append(counts, count)
+	}
+	return
+}
+
+// GetStatusBytes returns a slice of (status code, total response bytes) tuples sorted
+// by bytes (descending) from log lines recorded between `start` and `end`
+func (ts *LogTimeSeries) GetStatusBytes(start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT response_status, sum(response_bytes) FROM loglines "+where+
+		" GROUP BY response_status "+
+		"ORDER BY sum(response_bytes) DESC, response_status", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		count := Count{}
+		rows.Scan(&count.Label, &count.Count)
+		counts = append(counts, count)
+	}
+	return
+}
+
+// The groupColumn function returns the loglines column for a filter field name
+func groupColumn(groupBy string) (column string, err error) {
+	column, ok := filter.Fields[groupBy]
+	if !ok {
+		return "", UnknownFieldError
+	}
+	return
+}
+
+// GetCountsBy returns a slice of (value, count) tuples sorted by count (descending)
+// from log lines recorded between `start` and `end`, grouped by the value of the
+// field `groupBy`. Fields are named as in filter expressions, e.g. "host".
+func (ts *LogTimeSeries) GetCountsBy(groupBy string, start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	column, err := groupColumn(groupBy)
+	if err != nil {
+		return
+	}
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query(fmt.Sprintf("SELECT %s, count(*) FROM loglines ", column)+where+
+		fmt.Sprintf(" GROUP BY %s ORDER BY count(*) DESC, %s", column, column), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		count := Count{}
+		rows.Scan(&count.Label, &count.Count)
+		counts = append(counts, count)
+	}
+	return
+}
+
+// GetBytesBy returns a slice of (value, total response bytes) tuples sorted by bytes
+// (descending) from log lines recorded between `start` and `end`, grouped by the
+// value of the field `groupBy`.
+func (ts *LogTimeSeries) GetBytesBy(groupBy string, start time.Time, end time.Time, f *filter.Filter) (counts []Count, err error) {
+	column, err := groupColumn(groupBy)
+	if err != nil {
+		return
+	}
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query(fmt.Sprintf("SELECT %s, sum(response_bytes) FROM loglines ", column)+where+
+		fmt.Sprintf(" GROUP BY %s ORDER BY sum(response_bytes) DESC, %s", column, column), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		count := Count{}
+		rows.Scan(&count.Label, &count.Count)
+		counts = append(counts, count)
+	}
+	return
+}
+
+// A DurationPercentile is a percentile of the request durations of a group of log lines
+type DurationPercentile struct {
+	Label    string
+	Duration time.Duration
+	Count    int
+}
+
+// The percentile function returns the `p`th percentile of a non-empty sorted slice
+// using the nearest-rank method
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// GetDurationPercentilesBy returns the `p`th percentile request duration of the log
+// lines recorded between `start` and `end`, grouped by the value of the field `groupBy`
+// and sorted by duration (descending). Log lines without a request duration are ignored.
+func (ts *LogTimeSeries) GetDurationPercentilesBy(groupBy string, p float64, start time.Time, end time.Time, f *filter.Filter) (percentiles []DurationPercentile, err error) {
+	column, err := groupColumn(groupBy)
+	if err != nil {
+		return
+	}
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query(fmt.Sprintf("SELECT %s, request_duration FROM loglines ", column)+where+
+		fmt.Sprintf(" AND request_duration IS NOT NULL ORDER BY %s, request_duration", column), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var label string
+	var durations []int64
+	flush := func() {
+		if len(durations) > 0 {
+			percentiles = append(percentiles, DurationPercentile{label,
+				time.Duration(percentile(durations, p)) * time.Microsecond, len(durations)})
+		}
+	}
+	for rows.Next() {
+		var rowLabel string
+		var duration int64
+		rows.Scan(&rowLabel, &duration)
+		if rowLabel != label {
+			flush()
+			label = rowLabel
+			durations = nil
+		}
+		durations = append(durations, duration)
+	}
+	flush()
+	sort.SliceStable(percentiles, func(i, j int) bool {
+		return percentiles[i].Duration > percentiles[j].Duration
+	})
+	return
+}
+
+// GetDurationPercentile returns the `p`th percentile request duration of all the log
+// lines recorded between `start` and `end`, and the number of them that have a duration.
+// The duration is 0 if none of them do.
+func (ts *LogTimeSeries) GetDurationPercentile(p float64, start time.Time, end time.Time, f *filter.Filter) (duration time.Duration, count int, err error) {
+	where, args := ts.where(start, end, f, 1)
+	rows, err := ts.DB.Query("SELECT request_duration FROM loglines "+where+
+		" AND request_duration IS NOT NULL ORDER BY request_duration", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var durations []int64
+	for rows.Next() {
+		var d int64
+		rows.Scan(&d)
+		durations = append(durations, d)
+	}
+	count = len(durations)
+	if count > 0 {
+		duration = time.Duration(percentile(durations, p)) * time.Microsecond
+	}
+	return
+}
@@ -2,7 +2,9 @@ package timeseries
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/filter"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"testing"
@@ -23,6 +25,7 @@ type logLineRow struct {
 	Status    uint16
 	Bytes     int
 	LogFile   string
+	Duration  sql.NullInt64
 }
 
 func loadDB() (db *sql.DB, err error) {
@@ -61,6 +64,33 @@ func TestExtractSection(t *testing.T) {
 	}
 }
 
+func TestMigrateLogLinesTable(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE loglines (id integer primary key autoincrement, " +
+		"remote_host varchar(255), user varchar(255), authuser varchar(255), " +
+		"timestamp integer, request_method varchar(255), request_section varchar(255), " +
+		"request_path varchar(255), response_status integer, response_bytes integer, " +
+		"log_file varchar(255))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = MigrateLogLinesTable(db)
+		if err != nil {
+			t.Errorf("Error on migration %d: %v", i, err)
+		}
+	}
+	ts := LogTimeSeries{db, logFile}
+	_, err = ts.Record(LogLine{Duration: time.Second, HasDuration: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestRecord(t *testing.T) {
 	var emptyTimestamp time.Time
 	testCases := []struct {
@@ -77,6 +107,8 @@ func TestRecord(t *testing.T) {
 				"/report",
 				200,
 				123,
+				0,
+				false,
 			},
 			logLineRow{
 				1,
@@ -90,12 +122,35 @@ func TestRecord(t *testing.T) {
 				200,
 				123,
 				logFile,
+				sql.NullInt64{},
 			},
 		},
 		{
 			LogLine{},
 			logLineRow{Id: 1, LogFile: logFile, Timestamp: emptyTimestamp.Unix()},
 		},
+		{
+			LogLine{Path: "/report", HasDuration: true},
+			logLineRow{
+				Id:        1,
+				LogFile:   logFile,
+				Timestamp: emptyTimestamp.Unix(),
+				Section:   "report",
+				Path:      "/report",
+				Duration:  sql.NullInt64{0, true},
+			},
+		},
+		{
+			LogLine{Path: "/api/user", Duration: 1500 * time.Microsecond, HasDuration: true},
+			logLineRow{
+				Id:        1,
+				LogFile:   logFile,
+				Timestamp: emptyTimestamp.Unix(),
+				Section:   "api",
+				Path:      "/api/user",
+				Duration:  sql.NullInt64{1500, true},
+			},
+		},
 	}
 	for caseIdx, testCase := range testCases {
 		func() {
@@ -118,7 +173,7 @@ func TestRecord(t *testing.T) {
 			row := db.QueryRow("SELECT * FROM loglines")
 			err = row.Scan(&actual.Id, &actual.Ip, &actual.User, &actual.AuthUser,
 				&actual.Timestamp, &actual.Method, &actual.Section, &actual.Path,
-				&actual.Status, &actual.Bytes, &actual.LogFile)
+				&actual.Status, &actual.Bytes, &actual.LogFile, &actual.Duration)
 			if err != nil {
 				t.Error(err)
 			}
@@ -148,6 +203,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -158,6 +215,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -168,6 +227,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			200,
@@ -185,6 +246,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -195,6 +258,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -205,6 +270,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -215,6 +282,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 			},
 			200,
@@ -232,6 +301,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -242,6 +313,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -252,6 +325,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -262,6 +337,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 			},
 			500,
@@ -279,6 +356,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -289,6 +368,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -299,6 +380,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -309,6 +392,8 @@ func TestMostCommonStatus(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 			},
 			200,
@@ -330,7 +415,7 @@ func TestMostCommonStatus(t *testing.T) {
 					t.Error(err)
 				}
 			}
-			actualStatus, err := ts.MostCommonStatus(testCase.start, testCase.end)
+			actualStatus, err := ts.MostCommonStatus(testCase.start, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -351,7 +436,7 @@ func TestItHandlesMostCommonStatusForEmptyDb(t *testing.T) {
 	ts := LogTimeSeries{db, logFile}
 	start := parseTime("09/May/2018:15:00:39 +0000")
 	end := parseTime("09/May/2018:19:00:39 +0000")
-	_, err = ts.MostCommonStatus(start, end)
+	_, err = ts.MostCommonStatus(start, end, nil)
 	if err != sql.ErrNoRows {
 		t.Fail()
 	}
@@ -375,6 +460,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -385,6 +472,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -395,6 +484,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			[]Count{
@@ -415,6 +506,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -425,6 +518,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -435,6 +530,8 @@ func TestGetStatusCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			[]Count{
@@ -466,7 +563,7 @@ func TestGetStatusCounts(t *testing.T) {
 
 				}
 			}
-			actualCounts, err := ts.GetStatusCounts(testCase.start, testCase.end)
+			actualCounts, err := ts.GetStatusCounts(testCase.start, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -496,6 +593,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -506,6 +605,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/api/user",
 					200,
 					234,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -516,6 +617,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/api/user",
 					200,
 					34,
+					0,
+					false,
 				},
 			},
 			"api",
@@ -533,6 +636,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -543,6 +648,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/api/user",
 					200,
 					234,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -553,6 +660,8 @@ func TestMostRequestedSection(t *testing.T) {
 					"/api/user",
 					200,
 					34,
+					0,
+					false,
 				},
 			},
 			"report",
@@ -571,7 +680,7 @@ func TestMostRequestedSection(t *testing.T) {
 			for i := range testCase.inputLog {
 				ts.Record(testCase.inputLog[i])
 			}
-			section, err := ts.MostRequestedSection(testCase.start, testCase.end)
+			section, err := ts.MostRequestedSection(testCase.start, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -592,7 +701,7 @@ func TestMostRequestSectionEmptyDb(t *testing.T) {
 	ts := LogTimeSeries{db, logFile}
 	start := parseTime("09/May/2018:15:00:00 +0000")
 	end := parseTime("09/May/2018:16:00:40 +0000")
-	_, err = ts.MostRequestedSection(start, end)
+	_, err = ts.MostRequestedSection(start, end, nil)
 	if err != sql.ErrNoRows {
 		t.Fail()
 	}
@@ -616,6 +725,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -626,6 +737,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -636,6 +749,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			[]Count{
@@ -656,6 +771,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -666,6 +783,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -676,6 +795,8 @@ func TestGetSectionCounts(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			[]Count{
@@ -706,7 +827,7 @@ func TestGetSectionCounts(t *testing.T) {
 					t.Error(err)
 				}
 			}
-			actualCounts, err := ts.GetSectionCounts(testCase.start, testCase.end)
+			actualCounts, err := ts.GetSectionCounts(testCase.start, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -736,6 +857,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -746,6 +869,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -756,6 +881,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:16:00:00 +0000"),
@@ -770,6 +897,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -780,6 +909,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -790,6 +921,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 		},
@@ -804,6 +937,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -814,6 +949,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -824,6 +961,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:17:00:00 +0000"),
@@ -838,6 +977,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -848,6 +989,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 			},
 		},
@@ -862,6 +1005,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -872,6 +1017,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -882,6 +1029,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:16:00:00 +0000"),
@@ -896,6 +1045,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -906,6 +1057,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 		},
@@ -920,6 +1073,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -930,6 +1085,8 @@ func TestGetLogLines(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -940,6 +1097,8 @@ func TestGetLogLines(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("08/May/2018:16:00:00 +0000"),
@@ -958,7 +1117,7 @@ func TestGetLogLines(t *testing.T) {
 			for _, logLine := range testCase.inputRows {
 				ts.Record(logLine)
 			}
-			actual, err := ts.GetLogLines(testCase.begin, testCase.end)
+			actual, err := ts.GetLogLines(testCase.begin, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -970,6 +1129,72 @@ func TestGetLogLines(t *testing.T) {
 	}
 }
 
+func TestGetRecentLogLines(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	start := parseTime("09/May/2018:17:00:00 +0000")
+	paths := []string{"/report", "/api/user", "/api/order", "/api/cart"}
+	for i, path := range paths {
+		ts.Record(LogLine{Path: path, Status: 200, Timestamp: start.Add(time.Duration(i/2) * time.Second)})
+	}
+	ts.Record(LogLine{Path: "/api/late", Status: 200, Timestamp: start.Add(time.Minute)})
+	api, err := filter.Parse("section=api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		limit         int
+		f             *filter.Filter
+		expectedPaths []string
+	}{
+		{2, nil, []string{"/api/cart", "/api/order"}},
+		{10, nil, []string{"/api/cart", "/api/order", "/api/user", "/report"}},
+		{10, api, []string{"/api/cart", "/api/order", "/api/user"}},
+	}
+	for caseIdx, testCase := range testCases {
+		logLines, err := ts.GetRecentLogLines(start, start.Add(10*time.Second), testCase.limit, testCase.f)
+		if err != nil {
+			t.Error(err)
+		}
+		actual := make([]string, 0)
+		for _, logLine := range logLines {
+			actual = append(actual, logLine.Path)
+		}
+		if !cmp.Equal(testCase.expectedPaths, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expectedPaths, actual)
+		}
+	}
+}
+
+func TestLogLineDurations(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	start := parseTime("09/May/2018:17:00:00 +0000")
+	expected := []LogLine{
+		{Path: "/api/user", Timestamp: start, Duration: 1500 * time.Microsecond, HasDuration: true},
+		{Path: "/api/order", Timestamp: start, HasDuration: true},
+		{Path: "/report", Timestamp: start},
+	}
+	for _, logLine := range expected {
+		ts.Record(logLine)
+	}
+	logLines, err := ts.GetLogLines(start, start, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(expected, logLines) {
+		t.Errorf("Expected: %v\nActual: %v", expected, logLines)
+	}
+}
+
 func duration(dur string) time.Duration {
 	duration, err := time.ParseDuration(dur)
 	if err != nil {
@@ -996,6 +1221,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1006,6 +1233,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1016,6 +1245,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:17:00:00 +0000"),
@@ -1033,6 +1264,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1043,6 +1276,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1053,6 +1288,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:17:00:00 +0000"),
@@ -1070,6 +1307,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1080,6 +1319,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/api/user",
 					500,
 					123,
+					0,
+					false,
 				},
 				LogLine{
 					"127.0.0.1",
@@ -1090,6 +1331,8 @@ func TestGetAverageTraffic(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:17:00:01 +0000"),
@@ -1108,7 +1351,7 @@ func TestGetAverageTraffic(t *testing.T) {
 			for _, logLine := range testCase.inputRows {
 				ts.Record(logLine)
 			}
-			actual, err := ts.GetAverageTraffic(testCase.begin, testCase.end)
+			actual, err := ts.GetAverageTraffic(testCase.begin, testCase.end, nil)
 			if err != nil {
 				t.Error(err)
 			}
@@ -1119,3 +1362,428 @@ func TestGetAverageTraffic(t *testing.T) {
 		}()
 	}
 }
+
+func TestGetHostCounts(t *testing.T) {
+	testCases := []struct {
+		inputLines     []LogLine
+		limit          int
+		expectedCounts []Count
+		start          time.Time
+		end            time.Time
+	}{
+		{
+			[]LogLine{
+				LogLine{Host: "10.0.0.1", Timestamp: parseTime("09/May/2018:16:00:39 +0000")},
+				LogLine{Host: "10.0.0.2", Timestamp: parseTime("09/May/2018:16:00:40 +0000")},
+				LogLine{Host: "10.0.0.1", Timestamp: parseTime("09/May/2018:16:00:41 +0000")},
+				LogLine{Host: "10.0.0.3", Timestamp: parseTime("09/May/2018:16:00:42 +0000")},
+				LogLine{Host: "10.0.0.1", Timestamp: parseTime("09/May/2018:16:00:43 +0000")},
+				LogLine{Host: "10.0.0.2", Timestamp: parseTime("09/May/2018:16:00:44 +0000")},
+			},
+			2,
+			[]Count{
+				{"10.0.0.1", 3},
+				{"10.0.0.2", 2},
+			},
+			parseTime("09/May/2018:16:00:00 +0000"),
+			parseTime("09/May/2018:17:00:00 +0000"),
+		},
+		{
+			[]LogLine{
+				LogLine{Host: "10.0.0.1", Timestamp: parseTime("09/May/2018:16:00:39 +0000")},
+				LogLine{Host: "10.0.0.2", Timestamp: parseTime("09/May/2018:18:00:40 +0000")},
+			},
+			5,
+			[]Count{
+				{"10.0.0.2", 1},
+			},
+			parseTime("09/May/2018:18:00:00 +0000"),
+			parseTime("09/May/2018:19:00:00 +0000"),
+		},
+		{
+			[]LogLine{},
+			5,
+			nil,
+			parseTime("09/May/2018:17:00:00 +0000"),
+			parseTime("09/May/2018:19:00:00 +0000"),
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			db, err := loadDB()
+			if err != nil {
+				t.Error(err)
+			}
+			defer db.Close()
+			ts := LogTimeSeries{db, logFile}
+			for _, logLine := range testCase.inputLines {
+				_, err = ts.Record(logLine)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+			actualCounts, err := ts.GetHostCounts(testCase.start, testCase.end, testCase.limit, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(testCase.expectedCounts, actualCounts) {
+				t.Errorf("Error on case %d.\nExpected: %#v\nActual: %#v\n",
+					caseIdx, testCase.expectedCounts, actualCounts)
+			}
+		}()
+	}
+}
+
+func TestCountUniqueHosts(t *testing.T) {
+	begin := parseTime("09/May/2018:16:00:00 +0000")
+	testCases := []struct {
+		numHosts int
+		start    time.Time
+		end      time.Time
+		expected int
+	}{
+		{0, begin, begin.Add(time.Minute), 0},
+		{3, begin, begin.Add(time.Minute), 3},
+		{3, begin.Add(time.Minute), begin.Add(2 * time.Minute), 0},
+		// Windows longer than ExactUniqueHostsWindow use the HyperLogLog
+		// estimate, which is exact for very small cardinalities
+		{3, begin, begin.Add(2 * ExactUniqueHostsWindow), 3},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			db, err := loadDB()
+			if err != nil {
+				t.Error(err)
+			}
+			defer db.Close()
+			ts := LogTimeSeries{db, logFile}
+			for i := 0; i < testCase.numHosts; i++ {
+				for j := 0; j <= i; j++ {
+					ts.Record(LogLine{
+						Host:      fmt.Sprintf("10.0.0.%d", i),
+						Timestamp: begin.Add(time.Duration(j) * time.Second),
+					})
+				}
+			}
+			actual, err := ts.CountUniqueHosts(testCase.start, testCase.end, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v",
+					caseIdx, testCase.expected, actual)
+			}
+		}()
+	}
+}
+
+func TestGetFirstTimestamp(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	_, ok, err := ts.GetFirstTimestamp()
+	if err != nil {
+		t.Error(err)
+	}
+	if ok {
+		t.Errorf("Expected no first timestamp for an empty db")
+	}
+	expected := parseTime("09/May/2018:16:00:00 +0000")
+	ts.Record(LogLine{Path: "/report", Timestamp: expected.Add(time.Minute)})
+	ts.Record(LogLine{Path: "/report", Timestamp: expected})
+	other := LogTimeSeries{db, "other.log"}
+	other.Record(LogLine{Path: "/report", Timestamp: expected.Add(-time.Hour)})
+	actual, ok, err := ts.GetFirstTimestamp()
+	if err != nil {
+		t.Error(err)
+	}
+	if !ok || !actual.Equal(expected) {
+		t.Errorf("Expected: %v\nActual: %v (ok: %v)", expected, actual, ok)
+	}
+}
+
+func bandwidthTestLines() []LogLine {
+	return []LogLine{
+		LogLine{Path: "/report", Status: 200, ResponseBytes: 100,
+			Timestamp: parseTime("09/May/2018:17:00:00 +0000")},
+		LogLine{Path: "/api/user", Status: 500, ResponseBytes: 50,
+			Timestamp: parseTime("09/May/2018:17:00:01 +0000")},
+		LogLine{Path: "/report", Status: 200, ResponseBytes: 300,
+			Timestamp: parseTime("09/May/2018:17:00:02 +0000")},
+		LogLine{Path: "/api/user", Status: 404, ResponseBytes: 20,
+			Timestamp: parseTime("09/May/2018:17:00:10 +0000")},
+	}
+}
+
+func TestGetTotalBytes(t *testing.T) {
+	testCases := []struct {
+		start    time.Time
+		end      time.Time
+		expected int
+	}{
+		{parseTime("09/May/2018:17:00:00 +0000"), parseTime("09/May/2018:17:00:10 +0000"), 470},
+		{parseTime("09/May/2018:17:00:01 +0000"), parseTime("09/May/2018:17:00:02 +0000"), 350},
+		{parseTime("09/May/2018:18:00:00 +0000"), parseTime("09/May/2018:19:00:00 +0000"), 0},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			db, err := loadDB()
+			if err != nil {
+				t.Error(err)
+			}
+			defer db.Close()
+			ts := LogTimeSeries{db, logFile}
+			for _, logLine := range bandwidthTestLines() {
+				ts.Record(logLine)
+			}
+			actual, err := ts.GetTotalBytes(testCase.start, testCase.end, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v",
+					caseIdx, testCase.expected, actual)
+			}
+		}()
+	}
+}
+
+func TestGetAverageBandwidth(t *testing.T) {
+	testCases := []struct {
+		start    time.Time
+		end      time.Time
+		expected float64
+	}{
+		{parseTime("09/May/2018:17:00:00 +0000"), parseTime("09/May/2018:17:00:10 +0000"), 47},
+		{parseTime("09/May/2018:17:00:01 +0000"), parseTime("09/May/2018:17:00:03 +0000"), 175},
+		{parseTime("09/May/2018:18:00:00 +0000"), parseTime("09/May/2018:18:00:10 +0000"), 0},
+	}
+	for caseIdx, testCase := range testCases {
+		func() {
+			db, err := loadDB()
+			if err != nil {
+				t.Error(err)
+			}
+			defer db.Close()
+			ts := LogTimeSeries{db, logFile}
+			for _, logLine := range bandwidthTestLines() {
+				ts.Record(logLine)
+			}
+			actual, err := ts.GetAverageBandwidth(testCase.start, testCase.end, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v",
+					caseIdx, testCase.expected, actual)
+			}
+		}()
+	}
+}
+
+func TestGetSectionAndStatusBytes(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	for _, logLine := range bandwidthTestLines() {
+		ts.Record(logLine)
+	}
+	start := parseTime("09/May/2018:17:00:00 +0000")
+	end := parseTime("09/May/2018:17:00:10 +0000")
+
+	sectionBytes, err := ts.GetSectionBytes(start, end, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedSectionBytes := []Count{{"report", 400}, {"api", 70}}
+	if !cmp.Equal(expectedSectionBytes, sectionBytes) {
+		t.Errorf("Expected: %#v\nActual: %#v\n", expectedSectionBytes, sectionBytes)
+	}
+
+	statusBytes, err := ts.GetStatusBytes(start, end, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedStatusBytes := []Count{{"200", 400}, {"500", 50}, {"404", 20}}
+	if !cmp.Equal(expectedStatusBytes, statusBytes) {
+		t.Errorf("Expected: %#v\nActual: %#v\n", expectedStatusBytes, statusBytes)
+	}
+}
+
+func TestFilteredQueries(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	for _, logLine := range bandwidthTestLines() {
+		ts.Record(logLine)
+	}
+	ts.Record(LogLine{Host: "10.0.0.1", Path: "/api/user", Status: 503, ResponseBytes: 10,
+		Timestamp: parseTime("09/May/2018:17:00:05 +0000")})
+	start := parseTime("09/May/2018:17:00:00 +0000")
+	end := parseTime("09/May/2018:17:00:10 +0000")
+
+	f, err := filter.Parse(`status>=500 and section=api and not host~"10.*"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sectionCounts, err := ts.GetSectionCounts(start, end, f)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedSectionCounts := []Count{{"api", 1}}
+	if !cmp.Equal(expectedSectionCounts, sectionCounts) {
+		t.Errorf("Expected: %#v\nActual: %#v\n", expectedSectionCounts, sectionCounts)
+	}
+
+	avgTraffic, err := ts.GetAverageTraffic(start, end, f)
+	if err != nil {
+		t.Error(err)
+	}
+	if avgTraffic != 0.1 {
+		t.Errorf("Expected: %v\nActual: %v\n", 0.1, avgTraffic)
+	}
+
+	f, err = filter.Parse(`section=api`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalBytes, err := ts.GetTotalBytes(start, end, f)
+	if err != nil {
+		t.Error(err)
+	}
+	if totalBytes != 80 {
+		t.Errorf("Expected: %v\nActual: %v\n", 80, totalBytes)
+	}
+	logLines, err := ts.GetLogLines(start, end, f)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(logLines) != 3 {
+		t.Errorf("Expected 3 log lines\nActual: %#v\n", logLines)
+	}
+}
+
+func TestGetCountsAndBytesBy(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	for _, logLine := range bandwidthTestLines() {
+		ts.Record(logLine)
+	}
+	start := parseTime("09/May/2018:17:00:00 +0000")
+	end := parseTime("09/May/2018:17:00:10 +0000")
+
+	counts, err := ts.GetCountsBy("path", start, end, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedCounts := []Count{{"/api/user", 2}, {"/report", 2}}
+	if !cmp.Equal(expectedCounts, counts) {
+		t.Errorf("Expected: %#v\nActual: %#v\n", expectedCounts, counts)
+	}
+
+	bytes, err := ts.GetBytesBy("status", start, end, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedBytes := []Count{{"200", 400}, {"500", 50}, {"404", 20}}
+	if !cmp.Equal(expectedBytes, bytes) {
+		t.Errorf("Expected: %#v\nActual: %#v\n", expectedBytes, bytes)
+	}
+
+	_, err = ts.GetCountsBy("timestamp; DROP TABLE loglines", start, end, nil)
+	if err != UnknownFieldError {
+		t.Errorf("Expected: %v\nActual: %v\n", UnknownFieldError, err)
+	}
+}
+
+func TestGetDurationPercentiles(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	ts := LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:17:00:00 +0000")
+	for i := 1; i <= 10; i++ {
+		ts.Record(LogLine{Path: "/api/user", Timestamp: begin,
+			Duration: time.Duration(i) * time.Millisecond, HasDuration: true})
+	}
+	ts.Record(LogLine{Path: "/report", Timestamp: begin, Duration: 50 * time.Millisecond, HasDuration: true})
+	ts.Record(LogLine{Path: "/report", Timestamp: begin})
+	// Requests logged with a request time of 0.000 still have a duration
+	for i := 0; i < 2; i++ {
+		ts.Record(LogLine{Path: "/login", Timestamp: begin, HasDuration: true})
+	}
+	end := begin.Add(time.Minute)
+
+	testCases := []struct {
+		p                   float64
+		expectedPercentiles []DurationPercentile
+		expectedOverall     time.Duration
+	}{
+		{
+			50,
+			[]DurationPercentile{
+				{"report", 50 * time.Millisecond, 1},
+				{"api", 5 * time.Millisecond, 10},
+				{"login", 0, 2},
+			},
+			5 * time.Millisecond,
+		},
+		{
+			90,
+			[]DurationPercentile{
+				{"report", 50 * time.Millisecond, 1},
+				{"api", 9 * time.Millisecond, 10},
+				{"login", 0, 2},
+			},
+			10 * time.Millisecond,
+		},
+		{
+			100,
+			[]DurationPercentile{
+				{"report", 50 * time.Millisecond, 1},
+				{"api", 10 * time.Millisecond, 10},
+				{"login", 0, 2},
+			},
+			50 * time.Millisecond,
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		percentiles, err := ts.GetDurationPercentilesBy("section", testCase.p, begin, end, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if !cmp.Equal(testCase.expectedPercentiles, percentiles) {
+			t.Errorf("Error on case %d.\nExpected: %#v\nActual: %#v\n",
+				caseIdx, testCase.expectedPercentiles, percentiles)
+		}
+		overall, count, err := ts.GetDurationPercentile(testCase.p, begin, end, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if overall != testCase.expectedOverall || count != 13 {
+			t.Errorf("Error on case %d.\nExpected: %v of 13\nActual: %v of %d\n",
+				caseIdx, testCase.expectedOverall, overall, count)
+		}
+	}
+
+	overall, count, err := ts.GetDurationPercentile(50, end, end.Add(time.Minute), nil)
+	if err != nil || overall != 0 || count != 0 {
+		t.Errorf("Expected 0 with no durations, got %v of %d, %v", overall, count, err)
+	}
+}
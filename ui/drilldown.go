@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/jdormit/logr/filter"
+	"strconv"
+)
+
+// topPaths is the number of paths shown when drilled down into a section
+const topPaths = 5
+
+// Breadcrumb describes how far the dashboard is drilled down, e.g. "All sections > /api"
+func Breadcrumb(state *UIState) string {
+	if state.Section == "" {
+		return "All sections"
+	}
+	return fmt.Sprintf("All sections > /%s", state.Section)
+}
+
+// The viewFilter function returns the state's filter restricted to the section the
+// dashboard is drilled down into, if any
+func viewFilter(state *UIState) *filter.Filter {
+	if state.Section == "" {
+		return state.Filter
+	}
+	section := filter.Comparison{Field: "section", Op: "=", Value: state.Section}
+	expr := "section=" + strconv.Quote(state.Section)
+	if state.Filter == nil {
+		return &filter.Filter{Expr: expr, Root: section}
+	}
+	return &filter.Filter{
+		Expr: fmt.Sprintf("(%s) and %s", state.Filter.Expr, expr),
+		Root: filter.And{Left: state.Filter.Root, Right: section},
+	}
+}
+
+// The moveSectionCursor function moves the highlighted section `delta` rows down the
+// section breakdown, or up if `delta` is negative
+func moveSectionCursor(state *UIState, delta int) {
+	if state.Section != "" {
+		return
+	}
+	state.SectionCursor += delta
+	if state.SectionCursor >= len(state.SectionCounts) {
+		state.SectionCursor = len(state.SectionCounts) - 1
+	}
+	if state.SectionCursor < 0 {
+		state.SectionCursor = 0
+	}
+}
+
+// The drillDown function scopes the dashboard to the highlighted section
+func drillDown(state *UIState) {
+	if state.Section != "" || state.SectionCursor >= len(state.SectionCounts) {
+		return
+	}
+	state.Section = state.SectionCounts[state.SectionCursor].Label
+}
+
+// The drillUp function returns the dashboard from a section to every section
+func drillUp(state *UIState) {
+	state.Section = ""
+	state.PathCounts = nil
+}
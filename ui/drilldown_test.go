@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/timeseries"
+	"testing"
+	"time"
+)
+
+func TestDrillDownKeys(t *testing.T) {
+	sections := []timeseries.Count{{"api", 3}, {"report", 2}, {"login", 1}}
+	testCases := []struct {
+		keys               []string
+		expectedCursor     int
+		expectedSection    string
+		expectedBreadcrumb string
+	}{
+		{[]string{"<Down>"}, 1, "", "All sections"},
+		{[]string{"<Down>", "<Down>", "<Down>", "<Down>"}, 2, "", "All sections"},
+		{[]string{"<Up>"}, 0, "", "All sections"},
+		{[]string{"<Down>", "<Enter>"}, 1, "report", "All sections > /report"},
+		// The cursor doesn't move while drilled down
+		{[]string{"<Enter>", "<Down>"}, 0, "api", "All sections > /api"},
+		{[]string{"<Down>", "<Enter>", "u"}, 1, "", "All sections"},
+		{[]string{"<Enter>", "<Backspace>"}, 0, "", "All sections"},
+	}
+	for caseIdx, testCase := range testCases {
+		state := &UIState{SectionCounts: sections}
+		for _, key := range testCase.keys {
+			HandleKey(state, key)
+		}
+		if state.SectionCursor != testCase.expectedCursor || state.Section != testCase.expectedSection {
+			t.Errorf("Error on test case %d.\nExpected cursor %d and section %q\nActual: %d and %q", caseIdx,
+				testCase.expectedCursor, testCase.expectedSection, state.SectionCursor, state.Section)
+		}
+		if breadcrumb := Breadcrumb(state); breadcrumb != testCase.expectedBreadcrumb {
+			t.Errorf("Error on test case %d.\nExpected breadcrumb: %s\nActual: %s",
+				caseIdx, testCase.expectedBreadcrumb, breadcrumb)
+		}
+	}
+	// Enter does nothing without any sections
+	state := &UIState{}
+	HandleKey(state, "<Enter>")
+	if state.Section != "" {
+		t.Errorf("Expected no section to drill into, but drilled into %q", state.Section)
+	}
+}
+
+func TestViewFilter(t *testing.T) {
+	testCases := []struct {
+		state        *UIState
+		expectedExpr string
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{&UIState{}, "", "", nil},
+		{&UIState{Filter: mustParseFilter("status>=500")}, "status>=500", "response_status >= $1",
+			[]interface{}{500}},
+		{&UIState{Section: "api"}, `section="api"`, "request_section = $1", []interface{}{"api"}},
+		{&UIState{Section: "api", Filter: mustParseFilter("status>=500")}, `(status>=500) and section="api"`,
+			"(response_status >= $1 AND request_section = $2)", []interface{}{500, "api"}},
+	}
+	for caseIdx, testCase := range testCases {
+		f := viewFilter(testCase.state)
+		if f.String() != testCase.expectedExpr {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expectedExpr, f)
+		}
+		if f == nil {
+			continue
+		}
+		clause, args := f.SQL(1)
+		if clause != testCase.expectedSQL || !cmp.Equal(testCase.expectedArgs, args) {
+			t.Errorf("Error on test case %d.\nExpected: %s %v\nActual: %s %v",
+				caseIdx, testCase.expectedSQL, testCase.expectedArgs, clause, args)
+		}
+	}
+}
+
+func TestDrilledNextUIState(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	logLines := []timeseries.LogLine{
+		{Host: "10.0.0.1", Timestamp: begin.Add(time.Minute), Path: "/api/users", Status: 200, ResponseBytes: 10},
+		{Host: "10.0.0.1", Timestamp: begin.Add(time.Minute), Path: "/api/users", Status: 500, ResponseBytes: 10},
+		{Host: "10.0.0.2", Timestamp: begin.Add(3 * time.Minute), Path: "/api/orders", Status: 200, ResponseBytes: 10},
+		{Host: "10.0.0.3", Timestamp: begin.Add(2 * time.Minute), Path: "/report", Status: 404, ResponseBytes: 10},
+	}
+	for _, logLine := range logLines {
+		ts.Record(logLine)
+	}
+	state := &UIState{Timescale: 5, Granularity: 5, Begin: begin, Section: "api"}
+	NextUIState(state, &ts, begin.Add(4*time.Minute))
+	expected := &UIState{
+		Timescale:     5,
+		Granularity:   5,
+		Begin:         begin,
+		Section:       "api",
+		SectionCounts: []timeseries.Count{{"api", 3}},
+		PathCounts:    []timeseries.Count{{"/api/users", 2}, {"/api/orders", 1}},
+		StatusCounts:  []timeseries.Count{{"200", 2}, {"500", 1}},
+		HostCounts:    []timeseries.Count{{"10.0.0.1", 2}, {"10.0.0.2", 1}},
+		UniqueHosts:   2,
+		Traffic:       []int{0, 2, 0, 1, 0},
+		TrafficBytes:  []int{0, 20, 0, 10, 0},
+		Summary: Summary{Hits: 3, HitsPerSecond: 3.0 / 240, ErrorRate: 100.0 / 3, UniqueHosts: 2,
+			Bytes: 30},
+		SummaryDuration: 4 * time.Minute,
+	}
+	if !cmp.Equal(expected, state) {
+		t.Errorf("Expected: %+v\nActual: %+v", expected, state)
+	}
+}
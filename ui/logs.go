@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/gizak/termui"
+	"github.com/jdormit/logr/timeseries"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logRows is the number of log lines shown at once in the log viewer
+const logRows = 10
+
+// logLimit is the number of recent log lines the log viewer loads and searches
+const logLimit = 500
+
+// searchFields are the fields that a "field:value" search term can match, by name
+var searchFields = map[string]func(timeseries.LogLine) string{
+	"host":   func(l timeseries.LogLine) string { return l.Host },
+	"user":   func(l timeseries.LogLine) string { return l.User },
+	"method": func(l timeseries.LogLine) string { return l.Method },
+	"path":   func(l timeseries.LogLine) string { return l.Path },
+	"status": func(l timeseries.LogLine) string { return strconv.Itoa(int(l.Status)) },
+}
+
+// LogMessage describes a log line, e.g. "18:03:00 10.0.0.1 GET /api/users 200 123 bytes"
+func LogMessage(logLine timeseries.LogLine) string {
+	message := fmt.Sprintf("%s %s %s %s %d %d bytes", logLine.Timestamp.Format("15:04:05"),
+		logLine.Host, logLine.Method, logLine.Path, logLine.Status, logLine.ResponseBytes)
+	if logLine.HasDuration {
+		message = fmt.Sprintf("%s %v", message, logLine.Duration)
+	}
+	return message
+}
+
+// The matchesSearch function returns whether `logLine` matches every term of `search`.
+// A "field:value" term matches lines whose field starts with the value, and any other
+// term matches lines whose message contains it, ignoring case.
+func matchesSearch(logLine timeseries.LogLine, search string) bool {
+	message := strings.ToLower(LogMessage(logLine))
+	for _, term := range strings.Fields(strings.ToLower(search)) {
+		parts := strings.SplitN(term, ":", 2)
+		if field, ok := searchFields[parts[0]]; ok && len(parts) == 2 {
+			if !strings.HasPrefix(strings.ToLower(field(logLine)), parts[1]) {
+				return false
+			}
+		} else if !strings.Contains(message, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// The matchingLogLines function returns the loaded log lines that match the log
+// viewer's search, newest first
+func matchingLogLines(state *UIState) (logLines []timeseries.LogLine) {
+	logLines = make([]timeseries.LogLine, 0)
+	for _, logLine := range state.LogLines {
+		if matchesSearch(logLine, state.LogSearch) {
+			logLines = append(logLines, logLine)
+		}
+	}
+	return
+}
+
+// The visibleLogLines function returns the matching log lines shown in the log viewer,
+// starting from the state's LogOffset
+func visibleLogLines(state *UIState) []timeseries.LogLine {
+	logLines := matchingLogLines(state)
+	if state.LogOffset >= len(logLines) {
+		return nil
+	}
+	logLines = logLines[state.LogOffset:]
+	if len(logLines) > logRows {
+		logLines = logLines[:logRows]
+	}
+	return logLines
+}
+
+// LogMessages returns a message for each log line shown in the log viewer
+func LogMessages(state *UIState) (messages []string) {
+	messages = make([]string, 0)
+	for _, logLine := range visibleLogLines(state) {
+		messages = append(messages, LogMessage(logLine))
+	}
+	return
+}
+
+// The toggleLogs function shows or hides the log viewer. It opens following the
+// newest log lines.
+func toggleLogs(state *UIState) {
+	state.ShowLogs = !state.ShowLogs
+	state.LogOffset = 0
+	state.LogFollow = state.ShowLogs
+	if !state.ShowLogs {
+		state.LogLines = nil
+	}
+}
+
+// The toggleFollow function switches the log viewer between following the newest
+// log lines and holding the lines it has loaded still
+func toggleFollow(state *UIState) {
+	state.LogFollow = !state.LogFollow
+	if state.LogFollow {
+		state.LogOffset = 0
+	}
+}
+
+// The scrollLogs function moves the log viewer `rows` lines towards older lines, or
+// towards newer ones if `rows` is negative. Scrolling to older lines stops following.
+func scrollLogs(state *UIState, rows int) {
+	maxOffset := len(matchingLogLines(state)) - logRows
+	state.LogOffset += rows
+	if state.LogOffset > maxOffset {
+		state.LogOffset = maxOffset
+	}
+	if state.LogOffset < 0 {
+		state.LogOffset = 0
+	}
+	if state.LogOffset > 0 {
+		state.LogFollow = false
+	}
+}
+
+// The openSearchPrompt function shows the log viewer and opens a prompt whose input
+// searches it as it is typed
+func openSearchPrompt(state *UIState) {
+	if !state.ShowLogs {
+		toggleLogs(state)
+	}
+	openPrompt(state, SearchPrompt, "Search log lines, e.g. status:5 /api (Esc clears)", state.LogSearch)
+}
+
+// The statusColor function returns the termui color of a status code's class
+func statusColor(status uint16) string {
+	switch {
+	case status >= 500:
+		return "fg-red"
+	case status >= 400:
+		return "fg-yellow"
+	case status >= 300:
+		return "fg-cyan"
+	default:
+		return "fg-green"
+	}
+}
+
+func logViewer(state *UIState) termui.GridBufferer {
+	if !state.ShowLogs {
+		return empty()
+	}
+	items := make([]string, 0)
+	for _, logLine := range visibleLogLines(state) {
+		items = append(items, fmt.Sprintf("[%s](%s)", LogMessage(logLine), statusColor(logLine.Status)))
+	}
+	if len(items) == 0 {
+		items = append(items, "No log lines")
+	}
+	mode := "paused, f to follow"
+	if state.LogFollow {
+		mode = "following"
+	}
+	label := fmt.Sprintf("Log Lines (%s, ? to search, PgUp/PgDn to scroll)", mode)
+	if state.LogSearch != "" {
+		label = fmt.Sprintf("Log Lines matching %q (%s, ? to search, PgUp/PgDn to scroll)", state.LogSearch, mode)
+	}
+	list := termui.NewList()
+	list.Items = items
+	list.BorderLabel = label
+	list.ItemFgColor = termui.ColorBlack
+	list.Height = 2 + logRows
+	return list
+}
+
+// The loadLogLines function reloads the log viewer's lines between `begin` and `end`
+// if it is shown and following, or hasn't loaded any lines yet
+func loadLogLines(state *UIState, ts *timeseries.LogTimeSeries, begin time.Time, end time.Time) (err error) {
+	if !state.ShowLogs || !state.LogFollow && state.LogLines != nil {
+		return
+	}
+	logLines, err := ts.GetRecentLogLines(begin, end, logLimit, viewFilter(state))
+	if err != nil {
+		return
+	}
+	state.LogLines = logLines
+	return
+}
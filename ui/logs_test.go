@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/timeseries"
+	"testing"
+	"time"
+)
+
+func TestLogMessage(t *testing.T) {
+	at := parseTime("09/May/2018:18:03:00 +0000")
+	testCases := []struct {
+		logLine  timeseries.LogLine
+		expected string
+	}{
+		{
+			timeseries.LogLine{Host: "10.0.0.1", Timestamp: at, Method: "GET", Path: "/api/users", Status: 200,
+				ResponseBytes: 123},
+			"18:03:00 10.0.0.1 GET /api/users 200 123 bytes",
+		},
+		{
+			timeseries.LogLine{Host: "10.0.0.2", Timestamp: at, Method: "POST", Path: "/login", Status: 503,
+				ResponseBytes: 0, Duration: 1500 * time.Millisecond, HasDuration: true},
+			"18:03:00 10.0.0.2 POST /login 503 0 bytes 1.5s",
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := LogMessage(testCase.logLine); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestMatchesSearch(t *testing.T) {
+	logLine := timeseries.LogLine{Host: "10.0.0.1", Method: "GET", Path: "/api/users", Status: 503,
+		Timestamp: parseTime("09/May/2018:18:03:00 +0000")}
+	testCases := []struct {
+		search   string
+		expected bool
+	}{
+		{"", true},
+		{"users", true},
+		{"USERS", true},
+		{"orders", false},
+		{"status:5", true},
+		{"status:50 path:/api", true},
+		{"status:4", false},
+		{"host:10.0 get", true},
+		{"method:post", false},
+		// Unknown fields are searched for as text
+		{"colour:red", false},
+		{"18:03", true},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := matchesSearch(logLine, testCase.search); actual != testCase.expected {
+			t.Errorf("Error on test case %d (%q).\nExpected: %v\nActual: %v",
+				caseIdx, testCase.search, testCase.expected, actual)
+		}
+	}
+}
+
+// The logLines function returns `n` log lines one second apart starting at `begin`,
+// newest first, with a 500 status every third line
+func logLines(n int, begin time.Time) (logLines []timeseries.LogLine) {
+	for i := n - 1; i >= 0; i-- {
+		status := uint16(200)
+		if i%3 == 0 {
+			status = 500
+		}
+		logLines = append(logLines, timeseries.LogLine{Host: "10.0.0.1", Method: "GET", Path: "/report",
+			Status: status, Timestamp: begin.Add(time.Duration(i) * time.Second)})
+	}
+	return
+}
+
+func TestLogViewerKeys(t *testing.T) {
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	lines := logLines(25, begin)
+	testCases := []struct {
+		keys             []string
+		expectedShow     bool
+		expectedFollow   bool
+		expectedOffset   int
+		expectedSearch   string
+		expectedMessages []string
+	}{
+		{[]string{}, true, true, 0, "", LogMessages(&UIState{LogLines: lines})},
+		{[]string{"v"}, false, false, 0, "", []string{}},
+		{[]string{"<PageDown>"}, true, false, 10, "", LogMessages(&UIState{LogLines: lines[10:]})},
+		// Scrolling stops at the oldest page
+		{[]string{"<PageDown>", "<PageDown>", "<PageDown>"}, true, false, 15, "",
+			LogMessages(&UIState{LogLines: lines[15:]})},
+		{[]string{"<PageDown>", "<PageUp>"}, true, false, 0, "", LogMessages(&UIState{LogLines: lines})},
+		{[]string{"<PageDown>", "f"}, true, true, 0, "", LogMessages(&UIState{LogLines: lines})},
+		{[]string{"f"}, true, false, 0, "", LogMessages(&UIState{LogLines: lines})},
+		{
+			[]string{"?", "s", "t", "a", "t", "u", "s", ":", "5"},
+			true, true, 0, "status:5",
+			[]string{
+				"18:00:24 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:21 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:18 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:15 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:12 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:09 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:06 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:03 10.0.0.1 GET /report 500 0 bytes",
+				"18:00:00 10.0.0.1 GET /report 500 0 bytes",
+			},
+		},
+		{
+			[]string{"?", "1", "8", ":", "0", "0", ":", "0", "<Enter>"},
+			true, true, 0, "18:00:0",
+			LogMessages(&UIState{LogLines: lines[15:]}),
+		},
+		{[]string{"?", "x", "<Escape>"}, true, true, 0, "", LogMessages(&UIState{LogLines: lines})},
+	}
+	for caseIdx, testCase := range testCases {
+		state := &UIState{}
+		HandleKey(state, "v")
+		state.LogLines = lines
+		for _, key := range testCase.keys {
+			HandleKey(state, key)
+		}
+		if state.ShowLogs != testCase.expectedShow || state.LogFollow != testCase.expectedFollow ||
+			state.LogOffset != testCase.expectedOffset || state.LogSearch != testCase.expectedSearch {
+			t.Errorf("Error on test case %d.\nExpected show %v, follow %v, offset %d, search %q\n"+
+				"Actual: %v, %v, %d, %q", caseIdx, testCase.expectedShow, testCase.expectedFollow,
+				testCase.expectedOffset, testCase.expectedSearch, state.ShowLogs, state.LogFollow,
+				state.LogOffset, state.LogSearch)
+		}
+		if !state.ShowLogs {
+			continue
+		}
+		if messages := LogMessages(state); !cmp.Equal(testCase.expectedMessages, messages) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expectedMessages, messages)
+		}
+	}
+}
+
+func TestLoadLogLines(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	record := func(path string, at time.Time) {
+		ts.Record(timeseries.LogLine{Host: "10.0.0.1", Method: "GET", Path: path, Status: 200, Timestamp: at})
+	}
+	paths := func(state *UIState) (paths []string) {
+		for _, logLine := range state.LogLines {
+			paths = append(paths, logLine.Path)
+		}
+		return
+	}
+	record("/report", begin.Add(time.Second))
+	record("/api/users", begin.Add(2*time.Second))
+	state := &UIState{Timescale: 5, Granularity: 5, Begin: begin}
+	NextUIState(state, &ts, begin.Add(3*time.Second))
+	if state.LogLines != nil {
+		t.Errorf("Expected no log lines while the log viewer is hidden, got %v", paths(state))
+	}
+	HandleKey(state, "v")
+	NextUIState(state, &ts, begin.Add(3*time.Second))
+	if expected := []string{"/api/users", "/report"}; !cmp.Equal(expected, paths(state)) {
+		t.Errorf("Expected: %v\nActual: %v", expected, paths(state))
+	}
+	// The log viewer holds its lines still until it follows again
+	HandleKey(state, "f")
+	record("/login", begin.Add(4*time.Second))
+	NextUIState(state, &ts, begin.Add(5*time.Second))
+	if expected := []string{"/api/users", "/report"}; !cmp.Equal(expected, paths(state)) {
+		t.Errorf("Expected: %v\nActual: %v", expected, paths(state))
+	}
+	HandleKey(state, "f")
+	state.Section = "api"
+	NextUIState(state, &ts, begin.Add(5*time.Second))
+	if expected := []string{"/api/users"}; !cmp.Equal(expected, paths(state)) {
+		t.Errorf("Expected: %v\nActual: %v", expected, paths(state))
+	}
+	state.Section = ""
+	NextUIState(state, &ts, begin.Add(5*time.Second))
+	if expected := []string{"/login", "/api/users", "/report"}; !cmp.Equal(expected, paths(state)) {
+		t.Errorf("Expected: %v\nActual: %v", expected, paths(state))
+	}
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/gizak/termui"
+	"github.com/jdormit/logr/filter"
+)
+
+// PromptKind identifies what a Prompt's input will be used for once it is submitted
+type PromptKind int
+
+const (
+	// FilterPrompt reads a filter expression that is applied to every query
+	FilterPrompt PromptKind = iota
+	// SilencePrompt reads a rule name and a duration to silence the rule for
+	SilencePrompt
+	// JumpPrompt reads the time to move the dashboard's window to
+	JumpPrompt
+	// SearchPrompt reads the log viewer's search, which is applied as it is typed
+	SearchPrompt
+)
+
+// A Prompt is a single line of text input shown at the bottom of the dashboard.
+// While a prompt is open, it receives every keypress.
+type Prompt struct {
+	Kind  PromptKind
+	Label string
+	Input string
+	Error string
+}
+
+// The openPrompt function opens a prompt of the given kind, pre-filled with `input`
+func openPrompt(state *UIState, kind PromptKind, label string, input string) {
+	state.Prompt = &Prompt{Kind: kind, Label: label, Input: input}
+}
+
+// The handlePromptKey function edits or submits the open prompt in response to a keypress
+func handlePromptKey(state *UIState, key string) {
+	prompt := state.Prompt
+	switch key {
+	case "<Escape>":
+		if prompt.Kind == SearchPrompt {
+			state.LogSearch = ""
+		}
+		state.Prompt = nil
+		return
+	case "<Enter>":
+		submitPrompt(state)
+	case "<Backspace>", "<C-<Backspace>>", "<C-8>":
+		if len(prompt.Input) > 0 {
+			prompt.Input = prompt.Input[:len(prompt.Input)-1]
+		}
+	case "<Space>":
+		prompt.Input = prompt.Input + " "
+	default:
+		// Printable characters are reported as themselves, special keys as <Name>
+		if len(key) == 1 {
+			prompt.Input = prompt.Input + key
+		}
+	}
+	if prompt.Kind == SearchPrompt {
+		state.LogSearch = prompt.Input
+		state.LogOffset = 0
+	}
+}
+
+// The submitPrompt function applies the input of the open prompt. The prompt
+// stays open with an error message if the input is invalid.
+func submitPrompt(state *UIState) {
+	prompt := state.Prompt
+	switch prompt.Kind {
+	case FilterPrompt:
+		f, err := filter.Parse(prompt.Input)
+		if err != nil {
+			prompt.Error = err.Error()
+			return
+		}
+		state.Filter = f
+	case SilencePrompt:
+		if message := submitSilence(state, prompt.Input); message != "" {
+			prompt.Error = message
+			return
+		}
+	case JumpPrompt:
+		if message := submitJump(state, prompt.Input); message != "" {
+			prompt.Error = message
+			return
+		}
+	}
+	state.Prompt = nil
+}
+
+func promptBar(state *UIState) termui.GridBufferer {
+	if state.Prompt == nil {
+		return empty()
+	}
+	prompt := termui.NewParagraph(fmt.Sprintf("%s_", state.Prompt.Input))
+	prompt.BorderLabel = state.Prompt.Label
+	prompt.TextFgColor = termui.ColorBlack
+	prompt.Height = 3
+	if state.Prompt.Error != "" {
+		prompt.BorderLabel = fmt.Sprintf("%s (%s)", state.Prompt.Label, state.Prompt.Error)
+		prompt.BorderFg = termui.ColorRed
+	}
+	return prompt
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/timeseries"
+	"testing"
+	"time"
+)
+
+func mustParseFilter(expr string) *filter.Filter {
+	f, err := filter.Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func TestFilterPrompt(t *testing.T) {
+	testCases := []struct {
+		initialState  *UIState
+		keys          []string
+		expectedState *UIState
+	}{
+		{
+			&UIState{},
+			[]string{"/"},
+			&UIState{Prompt: &Prompt{Kind: FilterPrompt, Label: "Filter"}},
+		},
+		{
+			&UIState{},
+			[]string{"/", "s", "t", "a", "t", "u", "s", ">", "=", "5", "0", "0", "<Enter>"},
+			&UIState{Filter: mustParseFilter("status>=500")},
+		},
+		{
+			&UIState{},
+			[]string{"/", "b", "<Space>", "x", "<Backspace>", "<Backspace>", "<Backspace>",
+				"m", "e", "t", "h", "o", "d", "=", "G", "E", "T"},
+			&UIState{Prompt: &Prompt{Kind: FilterPrompt, Label: "Filter", Input: "method=GET"}},
+		},
+		{
+			&UIState{Filter: mustParseFilter("status>=500")},
+			[]string{"/", "<Backspace>", "<Backspace>", "<Backspace>", "x", "<Enter>"},
+			&UIState{
+				Filter: mustParseFilter("status>=500"),
+				Prompt: &Prompt{
+					Kind:  FilterPrompt,
+					Label: "Filter",
+					Input: "status>=x",
+					Error: "Invalid filter at position 8: status must be compared to a number",
+				},
+			},
+		},
+		{
+			&UIState{Filter: mustParseFilter("status>=500")},
+			[]string{"/", "x", "<Escape>"},
+			&UIState{Filter: mustParseFilter("status>=500")},
+		},
+		{
+			&UIState{Filter: mustParseFilter("status>=500")},
+			[]string{"/", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"<Backspace>", "<Backspace>", "<Enter>"},
+			&UIState{},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		for _, key := range testCase.keys {
+			HandleKey(testCase.initialState, key)
+		}
+		if !cmp.Equal(testCase.expectedState, testCase.initialState) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v",
+				caseIdx, testCase.expectedState, testCase.initialState)
+		}
+	}
+}
+
+func TestSubmittedFilterApplies(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	ts.Record(timeseries.LogLine{Host: "10.0.0.1", Timestamp: begin, Path: "/api/users", Status: 200})
+	ts.Record(timeseries.LogLine{Host: "10.0.0.1", Timestamp: begin, Path: "/report", Status: 500})
+	state := &UIState{Timescale: 5, Granularity: 5, Begin: begin, Paused: true}
+	NextUIState(state, &ts, begin.Add(time.Minute))
+	// The dashboard refreshes after every handled key, so the filter applies as soon
+	// as it is submitted rather than on the next tick
+	for _, key := range []string{"/", "s", "t", "a", "t", "u", "s", "=", "5", "0", "0", "<Enter>"} {
+		if HandleKey(state, key) {
+			NextUIState(state, &ts, begin.Add(time.Minute))
+		}
+	}
+	if expected := []timeseries.Count{{"report", 1}}; !cmp.Equal(expected, state.SectionCounts) {
+		t.Errorf("Expected: %v\nActual: %v", expected, state.SectionCounts)
+	}
+}
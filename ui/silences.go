@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/gizak/termui"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/silence"
+	"strings"
+	"time"
+)
+
+// defaultSilence is the duration the silence prompt is pre-filled with
+const defaultSilence = time.Hour
+
+// clock returns the current time. It is a variable so that tests can replace it.
+var clock = time.Now
+
+// The muted function returns true if the alerts of `rule` are acknowledged or silenced
+func muted(state *UIState, rule string) bool {
+	for _, s := range state.Silences {
+		if s.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// The saveSilence function replaces the silence of `s.Rule` in the state's active
+// silences with `s`, and queues it to be persisted
+func saveSilence(state *UIState, s silence.Silence, now time.Time) {
+	silences := make([]silence.Silence, 0, len(state.Silences)+1)
+	for _, existing := range state.Silences {
+		if existing.Rule != s.Rule {
+			silences = append(silences, existing)
+		}
+	}
+	if s.Active(now) {
+		silences = append(silences, s)
+	}
+	state.Silences = silences
+	state.SilenceChanges = append(state.SilenceChanges, s)
+}
+
+// The acknowledge function acknowledges every firing alert that isn't already muted
+func acknowledge(state *UIState) {
+	for _, status := range state.Alerts {
+		if status.State == alerts.Firing && !muted(state, status.Rule.Name) {
+			saveSilence(state, silence.Silence{Rule: status.Rule.Name}, clock())
+		}
+	}
+}
+
+// The openSilencePrompt function opens a prompt to silence a rule, pre-filled with the
+// first firing alert that isn't muted, or else the first rule, and the default duration
+func openSilencePrompt(state *UIState) {
+	rule := ""
+	for _, status := range state.Alerts {
+		if status.State == alerts.Firing && !muted(state, status.Rule.Name) {
+			rule = status.Rule.Name
+			break
+		}
+	}
+	if rule == "" && len(state.Alerts) > 0 {
+		rule = state.Alerts[0].Rule.Name
+	}
+	input := ""
+	if rule != "" {
+		input = fmt.Sprintf("%s %v", rule, defaultSilence)
+	}
+	openPrompt(state, SilencePrompt, "Silence rule for duration (0 lifts the silence)", input)
+}
+
+// The submitSilence function silences the rule named in the silence prompt's input,
+// e.g. "traffic 30m", returning an error message if the input is invalid
+func submitSilence(state *UIState, input string) string {
+	fields := strings.Fields(input)
+	if len(fields) != 2 {
+		return "expected a rule and a duration, e.g. traffic 30m"
+	}
+	known := false
+	for _, status := range state.Alerts {
+		known = known || status.Rule.Name == fields[0]
+	}
+	if !known {
+		return fmt.Sprintf("unknown rule %q", fields[0])
+	}
+	duration, err := time.ParseDuration(fields[1])
+	if err != nil || duration < 0 {
+		return fmt.Sprintf("invalid duration %q", fields[1])
+	}
+	now := clock()
+	saveSilence(state, silence.Silence{Rule: fields[0], Until: now.Add(duration)}, now)
+	return ""
+}
+
+// SilenceMessages returns a message describing each active silence in `state`
+func SilenceMessages(state *UIState, now time.Time) (messages []string) {
+	messages = make([]string, 0)
+	for _, s := range state.Silences {
+		if s.Acknowledged() {
+			messages = append(messages, fmt.Sprintf("%s: acknowledged until it resolves", s.Rule))
+		} else {
+			messages = append(messages, fmt.Sprintf("%s: silenced until %s (%v left)",
+				s.Rule, s.Until.Format("15:04:05"), s.Until.Sub(now).Truncate(time.Second)))
+		}
+	}
+	return
+}
+
+func silences(state *UIState) termui.GridBufferer {
+	if !state.ShowSilences {
+		return empty()
+	}
+	messages := SilenceMessages(state, time.Now())
+	if len(messages) == 0 {
+		messages = []string{"No active silences"}
+	}
+	list := termui.NewList()
+	list.Items = messages
+	list.BorderLabel = "Silences (a to acknowledge, s to silence, S to hide)"
+	list.ItemFgColor = termui.ColorBlack
+	list.Height = 2 + len(messages)
+	return list
+}
@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/silence"
+	"testing"
+	"time"
+)
+
+func TestSilenceKeys(t *testing.T) {
+	now := parseTime("09/May/2018:18:00:00 +0000")
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	traffic := alerts.Status{Rule: alerts.Rule{Name: "traffic"}, State: alerts.Firing}
+	bandwidth := alerts.Status{Rule: alerts.Rule{Name: "bandwidth"}, State: alerts.Firing}
+	quiet := alerts.Status{Rule: alerts.Rule{Name: "quiet"}}
+	statuses := []alerts.Status{quiet, traffic, bandwidth}
+	acked := silence.Silence{Rule: "traffic"}
+	silenced := silence.Silence{Rule: "bandwidth", Until: now.Add(30 * time.Minute)}
+	testCases := []struct {
+		initialState  *UIState
+		keys          []string
+		expectedState *UIState
+	}{
+		// Acknowledging mutes every firing alert
+		{
+			&UIState{Alerts: statuses},
+			[]string{"a"},
+			&UIState{
+				Alerts:         statuses,
+				Silences:       []silence.Silence{acked, {Rule: "bandwidth"}},
+				SilenceChanges: []silence.Silence{acked, {Rule: "bandwidth"}},
+			},
+		},
+		{
+			&UIState{Alerts: statuses, Silences: []silence.Silence{silenced}},
+			[]string{"a"},
+			&UIState{
+				Alerts:         statuses,
+				Silences:       []silence.Silence{silenced, acked},
+				SilenceChanges: []silence.Silence{acked},
+			},
+		},
+		// The silence prompt is pre-filled with the first firing alert that isn't muted
+		{
+			&UIState{Alerts: statuses, Silences: []silence.Silence{acked}},
+			[]string{"s"},
+			&UIState{
+				Alerts:   statuses,
+				Silences: []silence.Silence{acked},
+				Prompt: &Prompt{Kind: SilencePrompt, Label: "Silence rule for duration (0 lifts the silence)",
+					Input: "bandwidth 1h0m0s"},
+			},
+		},
+		{
+			&UIState{Alerts: statuses},
+			[]string{"s", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"3", "0", "m", "<Enter>"},
+			&UIState{
+				Alerts:         statuses,
+				Silences:       []silence.Silence{{Rule: "traffic", Until: now.Add(30 * time.Minute)}},
+				SilenceChanges: []silence.Silence{{Rule: "traffic", Until: now.Add(30 * time.Minute)}},
+			},
+		},
+		// A silence of 0 lifts the rule's silence
+		{
+			&UIState{Alerts: statuses, Silences: []silence.Silence{silenced}},
+			[]string{"s", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"<Backspace>", "<Backspace>", "<Backspace>", "<Backspace>",
+				"b", "a", "n", "d", "w", "i", "d", "t", "h", "<Space>", "0", "<Enter>"},
+			&UIState{
+				Alerts:         statuses,
+				Silences:       []silence.Silence{},
+				SilenceChanges: []silence.Silence{{Rule: "bandwidth", Until: now}},
+			},
+		},
+		{
+			&UIState{Alerts: statuses},
+			[]string{"s", "x", "<Enter>"},
+			&UIState{
+				Alerts: statuses,
+				Prompt: &Prompt{Kind: SilencePrompt, Label: "Silence rule for duration (0 lifts the silence)",
+					Input: "traffic 1h0m0sx", Error: `invalid duration "1h0m0sx"`},
+			},
+		},
+		{
+			&UIState{},
+			[]string{"s", "x", "<Space>", "1", "h", "<Enter>"},
+			&UIState{
+				Prompt: &Prompt{Kind: SilencePrompt, Label: "Silence rule for duration (0 lifts the silence)",
+					Input: "x 1h", Error: `unknown rule "x"`},
+			},
+		},
+		{
+			&UIState{},
+			[]string{"S"},
+			&UIState{ShowSilences: true},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		for _, key := range testCase.keys {
+			HandleKey(testCase.initialState, key)
+		}
+		if !cmp.Equal(testCase.expectedState, testCase.initialState) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v",
+				caseIdx, testCase.expectedState, testCase.initialState)
+		}
+	}
+}
+
+func TestSilenceMessages(t *testing.T) {
+	now := parseTime("09/May/2018:18:00:00 +0000")
+	state := &UIState{
+		Silences: []silence.Silence{
+			{Rule: "traffic"},
+			{Rule: "bandwidth", Until: now.Add(90 * time.Second)},
+		},
+	}
+	expected := []string{
+		"traffic: acknowledged until it resolves",
+		"bandwidth: silenced until 18:01:30 (1m30s left)",
+	}
+	if actual := SilenceMessages(state, now); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
+
+func TestMutedAlertMessages(t *testing.T) {
+	state := &UIState{
+		Alerts: []alerts.Status{
+			{Rule: alerts.Rule{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 10,
+				Window: time.Minute}, State: alerts.Firing},
+		},
+		Silences: []silence.Silence{{Rule: "traffic"}},
+	}
+	if messages := AlertMessages(state); len(messages) != 0 {
+		t.Errorf("Expected acknowledged alerts to be hidden, got %v", messages)
+	}
+}
@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/gizak/termui"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/timeseries"
+	"strings"
+	"time"
+)
+
+// A Summary holds the key metrics of the log lines in a window
+type Summary struct {
+	Hits          int
+	HitsPerSecond float64
+	// ErrorRate is the percentage of requests with a 5xx status
+	ErrorRate   float64
+	UniqueHosts int
+	Bytes       int
+	// Median and P99 are the request durations of the log lines that have one, and
+	// HasLatency is whether any of them do
+	Median     time.Duration
+	P99        time.Duration
+	HasLatency bool
+}
+
+// The summarize function returns the summary of the log lines between `begin` and `end`
+func summarize(ts *timeseries.LogTimeSeries, begin time.Time, end time.Time, f *filter.Filter) (summary Summary, err error) {
+	statusCounts, err := ts.GetStatusCounts(begin, end, f)
+	if err != nil {
+		return
+	}
+	errors := 0
+	for _, count := range statusCounts {
+		summary.Hits += count.Count
+		if strings.HasPrefix(count.Label, "5") {
+			errors += count.Count
+		}
+	}
+	if seconds := end.Sub(begin).Seconds(); seconds > 0 {
+		summary.HitsPerSecond = float64(summary.Hits) / seconds
+	}
+	if summary.Hits > 0 {
+		summary.ErrorRate = 100 * float64(errors) / float64(summary.Hits)
+	}
+	summary.UniqueHosts, err = ts.CountUniqueHosts(begin, end, f)
+	if err != nil {
+		return
+	}
+	summary.Bytes, err = ts.GetTotalBytes(begin, end, f)
+	if err != nil {
+		return
+	}
+	var latencies int
+	summary.Median, latencies, err = ts.GetDurationPercentile(50, begin, end, f)
+	if err != nil {
+		return
+	}
+	summary.HasLatency = latencies > 0
+	summary.P99, _, err = ts.GetDurationPercentile(99, begin, end, f)
+	return
+}
+
+// The summaryWindow function returns the part of the state's window up to `now`, which
+// the summary panel describes
+func summaryWindow(state *UIState, now time.Time) (begin time.Time, end time.Time) {
+	begin, end = state.Begin, getEnd(state.Begin, state.Timescale)
+	if now.Before(end) {
+		end = now
+	}
+	if end.Before(begin) {
+		end = begin
+	}
+	return
+}
+
+// The loadSummaries function summarizes the state's window up to `now` and the window
+// of the same length before it
+func loadSummaries(state *UIState, ts *timeseries.LogTimeSeries, now time.Time) (err error) {
+	f := viewFilter(state)
+	begin, end := summaryWindow(state, now)
+	state.SummaryDuration = end.Sub(begin)
+	state.Summary, err = summarize(ts, begin, end, f)
+	if err != nil {
+		return
+	}
+	// Both windows include the log lines at their start and end, so the previous
+	// window ends a second before this one starts and covers as many whole seconds
+	previousEnd := begin.Add(-time.Second)
+	state.PreviousSummary, err = summarize(ts, previousEnd.Add(-end.Sub(begin)), previousEnd, f)
+	return
+}
+
+// The formatBytes function formats a number of bytes with a decimal unit, e.g. "1.5 kB"
+func formatBytes(bytes int) string {
+	sign := ""
+	if bytes < 0 {
+		sign, bytes = "-", -bytes
+	}
+	units := []string{"kB", "MB", "GB", "TB"}
+	if bytes < 1000 {
+		return fmt.Sprintf("%s%d B", sign, bytes)
+	}
+	value := float64(bytes) / 1000
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%s%.1f %s", sign, value, units[unit])
+}
+
+// The signed function prefixes a non-negative formatted delta with a plus sign
+func signed(delta string) string {
+	if strings.HasPrefix(delta, "-") {
+		return delta
+	}
+	return "+" + delta
+}
+
+// SummaryMessages returns a line for each metric in the summary panel, with its change
+// since the previous window, e.g. "Hits: 120 (+20)". Latencies are left out if the log
+// lines have no request durations.
+func SummaryMessages(state *UIState) (messages []string) {
+	current, previous := state.Summary, state.PreviousSummary
+	messages = []string{
+		fmt.Sprintf("Hits: %d (%s)", current.Hits, signed(fmt.Sprint(current.Hits-previous.Hits))),
+		fmt.Sprintf("Hits/sec: %.2f (%s)", current.HitsPerSecond,
+			signed(fmt.Sprintf("%.2f", current.HitsPerSecond-previous.HitsPerSecond))),
+		fmt.Sprintf("5xx errors: %.2f%% (%s)", current.ErrorRate,
+			signed(fmt.Sprintf("%.2f", current.ErrorRate-previous.ErrorRate))),
+		fmt.Sprintf("Unique hosts: %d (%s)", current.UniqueHosts,
+			signed(fmt.Sprint(current.UniqueHosts-previous.UniqueHosts))),
+		fmt.Sprintf("Bytes: %s (%s)", formatBytes(current.Bytes), signed(formatBytes(current.Bytes-previous.Bytes))),
+	}
+	if !current.HasLatency {
+		return
+	}
+	latencies := []struct {
+		name              string
+		current, previous time.Duration
+	}{
+		{"Median latency", current.Median, previous.Median},
+		{"p99 latency", current.P99, previous.P99},
+	}
+	for _, latency := range latencies {
+		message := fmt.Sprintf("%s: %v", latency.name, latency.current)
+		if previous.HasLatency {
+			message = fmt.Sprintf("%s (%s)", message, signed((latency.current - latency.previous).String()))
+		}
+		messages = append(messages, message)
+	}
+	return
+}
+
+// SummaryLabel describes the windows the summary panel compares, e.g.
+// "Summary (vs previous 5m0s)"
+func SummaryLabel(state *UIState) string {
+	return fmt.Sprintf("Summary (vs previous %v)", state.SummaryDuration.Truncate(time.Second))
+}
+
+func summaryStats(state *UIState) (stats *termui.Paragraph) {
+	stats = termui.NewParagraph(strings.Join(SummaryMessages(state), "\n"))
+	stats.BorderLabel = SummaryLabel(state)
+	stats.TextFgColor = termui.ColorBlack
+	stats.Height = 9
+	return
+}
@@ -0,0 +1,193 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/timeseries"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	testCases := []struct {
+		bytes    int
+		expected string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1500, "1.5 kB"},
+		{2500000, "2.5 MB"},
+		{-1500, "-1.5 kB"},
+		{3000000000000000, "3000.0 TB"},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := formatBytes(testCase.bytes); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestSummaryMessages(t *testing.T) {
+	testCases := []struct {
+		state    *UIState
+		expected []string
+	}{
+		{
+			&UIState{},
+			[]string{
+				"Hits: 0 (+0)",
+				"Hits/sec: 0.00 (+0.00)",
+				"5xx errors: 0.00% (+0.00)",
+				"Unique hosts: 0 (+0)",
+				"Bytes: 0 B (+0 B)",
+			},
+		},
+		{
+			&UIState{
+				Summary: Summary{Hits: 120, HitsPerSecond: 2, ErrorRate: 2.5, UniqueHosts: 3, Bytes: 1500,
+					Median: 20 * time.Millisecond, P99: time.Second, HasLatency: true},
+				PreviousSummary: Summary{Hits: 150, HitsPerSecond: 2.5, ErrorRate: 1, UniqueHosts: 3, Bytes: 500,
+					Median: 30 * time.Millisecond, P99: 900 * time.Millisecond, HasLatency: true},
+			},
+			[]string{
+				"Hits: 120 (-30)",
+				"Hits/sec: 2.00 (-0.50)",
+				"5xx errors: 2.50% (+1.50)",
+				"Unique hosts: 3 (+0)",
+				"Bytes: 1.5 kB (+1.0 kB)",
+				"Median latency: 20ms (-10ms)",
+				"p99 latency: 1s (+100ms)",
+			},
+		},
+		// Requests logged with a request time of 0 still have a latency, and there is
+		// no change to show if the previous window had no latencies
+		{
+			&UIState{
+				Summary:         Summary{Hits: 1, UniqueHosts: 1, HasLatency: true},
+				PreviousSummary: Summary{Hits: 1, UniqueHosts: 1},
+			},
+			[]string{
+				"Hits: 1 (+0)",
+				"Hits/sec: 0.00 (+0.00)",
+				"5xx errors: 0.00% (+0.00)",
+				"Unique hosts: 1 (+0)",
+				"Bytes: 0 B (+0 B)",
+				"Median latency: 0s",
+				"p99 latency: 0s",
+			},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := SummaryMessages(testCase.state); !cmp.Equal(testCase.expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
+
+func TestSummaryLabel(t *testing.T) {
+	// The label describes the window that was summarized, rather than the window up
+	// to the time it is rendered
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	state := &UIState{Timescale: 5, Begin: parseTime("09/May/2018:18:00:00 +0000"),
+		SummaryDuration: 2*time.Minute + 59*time.Second + 500*time.Millisecond}
+	if expected, actual := "Summary (vs previous 2m59s)", SummaryLabel(state); actual != expected {
+		t.Errorf("Expected: %s\nActual: %s", expected, actual)
+	}
+}
+
+func TestLoadSummaries(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:05:00 +0000")
+	logLines := []timeseries.LogLine{
+		// The previous window
+		{Host: "10.0.0.1", Timestamp: begin.Add(-4 * time.Minute), Path: "/api/users", Status: 200,
+			ResponseBytes: 100, Duration: 10 * time.Millisecond, HasDuration: true},
+		{Host: "10.0.0.1", Timestamp: begin.Add(-time.Second), Path: "/report", Status: 500,
+			ResponseBytes: 100, Duration: 30 * time.Millisecond, HasDuration: true},
+		// Before the previous window
+		{Host: "10.0.0.9", Timestamp: begin.Add(-6 * time.Minute), Path: "/report", Status: 200},
+		// The current window
+		{Host: "10.0.0.1", Timestamp: begin, Path: "/api/users", Status: 200, ResponseBytes: 1000,
+			Duration: 20 * time.Millisecond, HasDuration: true},
+		{Host: "10.0.0.2", Timestamp: begin.Add(time.Minute), Path: "/api/orders", Status: 503,
+			ResponseBytes: 1000, Duration: 20 * time.Millisecond, HasDuration: true},
+		{Host: "10.0.0.3", Timestamp: begin.Add(2 * time.Minute), Path: "/report", Status: 200,
+			ResponseBytes: 1000, Duration: 20 * time.Millisecond, HasDuration: true},
+		{Host: "10.0.0.3", Timestamp: begin.Add(3 * time.Minute), Path: "/report", Status: 200,
+			ResponseBytes: 1000, Duration: 20 * time.Millisecond, HasDuration: true},
+		// After `now`
+		{Host: "10.0.0.4", Timestamp: begin.Add(4*time.Minute + time.Second), Path: "/report", Status: 200},
+	}
+	for _, logLine := range logLines {
+		ts.Record(logLine)
+	}
+	testCases := []struct {
+		state            *UIState
+		expected         Summary
+		expectedPrevious Summary
+	}{
+		{
+			&UIState{Timescale: 5, Begin: begin},
+			Summary{Hits: 4, HitsPerSecond: 4.0 / 240, ErrorRate: 25, UniqueHosts: 3, Bytes: 4000,
+				Median: 20 * time.Millisecond, P99: 20 * time.Millisecond, HasLatency: true},
+			Summary{Hits: 2, HitsPerSecond: 2.0 / 240, ErrorRate: 50, UniqueHosts: 1, Bytes: 200,
+				Median: 10 * time.Millisecond, P99: 30 * time.Millisecond, HasLatency: true},
+		},
+		{
+			&UIState{Timescale: 5, Begin: begin, Section: "report"},
+			Summary{Hits: 2, HitsPerSecond: 2.0 / 240, UniqueHosts: 1, Bytes: 2000,
+				Median: 20 * time.Millisecond, P99: 20 * time.Millisecond, HasLatency: true},
+			Summary{Hits: 1, HitsPerSecond: 1.0 / 240, ErrorRate: 100, UniqueHosts: 1, Bytes: 100,
+				Median: 30 * time.Millisecond, P99: 30 * time.Millisecond, HasLatency: true},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		if err := loadSummaries(testCase.state, &ts, begin.Add(4*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if testCase.state.SummaryDuration != 4*time.Minute {
+			t.Errorf("Error on test case %d.\nExpected a summary of 4m0s, got %v", caseIdx, testCase.state.SummaryDuration)
+		}
+		if !cmp.Equal(testCase.expected, testCase.state.Summary) ||
+			!cmp.Equal(testCase.expectedPrevious, testCase.state.PreviousSummary) {
+			t.Errorf("Error on test case %d.\nExpected: %+v and %+v\nActual: %+v and %+v", caseIdx,
+				testCase.expected, testCase.expectedPrevious, testCase.state.Summary, testCase.state.PreviousSummary)
+		}
+	}
+}
+
+func TestEqualSummaries(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:05:00 +0000")
+	// One hit at each end of both windows, which are 61 seconds long including the
+	// seconds at both ends
+	for _, at := range []time.Time{begin.Add(-61 * time.Second), begin.Add(-time.Second), begin,
+		begin.Add(time.Minute)} {
+		ts.Record(timeseries.LogLine{Host: "10.0.0.1", Timestamp: at, Path: "/report", Status: 200})
+	}
+	state := &UIState{Timescale: 5, Begin: begin}
+	if err := loadSummaries(state, &ts, begin.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Hits: 2 (+0)",
+		"Hits/sec: 0.03 (+0.00)",
+		"5xx errors: 0.00% (+0.00)",
+		"Unique hosts: 1 (+0)",
+		"Bytes: 0 B (+0 B)",
+	}
+	if actual := SummaryMessages(state); !cmp.Equal(expected, actual) {
+		t.Errorf("Expected: %v\nActual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+)
+
+// timescales are the window sizes in minutes that the dashboard zooms through
+var timescales = []int{1, 5, 15, 60, 6 * 60, 24 * 60}
+
+// maxGranularity is the largest number of buckets the traffic chart can be split into
+const maxGranularity = 60
+
+// jumpLayouts are the formats accepted by the jump-to-time prompt. Layouts without a
+// date refer to the current day.
+var jumpLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"15:04:05",
+	"15:04",
+}
+
+// The goLive function returns the dashboard to live mode, showing a window that
+// starts at `now` and moves forward when it expires, or that ends at `now` in
+// rolling mode
+func goLive(state *UIState, now time.Time) {
+	state.Paused = false
+	state.Begin = now
+	if state.Rolling {
+		state.Begin = now.Add(-time.Duration(state.Timescale) * time.Minute)
+	}
+}
+
+// The toggleRolling function switches between a live window that jumps forward when
+// it expires and a rolling window that ends at `now` and slides forward every tick
+func toggleRolling(state *UIState, now time.Time) {
+	state.Rolling = !state.Rolling
+	if state.Rolling && !state.Paused {
+		goLive(state, now)
+	}
+}
+
+// The zoom function changes the timescale to the next preset timescale that is
+// larger, or smaller if `out` is false. It does nothing if there is no such preset.
+func zoom(state *UIState, out bool) {
+	if out {
+		for _, timescale := range timescales {
+			if timescale > state.Timescale {
+				state.Timescale = timescale
+				return
+			}
+		}
+		return
+	}
+	for i := len(timescales) - 1; i >= 0; i-- {
+		if timescales[i] < state.Timescale {
+			state.Timescale = timescales[i]
+			return
+		}
+	}
+}
+
+// The changeGranularity function adds `delta` buckets to the traffic chart, keeping
+// between 1 and maxGranularity buckets
+func changeGranularity(state *UIState, delta int) {
+	state.Granularity += delta
+	if state.Granularity < 1 {
+		state.Granularity = 1
+	}
+	if state.Granularity > maxGranularity {
+		state.Granularity = maxGranularity
+	}
+}
+
+// The stepWindow function moves the dashboard's window `steps` timescales later, or
+// earlier if `steps` is negative. A window that ends before `now` is paused, and
+// stepping to a window that includes `now` or starts after it returns to live mode.
+func stepWindow(state *UIState, steps int, now time.Time) {
+	begin := state.Begin.Add(time.Duration(steps*state.Timescale) * time.Minute)
+	if begin.After(now) {
+		goLive(state, now)
+		return
+	}
+	state.Begin = begin
+	state.Paused = !getEnd(begin, state.Timescale).After(now)
+}
+
+// The parseJumpTime function parses the input of the jump-to-time prompt in the
+// local time zone of `now`
+func parseJumpTime(input string, now time.Time) (t time.Time, err error) {
+	for _, layout := range jumpLayouts {
+		t, err = time.ParseInLocation(layout, input, now.Location())
+		if err != nil {
+			continue
+		}
+		if len(layout) <= len("15:04:05") {
+			year, month, day := now.Date()
+			t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+		}
+		return t, nil
+	}
+	return t, fmt.Errorf("expected a time such as 16:30 or 2018-05-09 16:30:00")
+}
+
+// The submitJump function pauses the dashboard on the window starting at the time in
+// the jump prompt's input, returning an error message if the input is invalid
+func submitJump(state *UIState, input string) string {
+	now := clock()
+	begin, err := parseJumpTime(input, now)
+	if err != nil {
+		return err.Error()
+	}
+	if begin.After(now) {
+		return "time is in the future"
+	}
+	state.Begin = begin
+	state.Paused = true
+	return ""
+}
+
+// HeaderText describes the dashboard's window and whether it is live or paused, e.g.
+// "LIVE: Traffic Statistics from 16:00:00 to 16:05:00"
+func HeaderText(state *UIState) string {
+	mode := "LIVE"
+	if state.Rolling {
+		mode = fmt.Sprintf("LIVE (last %v)", time.Duration(state.Timescale)*time.Minute)
+	}
+	if state.Paused {
+		mode = "PAUSED (l for live)"
+	}
+	// A window on another day shows its date
+	layout := "15:04:05"
+	if state.Begin.Format("2006-01-02") != clock().Format("2006-01-02") {
+		layout = "Jan 02 15:04:05"
+	}
+	end := getEnd(state.Begin, state.Timescale)
+	text := fmt.Sprintf("%s: Traffic Statistics from %s to %s", mode,
+		state.Begin.Format(layout), end.Format(layout))
+	if state.Filter != nil {
+		text = fmt.Sprintf("%s matching %s", text, state.Filter)
+	}
+	if state.Section != "" {
+		text = fmt.Sprintf("%s for %s", text, Breadcrumb(state))
+	}
+	return text
+}
@@ -0,0 +1,223 @@
+package ui
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/timeseries"
+	"testing"
+	"time"
+)
+
+func TestTimelineKeys(t *testing.T) {
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	live := parseTime("09/May/2018:18:00:00 +0000")
+	jumpLabel := "Jump to time, e.g. 16:30 or 2018-05-09 16:30:00"
+	testCases := []struct {
+		keys          []string
+		expectedState *UIState
+	}{
+		{
+			[]string{"<Left>"},
+			&UIState{Timescale: 5, Begin: live.Add(-5 * time.Minute), Paused: true},
+		},
+		{
+			[]string{"<Left>", "<Left>", "<Right>"},
+			&UIState{Timescale: 5, Begin: live.Add(-5 * time.Minute), Paused: true},
+		},
+		// Stepping past the present returns to live mode
+		{
+			[]string{"<Left>", "<Right>"},
+			&UIState{Timescale: 5, Begin: live},
+		},
+		{
+			[]string{"<Right>"},
+			&UIState{Timescale: 5, Begin: now},
+		},
+		{
+			[]string{"<Left>", "l"},
+			&UIState{Timescale: 5, Begin: now},
+		},
+		{
+			[]string{"t", "1", "7", ":", "3", "0", "<Enter>"},
+			&UIState{Timescale: 5, Begin: parseTime("09/May/2018:17:30:00 +0000"), Paused: true},
+		},
+		{
+			[]string{"t", "2", "0", "1", "8", "-", "0", "5", "-", "0", "1", "<Space>", "1", "2", ":", "0", "0",
+				"<Enter>"},
+			&UIState{Timescale: 5, Begin: parseTime("01/May/2018:12:00:00 +0000"), Paused: true},
+		},
+		{
+			[]string{"t", "1", "9", ":", "0", "0", "<Enter>"},
+			&UIState{Timescale: 5, Begin: live,
+				Prompt: &Prompt{Kind: JumpPrompt, Label: jumpLabel, Input: "19:00", Error: "time is in the future"}},
+		},
+		{
+			[]string{"t", "s", "o", "o", "n", "<Enter>"},
+			&UIState{Timescale: 5, Begin: live,
+				Prompt: &Prompt{Kind: JumpPrompt, Label: jumpLabel, Input: "soon",
+					Error: "expected a time such as 16:30 or 2018-05-09 16:30:00"}},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		state := &UIState{Timescale: 5, Begin: live}
+		for _, key := range testCase.keys {
+			HandleKey(state, key)
+		}
+		if !cmp.Equal(testCase.expectedState, state) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v", caseIdx, testCase.expectedState, state)
+		}
+	}
+}
+
+func TestZoomKeys(t *testing.T) {
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	testCases := []struct {
+		initialState  *UIState
+		keys          []string
+		expectedState *UIState
+	}{
+		{&UIState{Timescale: 5}, []string{"-"}, &UIState{Timescale: 15}},
+		{&UIState{Timescale: 5}, []string{"-", "-", "-", "-", "-"}, &UIState{Timescale: 24 * 60}},
+		{&UIState{Timescale: 5}, []string{"+", "+"}, &UIState{Timescale: 1}},
+		// A timescale set by a flag zooms to the nearest preset
+		{&UIState{Timescale: 10}, []string{"="}, &UIState{Timescale: 5}},
+		{&UIState{Timescale: 10}, []string{"-"}, &UIState{Timescale: 15}},
+		{&UIState{Granularity: 10}, []string{"]", "]"}, &UIState{Granularity: 12}},
+		{&UIState{Granularity: 2}, []string{"[", "[", "["}, &UIState{Granularity: 1}},
+		{&UIState{Granularity: maxGranularity}, []string{"]"}, &UIState{Granularity: maxGranularity}},
+		{
+			&UIState{Timescale: 5, Begin: begin},
+			[]string{"r"},
+			&UIState{Timescale: 5, Begin: now.Add(-5 * time.Minute), Rolling: true},
+		},
+		{
+			&UIState{Timescale: 5, Begin: now.Add(-5 * time.Minute), Rolling: true},
+			[]string{"r"},
+			&UIState{Timescale: 5, Begin: now.Add(-5 * time.Minute)},
+		},
+		// A paused window stays put when switching to rolling mode until it goes live
+		{
+			&UIState{Timescale: 5, Begin: begin.Add(-time.Hour), Paused: true},
+			[]string{"r"},
+			&UIState{Timescale: 5, Begin: begin.Add(-time.Hour), Paused: true, Rolling: true},
+		},
+		{
+			&UIState{Timescale: 5, Begin: begin.Add(-time.Hour), Paused: true, Rolling: true},
+			[]string{"l"},
+			&UIState{Timescale: 5, Begin: now.Add(-5 * time.Minute), Rolling: true},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		for _, key := range testCase.keys {
+			HandleKey(testCase.initialState, key)
+		}
+		if !cmp.Equal(testCase.expectedState, testCase.initialState) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v",
+				caseIdx, testCase.expectedState, testCase.initialState)
+		}
+	}
+}
+
+func TestNextUIStateModes(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	begin := parseTime("09/May/2018:18:00:00 +0000")
+	now := begin.Add(10 * time.Minute)
+	state := NextUIState(&UIState{Timescale: 5, Granularity: 5, Begin: begin, Paused: true}, &ts, now)
+	if !state.Begin.Equal(begin) {
+		t.Errorf("Expected a paused window to stay at %v, but it moved to %v", begin, state.Begin)
+	}
+	state.Paused = false
+	state = NextUIState(state, &ts, now)
+	if !state.Begin.Equal(now) {
+		t.Errorf("Expected a live window to move to %v, but it is at %v", now, state.Begin)
+	}
+	state.Rolling = true
+	now = now.Add(time.Second)
+	state = NextUIState(state, &ts, now)
+	if expected := now.Add(-5 * time.Minute); !state.Begin.Equal(expected) {
+		t.Errorf("Expected a rolling window to move to %v, but it is at %v", expected, state.Begin)
+	}
+}
+
+func TestWindowEdgeTraffic(t *testing.T) {
+	db, err := loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := timeseries.LogTimeSeries{db, logFile}
+	// A live window begins at the current time, part way through a second, and log
+	// lines are stored with a resolution of one second, so lines in the first and last
+	// seconds of the window fall just outside it
+	begin := parseTime("09/May/2018:18:00:00 +0000").Add(500 * time.Millisecond)
+	ts.Record(timeseries.LogLine{Timestamp: begin.Truncate(time.Second), Path: "/report", Status: 200})
+	ts.Record(timeseries.LogLine{Timestamp: begin.Add(5 * time.Minute).Truncate(time.Second), Path: "/report",
+		Status: 200})
+	testCases := []struct {
+		keys            []string
+		expectedTraffic Traffic
+	}{
+		{nil, Traffic{1, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{[]string{"[", "[", "[", "["}, Traffic{1, 0, 0, 0, 0, 1}},
+		{[]string{"[", "[", "[", "[", "["}, Traffic{1, 0, 0, 0, 1}},
+		{[]string{"[", "[", "[", "[", "[", "[", "[", "["}, Traffic{1, 1}},
+		{[]string{"[", "[", "[", "[", "[", "[", "[", "[", "["}, Traffic{2}},
+		{[]string{"-"}, Traffic{1, 0, 0, 1, 0, 0, 0, 0, 0, 0}},
+	}
+	for caseIdx, testCase := range testCases {
+		state := &UIState{Timescale: 5, Granularity: 10, Begin: begin, Paused: true}
+		for _, key := range testCase.keys {
+			HandleKey(state, key)
+		}
+		state = NextUIState(state, &ts, begin.Add(time.Hour))
+		if !cmp.Equal(testCase.expectedTraffic, state.Traffic) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expectedTraffic, state.Traffic)
+		}
+	}
+}
+
+func TestHeaderText(t *testing.T) {
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	testCases := []struct {
+		state    *UIState
+		expected string
+	}{
+		{
+			&UIState{Timescale: 5, Begin: parseTime("09/May/2018:18:00:00 +0000")},
+			"LIVE: Traffic Statistics from 18:00:00 to 18:05:00",
+		},
+		{
+			&UIState{Timescale: 5, Begin: parseTime("09/May/2018:17:00:00 +0000"), Paused: true,
+				Filter: mustParseFilter("status>=500")},
+			"PAUSED (l for live): Traffic Statistics from 17:00:00 to 17:05:00 matching status>=500",
+		},
+		{
+			&UIState{Timescale: 5, Begin: parseTime("09/May/2018:18:00:00 +0000"), Section: "api"},
+			"LIVE: Traffic Statistics from 18:00:00 to 18:05:00 for All sections > /api",
+		},
+		{
+			&UIState{Timescale: 60, Begin: parseTime("09/May/2018:17:03:00 +0000"), Rolling: true},
+			"LIVE (last 1h0m0s): Traffic Statistics from 17:03:00 to 18:03:00",
+		},
+		{
+			&UIState{Timescale: 5, Begin: parseTime("01/May/2018:12:00:00 +0000"), Paused: true},
+			"PAUSED (l for live): Traffic Statistics from May 01 12:00:00 to May 01 12:05:00",
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		if actual := HeaderText(testCase.state); actual != testCase.expected {
+			t.Errorf("Error on test case %d.\nExpected: %s\nActual: %s", caseIdx, testCase.expected, actual)
+		}
+	}
+}
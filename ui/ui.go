@@ -3,30 +3,95 @@ package ui
 import (
 	"fmt"
 	"github.com/gizak/termui"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/history"
+	"github.com/jdormit/logr/silence"
 	"github.com/jdormit/logr/timebucketer"
 	"github.com/jdormit/logr/timeseries"
 	"log"
+	"strings"
 	"time"
 )
 
-const recoveredCountdown = 3
+// recoveredDisplay is how long the alert area shows that an alert has recovered
+const recoveredDisplay = 3 * time.Second
+
+// historyRows is the number of incidents shown at once in the Alert History panel
+const historyRows = 5
+
+// topClients is the number of hosts shown in the Top Clients panel
+const topClients = 5
 
 // Traffic is a length-`UIState.Granularity` list of traffic readings,
 // representing the total traffic for each bucket of time in the current time window
 type Traffic []int
 
+// The bucketTraffic function returns the number of hits and the total response bytes
+// in each bucket of the window starting at `begin`
+func bucketTraffic(ts *timeseries.LogTimeSeries, begin time.Time, end time.Time, granularity int, f *filter.Filter) (traffic Traffic, trafficBytes Traffic, err error) {
+	logLines, err := ts.GetLogLines(begin, end, f)
+	if err != nil {
+		return
+	}
+	timeBuckets := timebucketer.Bucket(begin, end, granularity, logLines)
+	return timeBuckets.Hits(), timeBuckets.Bytes(), nil
+}
+
 type UIState struct {
-	SectionCounts      []timeseries.Count
-	StatusCounts       []timeseries.Count
-	Traffic            Traffic
-	Begin              time.Time
-	Timescale          int
-	Granularity        int
-	Alert              bool
-	Recovered          bool
-	RecoveredCountdown int
-	AlertThreshold     float64
-	AlertInterval      int
+	SectionCounts []timeseries.Count
+	// SectionCursor is the index of the section highlighted in the section breakdown
+	SectionCursor int
+	// Section is the section the dashboard is drilled down into, or "" for every section
+	Section string
+	// PathCounts is the top paths in Section, if it is set
+	PathCounts   []timeseries.Count
+	StatusCounts []timeseries.Count
+	HostCounts   []timeseries.Count
+	UniqueHosts  int
+	Traffic      Traffic
+	TrafficBytes Traffic
+	// Summary is the key metrics of the window up to the current time, and
+	// PreviousSummary those of the window of the same length before it.
+	// SummaryDuration is the length of both windows.
+	Summary         Summary
+	PreviousSummary Summary
+	SummaryDuration time.Duration
+	ShowBytes       bool
+	Begin           time.Time
+	// Paused stops the window moving forward when it expires, so that it can be
+	// stepped through or jumped to a point in the past
+	Paused bool
+	// Rolling makes a live window end at the current time and slide forward every
+	// tick, instead of jumping forward when it expires
+	Rolling     bool
+	Timescale   int
+	Granularity int
+	// Alerts is the status of every alert rule as of the latest evaluation
+	Alerts []alerts.Status
+	// AlertHistory is the most recent alert incidents, most recent first
+	AlertHistory []history.Incident
+	// HistoryOffset is the index of the first incident shown in the Alert History panel
+	HistoryOffset int
+	// Silences is the active acknowledgements and silences of alert rules
+	Silences []silence.Silence
+	// SilenceChanges is the acknowledgements and silences made from the dashboard
+	// that have yet to be persisted
+	SilenceChanges []silence.Silence
+	ShowSilences   bool
+	// ShowLogs shows the log viewer, which lists the newest log lines in the window
+	ShowLogs bool
+	// LogLines is the newest log lines in the window, newest first, if ShowLogs is set
+	LogLines []timeseries.LogLine
+	// LogOffset is the index of the first matching log line shown in the log viewer
+	LogOffset int
+	// LogFollow reloads the log viewer's lines every tick
+	LogFollow bool
+	// LogSearch restricts the log viewer to the lines that match it
+	LogSearch string
+	// Filter restricts the log lines shown on the dashboard. It does not affect alerts.
+	Filter *filter.Filter
+	Prompt *Prompt
 }
 
 func getEnd(begin time.Time, timescale int) time.Time {
@@ -42,9 +107,7 @@ func noData() (noData *termui.Paragraph) {
 }
 
 func header(state *UIState) (header *termui.Paragraph) {
-	end := getEnd(state.Begin, state.Timescale)
-	header = termui.NewParagraph(fmt.Sprintf("Traffic Statistics from %s to %s",
-		state.Begin.Format("15:04:05"), end.Format("15:04:05")))
+	header = termui.NewParagraph(HeaderText(state))
 	header.Height = 3
 	header.TextFgColor = termui.ColorBlack
 	header.Border = false
@@ -52,14 +115,23 @@ func header(state *UIState) (header *termui.Paragraph) {
 }
 
 func sectionGraph(state *UIState) termui.GridBufferer {
-	return gaugesWithLabels(state.SectionCounts, "/%s")
+	if state.Section != "" {
+		return gaugesWithLabels(state.PathCounts, "%s", -1)
+	}
+	return gaugesWithLabels(state.SectionCounts, "/%s", state.SectionCursor)
 }
 
 func statusGraph(state *UIState) termui.GridBufferer {
-	return gaugesWithLabels(state.StatusCounts, "%v")
+	return gaugesWithLabels(state.StatusCounts, "%v", -1)
 }
 
-func gaugesWithLabels(counts []timeseries.Count, labelFmt string) termui.GridBufferer {
+func clientsGraph(state *UIState) termui.GridBufferer {
+	return gaugesWithLabels(state.HostCounts, "%s", -1)
+}
+
+// The gaugesWithLabels function renders a labelled gauge for each count, marking the
+// label of the count at index `selected`, if it is not -1
+func gaugesWithLabels(counts []timeseries.Count, labelFmt string, selected int) termui.GridBufferer {
 	numCounts := len(counts)
 
 	if numCounts == 0 {
@@ -77,7 +149,11 @@ func gaugesWithLabels(counts []timeseries.Count, labelFmt string) termui.GridBuf
 	for i := 0; i < numCounts; i++ {
 		count := counts[i]
 		percentage := float64(count.Count) / totalCount * 100.0
-		labels = append(labels, fmt.Sprintf(labelFmt, count.Label))
+		label := fmt.Sprintf(labelFmt, count.Label)
+		if i == selected {
+			label = "> " + label
+		}
+		labels = append(labels, label)
 		labels = append(labels, "")
 		gauge := &termui.Gauge{
 			Percent: int(percentage),
@@ -111,17 +187,23 @@ func statusHeader() (header *termui.Paragraph) {
 	return
 }
 
-func sectionHeader() (header *termui.Paragraph) {
-	header = termui.NewParagraph("Website Section Breakdown")
+func sectionHeader(state *UIState) (header *termui.Paragraph) {
+	text := "Website Section Breakdown (Up/Down and Enter to drill down)"
+	if state.Section != "" {
+		text = fmt.Sprintf("%s: Top Paths (u to go back)", Breadcrumb(state))
+	}
+	header = termui.NewParagraph(text)
 	header.Height = 3
 	header.TextFgColor = termui.ColorBlack
 	header.Border = false
 	return
 }
 
-func summaryStats(state *UIState) (stats *termui.Paragraph) {
-	statsStr := ""
-	stats = termui.NewParagraph(statsStr)
+func clientsHeader(state *UIState) (header *termui.Paragraph) {
+	header = termui.NewParagraph(fmt.Sprintf("Top Clients (%d unique hosts)", state.UniqueHosts))
+	header.Height = 3
+	header.TextFgColor = termui.ColorBlack
+	header.Border = false
 	return
 }
 
@@ -129,6 +211,9 @@ func trafficGraph(state *UIState) (graph termui.GridBufferer) {
 	end := getEnd(state.Begin, state.Timescale)
 	chart := termui.NewBarChart()
 	chart.Data = state.Traffic
+	if state.ShowBytes {
+		chart.Data = state.TrafficBytes
+	}
 	labels := make([]string, state.Granularity)
 	bucketDuration := end.Sub(state.Begin) / time.Duration(state.Granularity)
 	for i := range labels {
@@ -136,14 +221,23 @@ func trafficGraph(state *UIState) (graph termui.GridBufferer) {
 		labels[i] = bucketTime.Format("15:04:05")
 	}
 	chart.DataLabels = labels
-	chart.BorderLabel = fmt.Sprintf("Site Traffic (Hits per %.2f seconds)",
-		bucketDuration.Seconds())
+	scope := "Site"
+	if state.Section != "" {
+		scope = "/" + state.Section
+	}
+	chart.BorderLabel = fmt.Sprintf("%s Traffic (Hits per %.2f seconds)",
+		scope, bucketDuration.Seconds())
+	if state.ShowBytes {
+		chart.BorderLabel = fmt.Sprintf("%s Bandwidth (Bytes per %.2f seconds)",
+			scope, bucketDuration.Seconds())
+	}
 	chart.Height = 9
 	chart.PaddingTop = 1
 	chart.TextColor = termui.ColorBlack
 	chart.BarColor = termui.ColorYellow
 	chart.NumColor = termui.ColorBlack
-	chart.BarWidth = termui.TermWidth()/state.Granularity - 1
+	// The chart shares its row with the summary panel
+	chart.BarWidth = termui.TermWidth()*9/12/state.Granularity - 1
 	graph = chart
 	return
 }
@@ -155,30 +249,114 @@ func empty() termui.GridBufferer {
 	return block
 }
 
+// AlertMessages returns a message describing each alert firing in `state` that
+// hasn't been acknowledged or silenced
+func AlertMessages(state *UIState) (messages []string) {
+	messages = make([]string, 0)
+	for _, status := range state.Alerts {
+		if status.State == alerts.Firing && !muted(state, status.Rule.Name) {
+			current := fmt.Sprintf("%.2f", status.Value)
+			if status.Label != "" {
+				current = fmt.Sprintf("%s for %s %s", current, status.Rule.GroupBy, status.Label)
+			}
+			message := fmt.Sprintf("%s: %s (currently %s) since %s",
+				status.Rule.Name, status.Rule, current, status.Since.Format("15:04:05"))
+			if status.Flapping {
+				message += " (flapping)"
+			}
+			messages = append(messages, message)
+		}
+	}
+	return
+}
+
+// RecoveredMessages returns a message for each alert in `state` that recovered
+// shortly before `now`
+func RecoveredMessages(state *UIState, now time.Time) (messages []string) {
+	messages = make([]string, 0)
+	for _, status := range state.Alerts {
+		if status.State == alerts.Resolved && now.Sub(status.Since) < recoveredDisplay {
+			messages = append(messages, fmt.Sprintf("%s recovered at %s",
+				status.Rule.Name, status.Since.Format("15:04:05")))
+		}
+	}
+	return
+}
+
 func alert(state *UIState) termui.GridBufferer {
-	if state.Alert {
-		message := fmt.Sprintf("Average traffic exceeded %v/second for over %v seconds!",
-			state.AlertThreshold, state.AlertInterval)
-		alert := termui.NewParagraph(message)
+	messages := AlertMessages(state)
+	recovered := RecoveredMessages(state, time.Now())
+	if len(messages) > 0 {
+		alert := termui.NewParagraph(strings.Join(messages, "\n"))
 		alert.BorderFg = termui.ColorRed
 		alert.TextFgColor = termui.ColorRed | termui.AttrBold
-		alert.BorderLabel = "ALERT"
-		alert.Height = 3
+		alert.BorderLabel = "ALERT (a to acknowledge, s to silence)"
+		alert.Height = 2 + len(messages)
 		return alert
-	} else if state.Recovered {
-		message := fmt.Sprintf("Alert recovered at %s",
-			time.Now().Format("15:04:05"))
-		alert := termui.NewParagraph(message)
+	} else if len(recovered) > 0 {
+		alert := termui.NewParagraph(strings.Join(recovered, "\n"))
 		alert.BorderFg = termui.ColorGreen
 		alert.TextFgColor = termui.ColorGreen | termui.AttrBold
 		alert.BorderLabel = "Recovered"
-		alert.Height = 3
+		alert.Height = 2 + len(recovered)
 		return alert
 	} else {
 		return empty()
 	}
 }
 
+// IncidentMessage describes an alert incident, e.g.
+// "traffic: May 09 16:00:00-16:03:00 (3m0s, peak 20.00): traffic > 10 requests/second over 2m0s"
+func IncidentMessage(incident history.Incident, now time.Time) string {
+	period := incident.Start.Format("Jan 02 15:04:05") + "-" + incident.End.Format("15:04:05")
+	if incident.Ongoing() {
+		period = "firing since " + incident.Start.Format("Jan 02 15:04:05")
+	}
+	peak := fmt.Sprintf("%.2f", incident.Peak)
+	if incident.Label != "" {
+		peak = fmt.Sprintf("%s for %s", peak, incident.Label)
+	}
+	return fmt.Sprintf("%s: %s (%v, peak %s): %s", incident.Rule, period,
+		incident.Duration(now).Truncate(time.Second), peak, incident.Condition)
+}
+
+// HistoryMessages returns a message for each incident shown in the Alert History
+// panel, starting from the state's HistoryOffset
+func HistoryMessages(state *UIState, now time.Time) (messages []string) {
+	messages = make([]string, 0)
+	for i := state.HistoryOffset; i < len(state.AlertHistory) && len(messages) < historyRows; i++ {
+		messages = append(messages, IncidentMessage(state.AlertHistory[i], now))
+	}
+	return
+}
+
+// The scrollHistory function moves the Alert History panel `rows` incidents
+// towards older incidents, or towards newer ones if `rows` is negative
+func scrollHistory(state *UIState, rows int) {
+	maxOffset := len(state.AlertHistory) - historyRows
+	state.HistoryOffset += rows
+	if state.HistoryOffset > maxOffset {
+		state.HistoryOffset = maxOffset
+	}
+	if state.HistoryOffset < 0 {
+		state.HistoryOffset = 0
+	}
+}
+
+func alertHistory(state *UIState) termui.GridBufferer {
+	messages := HistoryMessages(state, time.Now())
+	if len(messages) == 0 {
+		return empty()
+	}
+	list := termui.NewList()
+	list.Items = messages
+	list.BorderLabel = fmt.Sprintf("Alert History (%d-%d of %d, j/k to scroll)",
+		state.HistoryOffset+1, state.HistoryOffset+len(messages), len(state.AlertHistory))
+	list.ItemFgColor = termui.ColorBlack
+	list.Height = 2 + len(messages)
+	return list
+}
+
 func currentTime() *termui.Paragraph {
 	currentTime := termui.NewParagraph(fmt.Sprintf("Current time: %s",
 		time.Now().Format("15:04:05")))
@@ -193,12 +371,15 @@ func Render(state *UIState) {
 	header := header(state)
 	currentTime := currentTime()
 
-	sectionHeader := sectionHeader()
+	sectionHeader := sectionHeader(state)
 	sectionGraph := sectionGraph(state)
 
 	statusHeader := statusHeader()
 	statusGraph := statusGraph(state)
 
+	clientsHeader := clientsHeader(state)
+	clientsGraph := clientsGraph(state)
+
 	trafficChart := trafficGraph(state)
 
 	alert := alert(state)
@@ -209,99 +390,196 @@ func Render(state *UIState) {
 		termui.NewRow(
 			termui.NewCol(9, 0, header),
 			termui.NewCol(3, 0, currentTime)),
-		termui.NewRow(termui.NewCol(12, 0, trafficChart)),
+		termui.NewRow(
+			termui.NewCol(9, 0, trafficChart),
+			termui.NewCol(3, 0, summaryStats(state))),
 		termui.NewRow(
 			termui.NewCol(6, 0, sectionHeader),
 			termui.NewCol(6, 0, statusHeader)),
 		termui.NewRow(
 			termui.NewCol(6, 0, sectionGraph),
 			termui.NewCol(6, 0, statusGraph)),
-		termui.NewRow(termui.NewCol(12, 0, alert)))
+		termui.NewRow(termui.NewCol(12, 0, clientsHeader)),
+		termui.NewRow(termui.NewCol(12, 0, clientsGraph)),
+		termui.NewRow(termui.NewCol(12, 0, logViewer(state))),
+		termui.NewRow(termui.NewCol(12, 0, alert)),
+		termui.NewRow(termui.NewCol(12, 0, silences(state))),
+		termui.NewRow(termui.NewCol(12, 0, alertHistory(state))),
+		termui.NewRow(termui.NewCol(12, 0, promptBar(state))))
 	grid.Align()
 	termui.Render(grid)
 }
 
 func NextUIState(state *UIState, ts *timeseries.LogTimeSeries, now time.Time) *UIState {
+	f := viewFilter(state)
 	end := getEnd(state.Begin, state.Timescale)
-	if end.Before(now) {
+	switch {
+	case state.Paused:
+	case state.Rolling:
+		state.Begin = now.Add(-time.Duration(state.Timescale) * time.Minute)
+		end = now
+	case end.Before(now):
 		state.Begin = now
 		end = state.Begin.Add(time.Duration(state.Timescale) * time.Minute)
 	}
 
-	sectionCounts, err := ts.GetSectionCounts(state.Begin, end)
+	sectionCounts, err := ts.GetSectionCounts(state.Begin, end, f)
 	if err != nil {
 		log.Fatal(err)
 	}
 	state.SectionCounts = sectionCounts
+	moveSectionCursor(state, 0)
+
+	state.PathCounts = nil
+	if state.Section != "" {
+		pathCounts, err := ts.GetCountsBy("path", state.Begin, end, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(pathCounts) > topPaths {
+			pathCounts = pathCounts[:topPaths]
+		}
+		state.PathCounts = pathCounts
+	}
 
-	statusCounts, err := ts.GetStatusCounts(state.Begin, end)
+	statusCounts, err := ts.GetStatusCounts(state.Begin, end, f)
 	if err != nil {
 		log.Fatal(err)
 	}
 	state.StatusCounts = statusCounts
 
-	logLines, err := ts.GetLogLines(state.Begin, end)
+	hostCounts, err := ts.GetHostCounts(state.Begin, end, topClients, f)
 	if err != nil {
 		log.Fatal(err)
 	}
-	timeBuckets := timebucketer.Bucket(state.Begin, end, state.Granularity, logLines)
-	traffic := make([]int, state.Granularity)
-	for i, bucket := range timeBuckets {
-		traffic[i] = len(bucket)
+	state.HostCounts = hostCounts
+
+	uniqueHosts, err := ts.CountUniqueHosts(state.Begin, end, f)
+	if err != nil {
+		log.Fatal(err)
 	}
-	state.Traffic = traffic
+	state.UniqueHosts = uniqueHosts
 
-	avgTraffic, err := ts.GetAverageTraffic(now.Add(time.Duration(state.AlertInterval)*-time.Second), now)
+	traffic, trafficBytes, err := bucketTraffic(ts, state.Begin, end, state.Granularity, f)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if state.Recovered {
-		if state.RecoveredCountdown == 0 {
-			state.Recovered = false
-		} else {
-			state.RecoveredCountdown = state.RecoveredCountdown - 1
-		}
+	state.Traffic = traffic
+	state.TrafficBytes = trafficBytes
+
+	err = loadSummaries(state, ts, now)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if avgTraffic > state.AlertThreshold {
-		state.Alert = true
-	} else if state.Alert {
-		state.Alert = false
-		state.Recovered = true
-		state.RecoveredCountdown = recoveredCountdown
+
+	err = loadLogLines(state, ts, state.Begin, end)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	return state
 }
 
-func GetInitialUIState(ts *timeseries.LogTimeSeries, timescale int, granularity int, alertThreshold float64, alertInterval int) (state *UIState, err error) {
+// HandleKey updates the state in response to a keypress, identified by its termui
+// event ID. It returns true if the key was handled, in which case the caller should call
+// NextUIState before re-rendering so that changes such as a submitted filter take
+// effect straight away.
+func HandleKey(state *UIState, key string) bool {
+	if state.Prompt != nil {
+		handlePromptKey(state, key)
+		return true
+	}
+	switch key {
+	case "b":
+		state.ShowBytes = !state.ShowBytes
+	case "/":
+		openPrompt(state, FilterPrompt, "Filter", state.Filter.String())
+	case "j":
+		scrollHistory(state, 1)
+	case "k":
+		scrollHistory(state, -1)
+	case "a":
+		acknowledge(state)
+	case "s":
+		openSilencePrompt(state)
+	case "S":
+		state.ShowSilences = !state.ShowSilences
+	case "<Left>":
+		stepWindow(state, -1, clock())
+	case "<Right>":
+		stepWindow(state, 1, clock())
+	case "t":
+		openPrompt(state, JumpPrompt, "Jump to time, e.g. 16:30 or 2018-05-09 16:30:00", "")
+	case "l":
+		goLive(state, clock())
+	case "r":
+		toggleRolling(state, clock())
+	case "<Down>":
+		moveSectionCursor(state, 1)
+	case "<Up>":
+		moveSectionCursor(state, -1)
+	case "<Enter>":
+		drillDown(state)
+	case "u", "<Backspace>":
+		drillUp(state)
+	case "v":
+		toggleLogs(state)
+	case "f":
+		toggleFollow(state)
+	case "?":
+		openSearchPrompt(state)
+	case "<PageDown>":
+		scrollLogs(state, logRows)
+	case "<PageUp>":
+		scrollLogs(state, -logRows)
+	case "+", "=":
+		zoom(state, false)
+	case "-":
+		zoom(state, true)
+	case "]":
+		changeGranularity(state, 1)
+	case "[":
+		changeGranularity(state, -1)
+	default:
+		return false
+	}
+	return true
+}
+
+func GetInitialUIState(ts *timeseries.LogTimeSeries, timescale int, granularity int, f *filter.Filter) (state *UIState, err error) {
 	begin := time.Now()
 	end := getEnd(begin, timescale)
-	sectionCounts, err := ts.GetSectionCounts(begin, end)
+	sectionCounts, err := ts.GetSectionCounts(begin, end, f)
 	if err != nil {
 		return
 	}
-	statusCounts, err := ts.GetStatusCounts(begin, end)
+	statusCounts, err := ts.GetStatusCounts(begin, end, f)
 	if err != nil {
 		return
 	}
-	logLines, err := ts.GetLogLines(begin, end)
+	hostCounts, err := ts.GetHostCounts(begin, end, topClients, f)
 	if err != nil {
 		return
 	}
-	timeBuckets := timebucketer.Bucket(begin, end, granularity, logLines)
-	traffic := make([]int, granularity)
-	for i, bucket := range timeBuckets {
-		traffic[i] = len(bucket)
+	uniqueHosts, err := ts.CountUniqueHosts(begin, end, f)
+	if err != nil {
+		return
+	}
+	traffic, trafficBytes, err := bucketTraffic(ts, begin, end, granularity, f)
+	if err != nil {
+		return
 	}
 	state = &UIState{
-		Timescale:      timescale,
-		Begin:          begin,
-		SectionCounts:  sectionCounts,
-		StatusCounts:   statusCounts,
-		Traffic:        traffic,
-		Granularity:    granularity,
-		AlertThreshold: alertThreshold,
-		AlertInterval:  alertInterval,
+		Timescale:     timescale,
+		Begin:         begin,
+		SectionCounts: sectionCounts,
+		StatusCounts:  statusCounts,
+		HostCounts:    hostCounts,
+		UniqueHosts:   uniqueHosts,
+		Traffic:       traffic,
+		TrafficBytes:  trafficBytes,
+		Granularity:   granularity,
+		Filter:        f,
 	}
 	return
 }
@@ -3,6 +3,8 @@ package ui
 import (
 	"database/sql"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/history"
 	"github.com/jdormit/logr/timeseries"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
@@ -38,11 +40,9 @@ func TestNextUIState(t *testing.T) {
 	}{
 		{
 			&UIState{
-				Timescale:      5,
-				Begin:          parseTime("09/May/2018:18:00:00 +0000"),
-				Granularity:    5,
-				AlertThreshold: 1,
-				AlertInterval:  1,
+				Timescale:   5,
+				Begin:       parseTime("09/May/2018:18:00:00 +0000"),
+				Granularity: 5,
 			},
 			[]timeseries.LogLine{
 				timeseries.LogLine{
@@ -54,32 +54,36 @@ func TestNextUIState(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:18:03:01 +0000"),
 			&UIState{
-				Timescale:      5,
-				Begin:          parseTime("09/May/2018:18:00:00 +0000"),
-				Granularity:    5,
-				AlertThreshold: 1,
-				AlertInterval:  1,
-				Alert:          false,
+				Timescale:   5,
+				Begin:       parseTime("09/May/2018:18:00:00 +0000"),
+				Granularity: 5,
 				SectionCounts: []timeseries.Count{
 					timeseries.Count{"report", 1},
 				},
 				StatusCounts: []timeseries.Count{
 					timeseries.Count{"200", 1},
 				},
-				Traffic: []int{0, 0, 0, 1, 0},
+				HostCounts: []timeseries.Count{
+					timeseries.Count{"127.0.0.1", 1},
+				},
+				UniqueHosts:     1,
+				Traffic:         []int{0, 0, 0, 1, 0},
+				TrafficBytes:    []int{0, 0, 0, 123, 0},
+				Summary:         Summary{Hits: 1, HitsPerSecond: 1.0 / 181, UniqueHosts: 1, Bytes: 123},
+				SummaryDuration: 181 * time.Second,
 			},
 		},
 		{
 			&UIState{
-				Timescale:      5,
-				Begin:          parseTime("09/May/2018:18:00:00 +0000"),
-				Granularity:    5,
-				AlertThreshold: 1,
-				AlertInterval:  1,
+				Timescale:   5,
+				Begin:       parseTime("09/May/2018:18:00:00 +0000"),
+				Granularity: 5,
 			},
 			[]timeseries.LogLine{
 				timeseries.LogLine{
@@ -91,6 +95,8 @@ func TestNextUIState(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 				timeseries.LogLine{
 					"127.0.0.1",
@@ -101,23 +107,29 @@ func TestNextUIState(t *testing.T) {
 					"/report",
 					200,
 					123,
+					0,
+					false,
 				},
 			},
 			parseTime("09/May/2018:18:03:01 +0000"),
 			&UIState{
-				Timescale:      5,
-				Begin:          parseTime("09/May/2018:18:00:00 +0000"),
-				Granularity:    5,
-				AlertThreshold: 1,
-				AlertInterval:  1,
-				Alert:          true,
+				Timescale:   5,
+				Begin:       parseTime("09/May/2018:18:00:00 +0000"),
+				Granularity: 5,
 				SectionCounts: []timeseries.Count{
 					timeseries.Count{"report", 2},
 				},
 				StatusCounts: []timeseries.Count{
 					timeseries.Count{"200", 2},
 				},
-				Traffic: []int{0, 0, 0, 2, 0},
+				HostCounts: []timeseries.Count{
+					timeseries.Count{"127.0.0.1", 2},
+				},
+				UniqueHosts:     1,
+				Traffic:         []int{0, 0, 0, 2, 0},
+				TrafficBytes:    []int{0, 0, 0, 246, 0},
+				Summary:         Summary{Hits: 2, HitsPerSecond: 2.0 / 181, UniqueHosts: 1, Bytes: 246},
+				SummaryDuration: 181 * time.Second,
 			},
 		},
 	}
@@ -140,3 +152,157 @@ func TestNextUIState(t *testing.T) {
 		}()
 	}
 }
+
+func TestHandleKey(t *testing.T) {
+	incidents := make([]history.Incident, historyRows+2)
+	testCases := []struct {
+		initialState    *UIState
+		key             string
+		expectedHandled bool
+		expectedState   *UIState
+	}{
+		{&UIState{}, "b", true, &UIState{ShowBytes: true}},
+		{&UIState{ShowBytes: true}, "b", true, &UIState{}},
+		{&UIState{}, "<Unknown>", false, &UIState{}},
+		{&UIState{AlertHistory: incidents}, "j", true, &UIState{AlertHistory: incidents, HistoryOffset: 1}},
+		{&UIState{AlertHistory: incidents, HistoryOffset: 2}, "j", true,
+			&UIState{AlertHistory: incidents, HistoryOffset: 2}},
+		{&UIState{AlertHistory: incidents, HistoryOffset: 1}, "k", true, &UIState{AlertHistory: incidents}},
+		{&UIState{AlertHistory: incidents}, "k", true, &UIState{AlertHistory: incidents}},
+		{&UIState{AlertHistory: incidents[:2]}, "j", true, &UIState{AlertHistory: incidents[:2]}},
+	}
+	for caseIdx, testCase := range testCases {
+		handled := HandleKey(testCase.initialState, testCase.key)
+		if handled != testCase.expectedHandled {
+			t.Errorf("Error on test case %d.\nExpected handled: %v\nActual: %v",
+				caseIdx, testCase.expectedHandled, handled)
+		}
+		if !cmp.Equal(testCase.expectedState, testCase.initialState) {
+			t.Errorf("Error on test case %d.\nExpected: %+v\nActual: %+v",
+				caseIdx, testCase.expectedState, testCase.initialState)
+		}
+	}
+}
+
+func TestAlertMessages(t *testing.T) {
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	rule := alerts.Rule{
+		Name:       "traffic",
+		Metric:     alerts.Traffic,
+		Comparison: ">",
+		Threshold:  10,
+		Window:     2 * time.Minute,
+	}
+	testCases := []struct {
+		statuses          []alerts.Status
+		expectedMessages  []string
+		expectedRecovered []string
+	}{
+		{
+			[]alerts.Status{{Rule: rule}},
+			[]string{},
+			[]string{},
+		},
+		{
+			[]alerts.Status{{Rule: rule, State: alerts.Firing, Since: now.Add(-time.Minute), Value: 12.5}},
+			[]string{"traffic: traffic > 10 requests/second over 2m0s (currently 12.50) since 18:02:00"},
+			[]string{},
+		},
+		{
+			[]alerts.Status{{Rule: alerts.Rule{
+				Name:       "api-per-host",
+				Metric:     alerts.Traffic,
+				Comparison: ">",
+				Threshold:  5,
+				Window:     time.Minute,
+				Section:    "api",
+				GroupBy:    "host",
+			}, State: alerts.Firing, Since: now, Value: 6.5, Label: "10.0.0.1"}},
+			[]string{"api-per-host: traffic > 5 requests/second over 1m0s in section api from any one host " +
+				"(currently 6.50 for host 10.0.0.1) since 18:03:00"},
+			[]string{},
+		},
+		{
+			[]alerts.Status{{Rule: rule, State: alerts.Firing, Since: now.Add(-time.Minute), Value: 8, Flapping: true}},
+			[]string{"traffic: traffic > 10 requests/second over 2m0s (currently 8.00) since 18:02:00 (flapping)"},
+			[]string{},
+		},
+		{
+			[]alerts.Status{{Rule: rule, State: alerts.Resolved, Since: now.Add(-time.Second), Value: 2}},
+			[]string{},
+			[]string{"traffic recovered at 18:02:59"},
+		},
+		{
+			[]alerts.Status{{Rule: rule, State: alerts.Resolved, Since: now.Add(-recoveredDisplay), Value: 2}},
+			[]string{},
+			[]string{},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		state := &UIState{Alerts: testCase.statuses}
+		messages := AlertMessages(state)
+		if !cmp.Equal(testCase.expectedMessages, messages) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v",
+				caseIdx, testCase.expectedMessages, messages)
+		}
+		recovered := RecoveredMessages(state, now)
+		if !cmp.Equal(testCase.expectedRecovered, recovered) {
+			t.Errorf("Error on test case %d.\nExpected recovered: %v\nActual: %v",
+				caseIdx, testCase.expectedRecovered, recovered)
+		}
+	}
+}
+
+func TestHistoryMessages(t *testing.T) {
+	now := parseTime("09/May/2018:18:03:00 +0000")
+	ended := history.Incident{
+		Rule:      "traffic",
+		Condition: "traffic > 10 requests/second over 2m0s",
+		Start:     parseTime("09/May/2018:16:00:00 +0000"),
+		End:       parseTime("09/May/2018:16:03:00 +0000"),
+		Peak:      20,
+	}
+	ongoing := history.Incident{
+		Rule:      "busiest",
+		Condition: "traffic > 1 requests/second over 10s from any one section",
+		Start:     parseTime("09/May/2018:18:00:30 +0000"),
+		Peak:      2.5,
+		Label:     "api",
+	}
+	testCases := []struct {
+		state    *UIState
+		expected []string
+	}{
+		{&UIState{}, []string{}},
+		{
+			&UIState{AlertHistory: []history.Incident{ongoing, ended}},
+			[]string{
+				"busiest: firing since May 09 18:00:30 (2m30s, peak 2.50 for api): " +
+					"traffic > 1 requests/second over 10s from any one section",
+				"traffic: May 09 16:00:00-16:03:00 (3m0s, peak 20.00): traffic > 10 requests/second over 2m0s",
+			},
+		},
+		{
+			&UIState{AlertHistory: []history.Incident{ongoing, ended}, HistoryOffset: 1},
+			[]string{
+				"traffic: May 09 16:00:00-16:03:00 (3m0s, peak 20.00): traffic > 10 requests/second over 2m0s",
+			},
+		},
+		{
+			&UIState{AlertHistory: []history.Incident{ended, ended, ended, ended, ended, ended, ended}},
+			[]string{
+				IncidentMessage(ended, now),
+				IncidentMessage(ended, now),
+				IncidentMessage(ended, now),
+				IncidentMessage(ended, now),
+				IncidentMessage(ended, now),
+			},
+		},
+	}
+	for caseIdx, testCase := range testCases {
+		actual := HistoryMessages(testCase.state, now)
+		if !cmp.Equal(testCase.expected, actual) {
+			t.Errorf("Error on test case %d.\nExpected: %v\nActual: %v", caseIdx, testCase.expected, actual)
+		}
+	}
+}
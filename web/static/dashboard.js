@@ -0,0 +1,116 @@
+// Draws the snapshots streamed from /events, following the layout of ui.Render.
+(function () {
+  "use strict";
+
+  var latest = null;
+  var showBytes = document.getElementById("show-bytes");
+
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) {
+      node.className = className;
+    }
+    if (text !== undefined) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function clock(time) {
+    return new Date(time).toTimeString().slice(0, 8);
+  }
+
+  function renderHeader(snapshot) {
+    var text = "Traffic Statistics from " + clock(snapshot.begin) + " to " + clock(snapshot.end);
+    if (snapshot.filter) {
+      text += " matching " + snapshot.filter;
+    }
+    document.getElementById("header").textContent = text;
+    document.getElementById("current-time").textContent = "Current time: " + clock(snapshot.time);
+  }
+
+  function renderTraffic(snapshot) {
+    var data = showBytes.checked ? snapshot.trafficBytes : snapshot.traffic;
+    var begin = new Date(snapshot.begin).getTime();
+    var bucketMillis = (new Date(snapshot.end).getTime() - begin) / snapshot.granularity;
+    var max = Math.max.apply(null, data.concat([1]));
+    var chart = document.getElementById("traffic");
+    chart.replaceChildren();
+    data.forEach(function (value, i) {
+      var bucket = el("div", "bucket");
+      var bar = el("div", "bar");
+      bar.style.height = (100 * value / max) + "%";
+      bucket.append(el("span", "", value), bar, el("small", "", clock(begin + i * bucketMillis)));
+      chart.append(bucket);
+    });
+    var seconds = (bucketMillis / 1000).toFixed(2);
+    document.getElementById("traffic-label").textContent = showBytes.checked ?
+      "Site Bandwidth (Bytes per " + seconds + " seconds)" :
+      "Site Traffic (Hits per " + seconds + " seconds)";
+  }
+
+  function renderGauges(id, counts, labelFormat) {
+    var container = document.getElementById(id);
+    container.replaceChildren();
+    if (!counts || counts.length === 0) {
+      container.append(el("div", "empty", "No data"));
+      return;
+    }
+    var total = counts.reduce(function (sum, count) { return sum + count.count; }, 0);
+    counts.forEach(function (count) {
+      var percent = Math.round(100 * count.count / total);
+      var gauge = el("div", "gauge");
+      var track = el("div", "track");
+      var fill = el("div", "fill", percent + "%");
+      fill.style.width = percent + "%";
+      track.append(fill);
+      gauge.append(el("span", "label", labelFormat(count.label)), track);
+      container.append(gauge);
+    });
+  }
+
+  function renderAlert(snapshot) {
+    var banner = document.getElementById("alert");
+    var messages = document.getElementById("alert-messages");
+    messages.replaceChildren();
+    if (snapshot.alertMessages.length > 0) {
+      banner.className = "firing";
+      document.getElementById("alert-label").textContent = "ALERT";
+      snapshot.alertMessages.forEach(function (message) {
+        messages.append(el("li", "", message));
+      });
+      banner.hidden = false;
+    } else if (snapshot.recoveredMessages.length > 0) {
+      banner.className = "recovered";
+      document.getElementById("alert-label").textContent = "Recovered";
+      snapshot.recoveredMessages.forEach(function (message) {
+        messages.append(el("li", "", message));
+      });
+      banner.hidden = false;
+    } else {
+      banner.hidden = true;
+    }
+  }
+
+  function render(snapshot) {
+    renderHeader(snapshot);
+    renderTraffic(snapshot);
+    renderGauges("sections", snapshot.sectionCounts, function (label) { return "/" + label; });
+    renderGauges("statuses", snapshot.statusCounts, String);
+    document.getElementById("clients-label").textContent =
+      "Top Clients (" + snapshot.uniqueHosts + " unique hosts)";
+    renderGauges("clients", snapshot.hostCounts, String);
+    renderAlert(snapshot);
+  }
+
+  showBytes.addEventListener("change", function () {
+    if (latest) {
+      renderTraffic(latest);
+    }
+  });
+
+  new EventSource("events").onmessage = function (event) {
+    latest = JSON.parse(event.data);
+    render(latest);
+  };
+})();
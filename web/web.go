@@ -0,0 +1,136 @@
+/*
+Package web serves a browser version of the logr dashboard.
+
+The page itself is a set of static assets embedded in the binary. It mirrors the layout
+of the terminal dashboard drawn by ui.Render: a traffic chart, section, status and client
+breakdowns and an alert banner. The page receives a new Snapshot of the dashboard once a
+second as a Server-Sent Event from a Broker, which the ingest loop publishes to.
+*/
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/headless"
+	"github.com/jdormit/logr/ui"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:embed static
+var static embed.FS
+
+// A Snapshot is the data the browser dashboard draws. It extends the headless output
+// with the text of the alert banner.
+type Snapshot struct {
+	headless.Record
+	Filter            string   `json:"filter,omitempty"`
+	Granularity       int      `json:"granularity"`
+	AlertMessages     []string `json:"alertMessages"`
+	RecoveredMessages []string `json:"recoveredMessages"`
+}
+
+// NewSnapshot returns the Snapshot for `state` and the alert `transitions` at time `now`
+func NewSnapshot(state *ui.UIState, transitions []alerts.Transition, now time.Time) Snapshot {
+	return Snapshot{
+		Record:            headless.NewRecord(state, transitions, now),
+		Filter:            state.Filter.String(),
+		Granularity:       state.Granularity,
+		AlertMessages:     ui.AlertMessages(state),
+		RecoveredMessages: ui.RecoveredMessages(state, now),
+	}
+}
+
+// A Broker fans events out to every connected Server-Sent Events client. It should be
+// instantiated via web.NewBroker().
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+	last    []byte
+}
+
+// NewBroker returns a Broker with no clients
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[chan []byte]bool)}
+}
+
+// Publish sends `snapshot` to every connected client. Clients that connect later
+// receive the most recently published snapshot first.
+func (b *Broker) Publish(snapshot Snapshot) error {
+	event, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = event
+	for client := range b.clients {
+		select {
+		case client <- event:
+		default:
+			// The client hasn't consumed the previous event yet. Skip this one
+			// rather than blocking the ingest loop; the next snapshot supersedes it.
+		}
+	}
+	return nil
+}
+
+func (b *Broker) subscribe() (client chan []byte, last []byte) {
+	client = make(chan []byte, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients[client] = true
+	return client, b.last
+}
+
+func (b *Broker) unsubscribe(client chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, client)
+}
+
+// ServeHTTP streams published snapshots to the client as Server-Sent Events until the
+// client disconnects
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	client, last := b.subscribe()
+	defer b.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if last != nil {
+		fmt.Fprintf(w, "data: %s\n\n", last)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-client:
+			fmt.Fprintf(w, "data: %s\n\n", event)
+			flusher.Flush()
+		}
+	}
+}
+
+// Handler returns a handler serving the dashboard page at / and the events
+// published to `broker` at /events
+func Handler(broker *Broker) http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.Handle("/events", broker)
+	return mux
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdormit/logr/alerts"
+	"github.com/jdormit/logr/filter"
+	"github.com/jdormit/logr/headless"
+	"github.com/jdormit/logr/timeseries"
+	"github.com/jdormit/logr/ui"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	now := time.Date(2018, 5, 9, 16, 0, 0, 0, time.UTC)
+	f, err := filter.Parse("status>=500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	traffic := alerts.Rule{Name: "traffic", Metric: alerts.Traffic, Comparison: ">", Threshold: 1, Window: 10 * time.Second}
+	bandwidth := alerts.Rule{Name: "bandwidth", Metric: alerts.Bandwidth, Comparison: ">", Threshold: 1, Window: 10 * time.Second}
+	state := &ui.UIState{
+		Begin:        now,
+		Timescale:    5,
+		Granularity:  2,
+		Traffic:      []int{3, 0},
+		TrafficBytes: []int{300, 0},
+		Alerts: []alerts.Status{
+			{Rule: traffic, State: alerts.Firing, Since: now, Value: 3},
+			{Rule: bandwidth, State: alerts.Resolved, Since: now, Value: 0},
+		},
+		Filter: f,
+	}
+	transitions := []alerts.Transition{{"traffic", alerts.Inactive, alerts.Firing, now, 3, ""}}
+	snapshot := NewSnapshot(state, transitions, now)
+	expected := Snapshot{
+		Record: headless.Record{
+			Time:         now,
+			Begin:        now,
+			End:          now.Add(5 * time.Minute),
+			Traffic:      []int{3, 0},
+			TrafficBytes: []int{300, 0},
+			Alerts:       []string{"traffic"},
+			Transitions:  transitions,
+		},
+		Filter:            "status>=500",
+		Granularity:       2,
+		AlertMessages:     []string{"traffic: traffic > 1 requests/second over 10s (currently 3.00) since 16:00:00"},
+		RecoveredMessages: []string{"bandwidth recovered at 16:00:00"},
+	}
+	if !cmp.Equal(expected, snapshot) {
+		t.Errorf("Expected: %+v\nActual: %+v", expected, snapshot)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	testCases := []struct {
+		path                string
+		expectedContentType string
+		expectedContent     string
+	}{
+		{"/", "text/html", "Website Section Breakdown"},
+		{"/dashboard.js", "javascript", "EventSource"},
+		{"/dashboard.css", "text/css", "#alert"},
+	}
+	server := httptest.NewServer(Handler(NewBroker()))
+	defer server.Close()
+	for caseIdx, testCase := range testCases {
+		resp, err := http.Get(server.URL + testCase.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Error on test case %d. Expected status 200, got %d", caseIdx, resp.StatusCode)
+		}
+		if contentType := resp.Header.Get("Content-Type"); !strings.Contains(contentType, testCase.expectedContentType) {
+			t.Errorf("Error on test case %d. Expected content type %s, got %s",
+				caseIdx, testCase.expectedContentType, contentType)
+		}
+		if !strings.Contains(string(body), testCase.expectedContent) {
+			t.Errorf("Error on test case %d. Expected body to contain %q", caseIdx, testCase.expectedContent)
+		}
+	}
+}
+
+// The awaitEvent function reads the next Server-Sent Event from `events` and
+// decodes its data as a Snapshot
+func awaitEvent(t *testing.T, events *bufio.Reader) (snapshot Snapshot) {
+	line, err := events.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("Expected a data line, got %q", line)
+	}
+	err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blank, err := events.ReadString('\n')
+	if err != nil || blank != "\n" {
+		t.Fatalf("Expected a blank line after the event, got %q", blank)
+	}
+	return
+}
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker()
+	server := httptest.NewServer(Handler(broker))
+	defer server.Close()
+
+	first := Snapshot{Record: headless.Record{UniqueHosts: 1}}
+	err := broker.Publish(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected content type text/event-stream, got %s", contentType)
+	}
+	events := bufio.NewReader(resp.Body)
+
+	// Clients receive the latest snapshot as soon as they connect
+	if snapshot := awaitEvent(t, events); snapshot.UniqueHosts != 1 {
+		t.Errorf("Expected the first snapshot, got %+v", snapshot)
+	}
+
+	second := Snapshot{Record: headless.Record{
+		UniqueHosts:   2,
+		SectionCounts: []timeseries.Count{{"api", 2}},
+	}}
+	err = broker.Publish(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot := awaitEvent(t, events); !cmp.Equal(second, snapshot) {
+		t.Errorf("Expected: %+v\nActual: %+v", second, snapshot)
+	}
+}